@@ -0,0 +1,78 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/fadykuzman/schluckauf/internal/library"
+	"github.com/fadykuzman/schluckauf/internal/scan"
+	"github.com/fadykuzman/schluckauf/internal/storage"
+)
+
+// runImport loads a czkawka JSON output given on the command line:
+//
+//	dup-reviewer import [-kind image] [-directory /photos -merge] results.json
+//
+// The directory must be within the library roots, like for imports through
+// the API. The import runs in its own process, outside of the operation lock
+// of the server, so it must not run while the server is scanning, importing
+// or trashing.
+func runImport(store *storage.Storage, lib *library.Library, scansDir string, args []string) error {
+	flags := flag.NewFlagSet("import", flag.ExitOnError)
+	kind := flags.String("kind", "", "kind of czkawka output, detected from the file if empty")
+	directory := flags.String("directory", "", "directory that was scanned, needed to merge")
+	merge := flags.Bool("merge", false, "merge into the stored results instead of replacing them")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: dup-reviewer import [flags] <czkawka-output.json>")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	if flags.NArg() != 1 {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	if *kind != "" && !storage.Kind(*kind).Valid() {
+		return fmt.Errorf("unsupported kind %q", *kind)
+	}
+	if *merge && *directory == "" {
+		return fmt.Errorf("merging an import needs the directory that was scanned")
+	}
+	if *directory != "" {
+		real, err := lib.Resolve(*directory)
+		if errors.Is(err, library.ErrOutsideRoots) {
+			return fmt.Errorf("directory %s is outside the library roots", *directory)
+		}
+		if err != nil {
+			return fmt.Errorf("invalid directory: %w", err)
+		}
+		if info, err := os.Stat(real); err != nil || !info.IsDir() {
+			return fmt.Errorf("%s is not a directory", *directory)
+		}
+		*directory = real
+	}
+
+	job, validation, err := scan.ImportFile(store, scansDir, storage.Kind(*kind), *directory, flags.Arg(0), *merge)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Imported %s output: %d accepted, %d skipped\n", validation.Type, validation.Accepted, len(validation.Skipped))
+	for _, problem := range validation.Skipped {
+		fmt.Printf("  skipped %s: %s\n", problem.Location, problem.Reason)
+	}
+	fmt.Println(job.Message)
+
+	if job.Report != nil {
+		report, err := json.MarshalIndent(job.Report, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(report))
+	}
+	return nil
+}
@@ -1,12 +1,19 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
+	"strconv"
+	"time"
 
 	"github.com/fadykuzman/schluckauf/internal/handler"
+	"github.com/fadykuzman/schluckauf/internal/library"
+	"github.com/fadykuzman/schluckauf/internal/operation"
+	"github.com/fadykuzman/schluckauf/internal/scan"
+	"github.com/fadykuzman/schluckauf/internal/schedule"
 	"github.com/fadykuzman/schluckauf/internal/storage"
 )
 
@@ -22,18 +29,132 @@ func main() {
 	}
 	defer store.Close()
 
-	h := handler.New(store)
+	scansDir := os.Getenv("SCANS_DIR")
+	if scansDir == "" {
+		scansDir = "./scans"
+	}
+
+	lib, err := libraryRoots()
+	if err != nil {
+		log.Fatal(fmt.Errorf("error: %+v", err))
+	}
+	store.SetLibrary(lib)
+
+	if len(os.Args) > 1 && os.Args[1] == "import" {
+		if err := runImport(store, lib, scansDir, os.Args[2:]); err != nil {
+			store.Close()
+			log.Fatal(fmt.Errorf("error: %+v", err))
+		}
+		return
+	}
+
+	retention, err := scanRetention()
+	if err != nil {
+		log.Fatal(fmt.Errorf("error: %+v", err))
+	}
+
+	scanner := os.Getenv("SCANNER")
+	if scanner == "" {
+		scanner = scan.ScannerAuto
+	}
+
+	serveByPath := true
+	if v := os.Getenv("SERVE_BY_PATH"); v != "" {
+		serveByPath, err = strconv.ParseBool(v)
+		if err != nil {
+			log.Fatal(fmt.Errorf("error: invalid SERVE_BY_PATH %q: %w", v, err))
+		}
+	}
+
+	lock := &operation.Lock{}
+	scans, err := scan.NewManager(store, scansDir, retention, scanner, lock)
+	if err != nil {
+		log.Fatal(fmt.Errorf("error: %+v", err))
+	}
+
+	go schedule.NewScheduler(store, scans, lib).Run(context.Background())
+
+	h := handler.New(store, store, scans, lib, lock)
 
 	http.HandleFunc("GET /api/groups", h.ListImageGroups)
 	http.HandleFunc("/health", h.Health)
 	http.HandleFunc("GET /api/groups/{id}", h.GetGroupImages)
-	http.HandleFunc("/api/image", h.ServeImage)
+	if serveByPath {
+		http.HandleFunc("/api/image", h.ServeImage)
+	}
+	http.HandleFunc("GET /api/files/{id}/content", h.ServeFileContent)
+	http.HandleFunc("GET /api/libraries", h.ListLibraries)
+	http.HandleFunc("GET /api/operation", h.GetOperation)
 	http.HandleFunc("POST /api/groups/{gid}/files/{fid}", h.UpdateImageAction)
 	http.HandleFunc("GET /api/groups/stats", h.GetGroupStats)
+	http.HandleFunc("POST /api/groups/{id}/archive", h.ArchiveGroup)
+	http.HandleFunc("DELETE /api/groups/{id}/archive", h.UnarchiveGroup)
 	http.HandleFunc("POST /api/files/actions/trash", h.TrashImages)
 	http.HandleFunc("POST /api/scan", h.ScanDirectory)
+	http.HandleFunc("GET /api/scan/jobs/{id}", h.GetScanJob)
+	http.HandleFunc("DELETE /api/scan/jobs/{id}", h.CancelScanJob)
+	http.HandleFunc("GET /api/scans", h.ListScanJobs)
+	http.HandleFunc("GET /api/scans/{id}/artifact", h.DownloadScanArtifact)
+	http.HandleFunc("POST /api/scans/{id}/reimport", h.ReimportScan)
+	http.HandleFunc("POST /api/import", h.ImportResults)
+	http.HandleFunc("GET /api/schedules", h.ListSchedules)
+	http.HandleFunc("POST /api/schedules", h.CreateSchedule)
+	http.HandleFunc("GET /api/schedules/{id}", h.GetSchedule)
+	http.HandleFunc("PUT /api/schedules/{id}", h.UpdateSchedule)
+	http.HandleFunc("DELETE /api/schedules/{id}", h.DeleteSchedule)
+	http.HandleFunc("GET /api/schedules/{id}/runs", h.ListScheduleRuns)
+	http.HandleFunc("GET /api/findings/{kind}", h.ListFindings)
+	http.HandleFunc("GET /api/findings/{kind}/summary", h.GetFindingSummary)
+	http.HandleFunc("POST /api/findings/{kind}/{id}", h.UpdateFindingAction)
+	http.HandleFunc("POST /api/findings/{kind}/actions/select", h.SelectAllFindings)
+	http.HandleFunc("POST /api/findings/symlinks/{id}/repoint", h.RepointSymlink)
+	http.HandleFunc("POST /api/findings/{kind}/actions/trash", h.TrashFindings)
 
 	http.Handle("/", http.FileServer(http.Dir("./web")))
 	fmt.Println("Server running on http://localhost:8080")
 	log.Fatal(http.ListenAndServe(":8080", nil))
 }
+
+// libraryRoots reads the directories that may be scanned, served and
+// trashed from LIBRARY_ROOTS, a comma separated list of name=path
+// entries. Without it, PHOTOS_DIR (default ./test) is the only root.
+func libraryRoots() (*library.Library, error) {
+	if v := os.Getenv("LIBRARY_ROOTS"); v != "" {
+		lib, err := library.Parse(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid LIBRARY_ROOTS %q: %w", v, err)
+		}
+		return lib, nil
+	}
+
+	photosDir := os.Getenv("PHOTOS_DIR")
+	if photosDir == "" {
+		photosDir = "./test"
+	}
+	return library.New([]library.Root{{Name: "photos", Path: photosDir}})
+}
+
+// scanRetention reads how many scan artifacts are kept, and for how long,
+// from SCAN_ARTIFACTS_KEEP (default 50) and SCAN_ARTIFACTS_MAX_AGE (a
+// duration like 720h, unlimited by default). Zero disables a limit.
+func scanRetention() (scan.Retention, error) {
+	retention := scan.Retention{Keep: 50}
+
+	if v := os.Getenv("SCAN_ARTIFACTS_KEEP"); v != "" {
+		keep, err := strconv.Atoi(v)
+		if err != nil {
+			return retention, fmt.Errorf("invalid SCAN_ARTIFACTS_KEEP %q: %w", v, err)
+		}
+		retention.Keep = keep
+	}
+
+	if v := os.Getenv("SCAN_ARTIFACTS_MAX_AGE"); v != "" {
+		maxAge, err := time.ParseDuration(v)
+		if err != nil {
+			return retention, fmt.Errorf("invalid SCAN_ARTIFACTS_MAX_AGE %q: %w", v, err)
+		}
+		retention.MaxAge = maxAge
+	}
+
+	return retention, nil
+}
@@ -2,6 +2,11 @@ module github.com/fadykuzman/schluckauf
 
 go 1.25.1
 
+require (
+	golang.org/x/image v0.36.0
+	modernc.org/sqlite v1.39.0
+)
+
 require (
 	github.com/dustin/go-humanize v1.0.1 // indirect
 	github.com/google/uuid v1.6.0 // indirect
@@ -13,5 +18,4 @@ require (
 	modernc.org/libc v1.66.3 // indirect
 	modernc.org/mathutil v1.7.1 // indirect
 	modernc.org/memory v1.11.0 // indirect
-	modernc.org/sqlite v1.39.0 // indirect
 )
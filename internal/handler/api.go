@@ -2,13 +2,24 @@
 package handler
 
 import (
+	"github.com/fadykuzman/schluckauf/internal/library"
+	"github.com/fadykuzman/schluckauf/internal/operation"
+	"github.com/fadykuzman/schluckauf/internal/scan"
 	"github.com/fadykuzman/schluckauf/internal/storage"
 )
 
 type Handler struct {
-	store *storage.Storage
+	groups  storage.GroupStore
+	store   *storage.Storage
+	scans   *scan.Manager
+	library *library.Library
+	lock    *operation.Lock
 }
 
-func New(store *storage.Storage) *Handler {
-	return &Handler{store: store}
+// New serves the duplicate groups from groups, and findings, schedules and
+// scan history from store. Only the routes for findings, schedules, scans
+// and imports use store and scans, so a handler serving groups alone may be
+// built without them.
+func New(groups storage.GroupStore, store *storage.Storage, scans *scan.Manager, lib *library.Library, lock *operation.Lock) *Handler {
+	return &Handler{groups: groups, store: store, scans: scans, library: lib, lock: lock}
 }
@@ -0,0 +1,280 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+
+	"github.com/fadykuzman/schluckauf/internal/library"
+	"github.com/fadykuzman/schluckauf/internal/storage"
+)
+
+// defaultFindingsPageSize is the page size used when listing findings
+// without a limit.
+const defaultFindingsPageSize = 100
+
+func (h *Handler) ListFindings(w http.ResponseWriter, r *http.Request) {
+	kind, ok := findingKind(w, r)
+	if !ok {
+		return
+	}
+
+	query := r.URL.Query()
+	filter := storage.FindingFilter{
+		Kind:      kind,
+		ErrorType: query.Get("errorType"),
+		Extension: query.Get("ext"),
+		Sort:      storage.FindingSort(query.Get("sort")),
+		Limit:     defaultFindingsPageSize,
+	}
+
+	switch filter.Sort {
+	case "":
+		filter.Sort = storage.SortByPath
+		if kind == storage.KindBig {
+			filter.Sort = storage.SortBySize
+		}
+	case storage.SortByPath, storage.SortBySize:
+	default:
+		http.Error(w, fmt.Sprintf("Unsupported sort %q", filter.Sort), http.StatusBadRequest)
+		return
+	}
+
+	if v := query.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit < 1 {
+			http.Error(w, "Invalid limit", http.StatusBadRequest)
+			return
+		}
+		filter.Limit = limit
+	}
+	if v := query.Get("offset"); v != "" {
+		offset, err := strconv.Atoi(v)
+		if err != nil || offset < 0 {
+			http.Error(w, "Invalid offset", http.StatusBadRequest)
+			return
+		}
+		filter.Offset = offset
+	}
+
+	page, err := h.store.ListFindings(filter)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(page)
+}
+
+func (h *Handler) GetFindingSummary(w http.ResponseWriter, r *http.Request) {
+	kind, ok := findingKind(w, r)
+	if !ok {
+		return
+	}
+
+	summary, err := h.store.GetFindingSummary(kind)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(summary)
+}
+
+func (h *Handler) UpdateFindingAction(w http.ResponseWriter, r *http.Request) {
+	kind, ok := findingKind(w, r)
+	if !ok {
+		return
+	}
+
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Invalid Finding ID", http.StatusBadRequest)
+		return
+	}
+
+	var req UpdateImageActionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if !findingActionAllowed(kind, req.Action) {
+		http.Error(w, "Action must be 'keep', 'trash', 'pending' or, for wrong extensions, 'rename'", http.StatusBadRequest)
+		return
+	}
+
+	err = h.store.UpdateFindingAction(kind, id, req.Action)
+	if errors.Is(err, storage.ErrNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{"status": "success"})
+}
+
+type RepointSymlinkRequest struct {
+	Target string `json:"target"`
+}
+
+func (h *Handler) RepointSymlink(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Invalid Finding ID", http.StatusBadRequest)
+		return
+	}
+
+	var req RepointSymlinkRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, fmt.Sprintf("Invalid request body (%v)", err), http.StatusBadRequest)
+		return
+	}
+
+	if !filepath.IsAbs(req.Target) {
+		http.Error(w, "Target must be an absolute path", http.StatusBadRequest)
+		return
+	}
+	if _, err := os.Stat(req.Target); err != nil {
+		http.Error(w, "Target does not exist", http.StatusBadRequest)
+		return
+	}
+	if _, err := h.library.Resolve(req.Target); err != nil {
+		http.Error(w, "Target is outside the library roots", http.StatusForbidden)
+		return
+	}
+
+	err = h.store.RepointSymlink(id, req.Target)
+	if errors.Is(err, storage.ErrNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if errors.Is(err, library.ErrOutsideRoots) {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{"status": "success"})
+}
+
+type SelectAllFindingsRequest struct {
+	Action  storage.ImageAction `json:"action"`
+	Exclude []int               `json:"exclude"`
+}
+
+// SelectAllFindings marks every finding of a kind, except the excluded ones,
+// for the next trash run.
+func (h *Handler) SelectAllFindings(w http.ResponseWriter, r *http.Request) {
+	kind, ok := findingKind(w, r)
+	if !ok {
+		return
+	}
+
+	var req SelectAllFindingsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, fmt.Sprintf("Invalid request body (%v)", err), http.StatusBadRequest)
+		return
+	}
+
+	if req.Action == "" {
+		req.Action = storage.ActionTrash
+	}
+	if !findingActionAllowed(kind, req.Action) {
+		http.Error(w, "Action must be 'keep', 'trash', 'pending' or, for wrong extensions, 'rename'", http.StatusBadRequest)
+		return
+	}
+
+	exclude := slices.Compact(slices.Sorted(slices.Values(req.Exclude)))
+	selected, err := h.store.SelectAllFindings(kind, req.Action, exclude)
+	if errors.Is(err, storage.ErrNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]int{"selected": selected, "excluded": len(exclude)})
+}
+
+type TrashFindingsRequest struct {
+	IDs []int `json:"ids"`
+}
+
+func (h *Handler) TrashFindings(w http.ResponseWriter, r *http.Request) {
+	kind, ok := findingKind(w, r)
+	if !ok {
+		return
+	}
+
+	var req TrashFindingsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, fmt.Sprintf("Invalid request body (%v)", err), http.StatusBadRequest)
+		return
+	}
+
+	if len(req.IDs) == 0 {
+		http.Error(w, "No findings selected", http.StatusBadRequest)
+		return
+	}
+
+	held, ok := h.startTrash(w, r)
+	if !ok {
+		return
+	}
+	defer held.Release()
+
+	response, err := h.store.TrashFindings(kind, req.IDs)
+	if errors.Is(err, storage.ErrNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// findingKind reads the kind path value of findings routes.
+func findingKind(w http.ResponseWriter, r *http.Request) (storage.Kind, bool) {
+	kind := storage.Kind(r.PathValue("kind"))
+	if !slices.Contains(storage.FindingKinds, kind) {
+		http.Error(w, fmt.Sprintf("Unsupported kind %q", kind), http.StatusBadRequest)
+		return "", false
+	}
+	return kind, true
+}
+
+// findingActionAllowed reports whether findings of kind can be marked with
+// action. Renaming to the detected extension is only offered for files with
+// a wrong extension.
+func findingActionAllowed(kind storage.Kind, action storage.ImageAction) bool {
+	switch action {
+	case storage.ActionKeep, storage.ActionTrash, storage.ActionPending:
+		return true
+	case storage.ActionRename:
+		return kind == storage.KindExtensions
+	}
+	return false
+}
@@ -2,18 +2,93 @@ package handler
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
+	"slices"
 	"strconv"
+
+	"github.com/fadykuzman/schluckauf/internal/storage"
 )
 
+// defaultGroupsPageSize is the page size used when listing groups without
+// a limit.
+const defaultGroupsPageSize = 100
+
 func (h *Handler) ListImageGroups(w http.ResponseWriter, r *http.Request) {
-	groups, err := h.store.ListImageGroups()
+	kind, ok := groupKind(w, r)
+	if !ok {
+		return
+	}
+
+	query := r.URL.Query()
+	filter := storage.GroupFilter{
+		Kind:      kind,
+		Status:    storage.GroupStatus(query.Get("status")),
+		Path:      query.Get("path"),
+		Directory: query.Get("dir"),
+		Extension: query.Get("ext"),
+		Sort:      storage.GroupSort(query.Get("sort")),
+		Limit:     defaultGroupsPageSize,
+		Cursor:    query.Get("cursor"),
+	}
+
+	switch filter.Status {
+	case "", storage.StatusPending, storage.StatusDecided, storage.StatusArchived:
+	default:
+		http.Error(w, fmt.Sprintf("Unsupported status %q", filter.Status), http.StatusBadRequest)
+		return
+	}
+	if filter.Sort != "" && !slices.Contains(storage.GroupSorts, filter.Sort) {
+		http.Error(w, fmt.Sprintf("Unsupported sort %q", filter.Sort), http.StatusBadRequest)
+		return
+	}
+
+	for _, p := range []struct {
+		name  string
+		value *int
+	}{
+		{"limit", &filter.Limit},
+		{"minCount", &filter.MinCount},
+		{"maxCount", &filter.MaxCount},
+	} {
+		if v := query.Get(p.name); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 1 {
+				http.Error(w, "Invalid "+p.name, http.StatusBadRequest)
+				return
+			}
+			*p.value = n
+		}
+	}
+	for _, p := range []struct {
+		name  string
+		value *int64
+	}{
+		{"minSize", &filter.MinSize},
+		{"maxSize", &filter.MaxSize},
+	} {
+		if v := query.Get(p.name); v != "" {
+			n, err := strconv.ParseInt(v, 10, 64)
+			if err != nil || n < 0 {
+				http.Error(w, "Invalid "+p.name, http.StatusBadRequest)
+				return
+			}
+			*p.value = n
+		}
+	}
+
+	page, err := h.groups.ListImageGroups(filter)
+	if errors.Is(err, storage.ErrInvalidCursor) {
+		http.Error(w, "Invalid cursor", http.StatusBadRequest)
+		return
+	}
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(groups)
+	json.NewEncoder(w).Encode(page)
 }
 
 func (h *Handler) Health(w http.ResponseWriter, r *http.Request) {
@@ -27,7 +102,7 @@ func (h *Handler) GetGroupImages(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Invalid Group ID", http.StatusBadRequest)
 		return
 	}
-	files, err := h.store.GetGroupImages(groupID)
+	files, err := h.groups.GetGroupImages(groupID)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -37,8 +112,42 @@ func (h *Handler) GetGroupImages(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(files)
 }
 
+func (h *Handler) ArchiveGroup(w http.ResponseWriter, r *http.Request) {
+	h.setGroupArchived(w, r, true)
+}
+
+func (h *Handler) UnarchiveGroup(w http.ResponseWriter, r *http.Request) {
+	h.setGroupArchived(w, r, false)
+}
+
+func (h *Handler) setGroupArchived(w http.ResponseWriter, r *http.Request, archived bool) {
+	groupID, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Invalid Group ID", http.StatusBadRequest)
+		return
+	}
+
+	err = h.groups.SetGroupArchived(groupID, archived)
+	if errors.Is(err, storage.ErrNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{"status": "success"})
+}
+
 func (h *Handler) GetGroupStats(w http.ResponseWriter, r *http.Request) {
-	gs, err := h.store.GetImageGroupStats()
+	kind, ok := groupKind(w, r)
+	if !ok {
+		return
+	}
+
+	gs, err := h.groups.GetImageGroupStats(kind)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 	}
@@ -46,3 +155,16 @@ func (h *Handler) GetGroupStats(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(gs)
 }
+
+// groupKind reads the kind query parameter, defaulting to image groups.
+func groupKind(w http.ResponseWriter, r *http.Request) (storage.Kind, bool) {
+	kind := storage.Kind(r.URL.Query().Get("kind"))
+	if kind == "" {
+		return storage.KindImage, true
+	}
+	if !slices.Contains(storage.GroupKinds, kind) {
+		http.Error(w, fmt.Sprintf("Unsupported kind %q", kind), http.StatusBadRequest)
+		return "", false
+	}
+	return kind, true
+}
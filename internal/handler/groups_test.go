@@ -0,0 +1,180 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/fadykuzman/schluckauf/internal/library"
+	"github.com/fadykuzman/schluckauf/internal/operation"
+	"github.com/fadykuzman/schluckauf/internal/storage"
+)
+
+// TestGroupRoutesWithMemory serves the group routes from an in-memory
+// store, without a database or scan manager.
+func TestGroupRoutesWithMemory(t *testing.T) {
+	t.Setenv("TRASH_DIR", t.TempDir())
+
+	root := t.TempDir()
+	lib, err := library.New([]library.Root{{Name: "photos", Path: root}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	root = lib.Roots()[0].Path
+
+	keep := filepath.Join(root, "a.jpg")
+	trash := filepath.Join(root, "b.jpg")
+	for _, path := range []string{keep, trash} {
+		if err := os.WriteFile(path, []byte("image"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	groups := storage.NewMemory()
+	groups.SetLibrary(lib)
+	gid, err := groups.CreateImageGroup(storage.KindImage, "hash", 5, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ids []int
+	for _, path := range []string{keep, trash} {
+		id, err := groups.CreateImage(gid, storage.ScanFile{Path: path, Size: 5, ModifiedDate: 1})
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, id)
+	}
+
+	h := New(groups, nil, nil, lib, &operation.Lock{})
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/groups", h.ListImageGroups)
+	mux.HandleFunc("GET /api/groups/{id}", h.GetGroupImages)
+	mux.HandleFunc("GET /api/groups/stats", h.GetGroupStats)
+	mux.HandleFunc("GET /api/files/{id}/content", h.ServeFileContent)
+	mux.HandleFunc("POST /api/groups/{gid}/files/{fid}", h.UpdateImageAction)
+	mux.HandleFunc("POST /api/groups/{id}/archive", h.ArchiveGroup)
+	mux.HandleFunc("POST /api/files/actions/trash", h.TrashImages)
+
+	do := func(method, target, body string, want int) *httptest.ResponseRecorder {
+		t.Helper()
+
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, httptest.NewRequest(method, target, strings.NewReader(body)))
+		if w.Code != want {
+			t.Fatalf("%s %s = %d %q, want %d", method, target, w.Code, w.Body.String(), want)
+		}
+		return w
+	}
+
+	var page storage.GroupPage
+	if err := json.NewDecoder(do("GET", "/api/groups?limit=1", "", 200).Body).Decode(&page); err != nil {
+		t.Fatal(err)
+	}
+	if page.Total != 1 || len(page.Groups) != 1 || page.Groups[0].ID != gid {
+		t.Errorf("groups = %+v, want group %d", page, gid)
+	}
+
+	var images []storage.Image
+	if err := json.NewDecoder(do("GET", "/api/groups/"+strconv.Itoa(gid), "", 200).Body).Decode(&images); err != nil {
+		t.Fatal(err)
+	}
+	if len(images) != 2 {
+		t.Errorf("images = %+v, want 2", images)
+	}
+
+	if body := do("GET", "/api/files/"+strconv.Itoa(ids[0])+"/content", "", 200).Body.String(); body != "image" {
+		t.Errorf("file content = %q, want %q", body, "image")
+	}
+
+	do("POST", "/api/groups/"+strconv.Itoa(gid)+"/files/"+strconv.Itoa(ids[0]), `{"action": "keep"}`, 200)
+	do("POST", "/api/groups/"+strconv.Itoa(gid)+"/files/"+strconv.Itoa(ids[1]), `{"action": "trash"}`, 200)
+	do("POST", "/api/groups/"+strconv.Itoa(gid+1)+"/files/"+strconv.Itoa(ids[1]), `{"action": "trash"}`, 404)
+
+	var stats storage.ImageGroupStats
+	if err := json.NewDecoder(do("GET", "/api/groups/stats", "", 200).Body).Decode(&stats); err != nil {
+		t.Fatal(err)
+	}
+	if want := (storage.ImageGroupStats{Decided: 1, ImagesToTrashCount: 1}); stats != want {
+		t.Errorf("stats = %+v, want %+v", stats, want)
+	}
+
+	var trashed storage.TrashImagesResponse
+	if err := json.NewDecoder(do("POST", "/api/files/actions/trash", "", 200).Body).Decode(&trashed); err != nil {
+		t.Fatal(err)
+	}
+	if trashed.MovedCount != 1 || trashed.ArchivedGroups != 1 {
+		t.Errorf("trash run = %+v, want one moved file and one archived group", trashed)
+	}
+	if _, err := os.Stat(trash); !os.IsNotExist(err) {
+		t.Errorf("trashed file still exists: %v", err)
+	}
+	do("GET", "/api/files/"+strconv.Itoa(ids[1])+"/content", "", 404)
+
+	if err := json.NewDecoder(do("GET", "/api/groups?status=archived", "", 200).Body).Decode(&page); err != nil {
+		t.Fatal(err)
+	}
+	if page.Total != 1 {
+		t.Errorf("archived groups = %+v, want the trashed group", page)
+	}
+	do("POST", "/api/groups/"+strconv.Itoa(gid+1)+"/archive", "", 404)
+}
+
+// TestListGroupsPaging follows the cursors of a listing through groups that
+// sort alike.
+func TestListGroupsPaging(t *testing.T) {
+	groups := storage.NewMemory()
+	var want []int
+	for range 3 {
+		gid, err := groups.CreateImageGroup(storage.KindImage, "hash", 5, 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, path := range []string{"/a.jpg", "/b.jpg"} {
+			if _, err := groups.CreateImage(gid, storage.ScanFile{Path: path, Size: 5}); err != nil {
+				t.Fatal(err)
+			}
+		}
+		want = append(want, gid)
+	}
+
+	h := New(groups, nil, nil, nil, &operation.Lock{})
+	list := func(query string, code int) storage.GroupPage {
+		t.Helper()
+
+		w := httptest.NewRecorder()
+		h.ListImageGroups(w, httptest.NewRequest("GET", "/api/groups?"+query, nil))
+		if w.Code != code {
+			t.Fatalf("GET /api/groups?%s = %d %q, want %d", query, w.Code, w.Body.String(), code)
+		}
+		var page storage.GroupPage
+		if code == http.StatusOK {
+			if err := json.NewDecoder(w.Body).Decode(&page); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return page
+	}
+
+	var got []int
+	page := list("sort=size&limit=1", http.StatusOK)
+	first := page.NextCursor
+	for {
+		got = append(got, page.Groups[0].ID)
+		if page.NextCursor == "" {
+			break
+		}
+		page = list("sort=size&limit=1&cursor="+page.NextCursor, http.StatusOK)
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("pages = %v, want %v", got, want)
+	}
+
+	list("sort=count&limit=1&cursor="+first, http.StatusBadRequest)
+	list("limit=1&cursor="+first, http.StatusBadRequest)
+}
@@ -0,0 +1,109 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"strconv"
+
+	"github.com/fadykuzman/schluckauf/internal/scan"
+	"github.com/fadykuzman/schluckauf/internal/storage"
+)
+
+// defaultScanHistorySize is the number of jobs listed without a limit.
+const defaultScanHistorySize = 50
+
+func (h *Handler) ListScanJobs(w http.ResponseWriter, r *http.Request) {
+	limit := defaultScanHistorySize
+	if v := r.URL.Query().Get("limit"); v != "" {
+		var err error
+		limit, err = strconv.Atoi(v)
+		if err != nil || limit < 1 {
+			http.Error(w, "Invalid limit", http.StatusBadRequest)
+			return
+		}
+	}
+
+	jobs, err := h.store.ListScanJobs(limit)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(jobs)
+}
+
+func (h *Handler) DownloadScanArtifact(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Invalid Job ID", http.StatusBadRequest)
+		return
+	}
+
+	job, err := h.scans.Artifact(id)
+	switch {
+	case errors.Is(err, storage.ErrNotFound):
+		http.Error(w, "Scan job not found", http.StatusNotFound)
+		return
+	case errors.Is(err, scan.ErrNoArtifact):
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filepath.Base(job.Artifact)))
+	http.ServeFile(w, r, job.Artifact)
+}
+
+type ReimportRequest struct {
+	Merge bool `json:"merge"`
+}
+
+func (h *Handler) ReimportScan(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Invalid Job ID", http.StatusBadRequest)
+		return
+	}
+
+	var req ReimportRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, fmt.Sprintf("Invalid request body (%v)", err), http.StatusBadRequest)
+			return
+		}
+	}
+
+	job, validation, err := h.scans.Reimport(id, req.Merge, client(r))
+	if writeBusy(w, err) {
+		return
+	}
+	switch {
+	case errors.Is(err, storage.ErrNotFound):
+		http.Error(w, "Scan job not found", http.StatusNotFound)
+		return
+	case errors.Is(err, scan.ErrNoArtifact):
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	case errors.Is(err, scan.ErrInvalidImport):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	case errors.Is(err, scan.ErrQueueFull):
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Location", "/api/scan/jobs/"+strconv.Itoa(job.ID))
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(ImportResponse{Job: job, Validation: validation})
+}
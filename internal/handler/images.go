@@ -2,13 +2,14 @@ package handler
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"os"
 	"path/filepath"
 	"strconv"
-	"strings"
 
+	"github.com/fadykuzman/schluckauf/internal/library"
 	"github.com/fadykuzman/schluckauf/internal/storage"
 )
 
@@ -19,35 +20,74 @@ func (h *Handler) ServeImage(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	cleanPath := filepath.Clean(requestedPath)
-	absPath, err := filepath.Abs(cleanPath)
+	absPath, err := h.library.Resolve(requestedPath)
+	if errors.Is(err, library.ErrOutsideRoots) {
+		http.Error(w, "Access denied", http.StatusForbidden)
+		return
+	}
 	if err != nil {
-		http.Error(w, "Invalid path", http.StatusBadRequest)
+		http.Error(w, "File not Found", http.StatusNotFound)
 		return
 	}
 
-	baseDir := os.Getenv("PHOTOS_DIR")
-	if baseDir == "" {
-		baseDir = "./test"
+	info, err := os.Stat(absPath)
+	if err != nil || info.IsDir() {
+		http.Error(w, "File not Found", http.StatusNotFound)
+		return
 	}
-	absBase, err := filepath.Abs(baseDir)
+
+	http.ServeFile(w, r, absPath)
+}
+
+// ServeFileContent serves the content of a file of a group by its ID, if it
+// still exists within the library roots. Its ETag and Last-Modified headers
+// are derived from the size and modification time, so that unchanged files
+// are not sent again.
+func (h *Handler) ServeFileContent(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PathValue("id"))
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Server configuration error (%v)", err), http.StatusInternalServerError)
+		http.Error(w, "Invalid File ID", http.StatusBadRequest)
 		return
 	}
 
-	if !strings.HasPrefix(absPath, absBase) {
+	path, err := h.groups.GetImagePath(id)
+	if errors.Is(err, storage.ErrNotFound) {
+		http.Error(w, "File not Found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	realPath, err := h.library.Resolve(path)
+	if errors.Is(err, library.ErrOutsideRoots) {
 		http.Error(w, "Access denied", http.StatusForbidden)
 		return
 	}
+	if err != nil {
+		http.Error(w, "File not Found", http.StatusNotFound)
+		return
+	}
 
-	info, err := os.Stat(absPath)
-	if err != nil || info.IsDir() {
+	file, err := os.Open(realPath)
+	if err != nil {
 		http.Error(w, "File not Found", http.StatusNotFound)
 		return
 	}
+	defer file.Close()
 
-	http.ServeFile(w, r, absPath)
+	info, err := file.Stat()
+	if err != nil || !info.Mode().IsRegular() {
+		http.Error(w, "File not Found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("ETag", fmt.Sprintf(`"%x-%x"`, info.Size(), info.ModTime().UnixNano()))
+	w.Header().Set("Cache-Control", "no-cache")
+	// the content type is taken from the extension of the file, or sniffed
+	// from its content
+	http.ServeContent(w, r, filepath.Base(realPath), info.ModTime(), file)
 }
 
 type UpdateImageActionRequest struct {
@@ -81,7 +121,12 @@ func (h *Handler) UpdateImageAction(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := h.store.UpdateImageAction(groupID, fileID, req.Action); err != nil {
+	err = h.groups.UpdateImageAction(groupID, fileID, req.Action)
+	if errors.Is(err, storage.ErrNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
@@ -91,7 +136,13 @@ func (h *Handler) UpdateImageAction(w http.ResponseWriter, r *http.Request) {
 }
 
 func (h *Handler) TrashImages(w http.ResponseWriter, r *http.Request) {
-	response, err := h.store.TrashImages()
+	held, ok := h.startTrash(w, r)
+	if !ok {
+		return
+	}
+	defer held.Release()
+
+	response, err := h.groups.TrashImages()
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
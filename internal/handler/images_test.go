@@ -0,0 +1,126 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/fadykuzman/schluckauf/internal/library"
+	"github.com/fadykuzman/schluckauf/internal/operation"
+	"github.com/fadykuzman/schluckauf/internal/storage"
+)
+
+// TestServeFileContent checks the conditional requests answered from the
+// ETag and Last-Modified headers of a file, and that a trashed file isn't
+// served by its ID, even once its path exists again.
+func TestServeFileContent(t *testing.T) {
+	t.Setenv("TRASH_DIR", t.TempDir())
+
+	root := t.TempDir()
+	lib, err := library.New([]library.Root{{Name: "photos", Path: root}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	root = lib.Roots()[0].Path
+
+	keep := filepath.Join(root, "a.jpg")
+	trash := filepath.Join(root, "b.jpg")
+	for _, path := range []string{keep, trash} {
+		if err := os.WriteFile(path, []byte("image"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	store, err := storage.New(filepath.Join(t.TempDir(), "db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	store.SetLibrary(lib)
+
+	_, err = store.ReplaceImageGroups(storage.KindImage, func(yield func(storage.ScanGroup, error) bool) {
+		yield(storage.ScanGroup{Hash: "hash", Size: 5, Files: []storage.ScanFile{
+			{Path: keep, Size: 5, ModifiedDate: 1},
+			{Path: trash, Size: 5, ModifiedDate: 1},
+		}}, nil)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	page, err := store.ListImageGroups(storage.GroupFilter{Kind: storage.KindImage})
+	if err != nil {
+		t.Fatal(err)
+	}
+	images, err := store.GetGroupImages(page.Groups[0].ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ids := make(map[string]int)
+	for _, img := range images {
+		ids[img.Path] = img.ID
+	}
+
+	h := New(store, store, nil, lib, &operation.Lock{})
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/files/{id}/content", h.ServeFileContent)
+	mux.HandleFunc("POST /api/files/actions/trash", h.TrashImages)
+
+	get := func(id int, header, value string, want int) *httptest.ResponseRecorder {
+		t.Helper()
+
+		r := httptest.NewRequest("GET", "/api/files/"+strconv.Itoa(id)+"/content", nil)
+		if header != "" {
+			r.Header.Set(header, value)
+		}
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, r)
+		if w.Code != want {
+			t.Fatalf("GET file %d with %s %q = %d %q, want %d", id, header, value, w.Code, w.Body.String(), want)
+		}
+		return w
+	}
+
+	w := get(ids[keep], "", "", http.StatusOK)
+	etag, lastModified := w.Header().Get("ETag"), w.Header().Get("Last-Modified")
+	if etag == "" || lastModified == "" || w.Body.String() != "image" {
+		t.Fatalf("file served with ETag %q, Last-Modified %q and content %q", etag, lastModified, w.Body.String())
+	}
+
+	if w := get(ids[keep], "If-None-Match", etag, http.StatusNotModified); w.Body.Len() != 0 {
+		t.Errorf("not modified response has content %q", w.Body.String())
+	}
+	get(ids[keep], "If-None-Match", `"other"`, http.StatusOK)
+	get(ids[keep], "If-Modified-Since", lastModified, http.StatusNotModified)
+
+	// a changed file has a new ETag and is sent again
+	if err := os.WriteFile(keep, []byte("edited image"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	later := time.Now().Add(time.Hour)
+	if err := os.Chtimes(keep, later, later); err != nil {
+		t.Fatal(err)
+	}
+	w = get(ids[keep], "If-None-Match", etag, http.StatusOK)
+	if w.Header().Get("ETag") == etag || w.Body.String() != "edited image" {
+		t.Errorf("changed file served with ETag %q and content %q", w.Header().Get("ETag"), w.Body.String())
+	}
+	get(ids[keep], "If-Modified-Since", lastModified, http.StatusOK)
+
+	if err := store.UpdateImageAction(page.Groups[0].ID, ids[trash], storage.ActionTrash); err != nil {
+		t.Fatal(err)
+	}
+	w = httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest("POST", "/api/files/actions/trash", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("trash run = %d %q", w.Code, w.Body.String())
+	}
+	if err := os.WriteFile(trash, []byte("new image"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	get(ids[trash], "", "", http.StatusNotFound)
+	get(999, "", "", http.StatusNotFound)
+}
@@ -0,0 +1,102 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/fadykuzman/schluckauf/internal/loader"
+	"github.com/fadykuzman/schluckauf/internal/scan"
+	"github.com/fadykuzman/schluckauf/internal/storage"
+)
+
+// maxImportSize limits the size of uploaded czkawka outputs.
+const maxImportSize = 512 << 20
+
+type ImportResponse struct {
+	Job        storage.ScanJob   `json:"job"`
+	Validation loader.Validation `json:"validation"`
+}
+
+// ImportResults loads a czkawka JSON output produced elsewhere, sent either
+// as the raw request body or as the "file" field of a multipart form. The
+// kind, directory and merge settings are read from the query string or the
+// form. The output is validated as it is read, without holding it in memory.
+func (h *Handler) ImportResults(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxImportSize)
+
+	// a raw body is read as the output, not parsed as a form
+	var body io.Reader = r.Body
+	formValue := r.URL.Query().Get
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+		file, _, err := r.FormFile("file")
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Missing file in form (%v)", err), http.StatusBadRequest)
+			return
+		}
+		defer file.Close()
+		body = file
+		formValue = r.FormValue
+	}
+
+	kind := storage.Kind(formValue("kind"))
+	if kind != "" && !kind.Valid() {
+		http.Error(w, fmt.Sprintf("Unsupported kind %q", kind), http.StatusBadRequest)
+		return
+	}
+
+	merge := false
+	if v := formValue("merge"); v != "" {
+		var err error
+		merge, err = strconv.ParseBool(v)
+		if err != nil {
+			http.Error(w, "Invalid merge value", http.StatusBadRequest)
+			return
+		}
+	}
+
+	directory := formValue("directory")
+	if merge && directory == "" {
+		http.Error(w, "Merging an import needs the directory that was scanned", http.StatusBadRequest)
+		return
+	}
+	if directory != "" {
+		var ok bool
+		if directory, ok = h.checkDirectory(w, directory); !ok {
+			return
+		}
+		if info, err := os.Stat(directory); err != nil || !info.IsDir() {
+			http.Error(w, "Directory does not exist", http.StatusBadRequest)
+			return
+		}
+	}
+
+	job, validation, err := h.scans.Import(kind, directory, body, merge, client(r))
+	if writeBusy(w, err) {
+		return
+	}
+	if errors.Is(err, scan.ErrInvalidImport) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]any{"error": err.Error(), "validation": validation})
+		return
+	}
+	if errors.Is(err, scan.ErrQueueFull) {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Location", "/api/scan/jobs/"+strconv.Itoa(job.ID))
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(ImportResponse{Job: job, Validation: validation})
+}
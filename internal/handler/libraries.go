@@ -0,0 +1,13 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// ListLibraries returns the library roots that scans, served files and
+// trashed files are restricted to.
+func (h *Handler) ListLibraries(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(h.library.Roots())
+}
@@ -0,0 +1,60 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+
+	"github.com/fadykuzman/schluckauf/internal/operation"
+)
+
+type OperationStatus struct {
+	Running   bool                 `json:"running"`
+	Operation *operation.Operation `json:"operation,omitempty"`
+}
+
+// GetOperation returns the scan, import or trash run in progress, if any.
+func (h *Handler) GetOperation(w http.ResponseWriter, r *http.Request) {
+	var status OperationStatus
+	if op, ok := h.lock.Running(); ok {
+		status = OperationStatus{Running: true, Operation: &op}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(status)
+}
+
+// startTrash acquires the operation lock for a trash run, writing a
+// Conflict response if another operation is in progress.
+func (h *Handler) startTrash(w http.ResponseWriter, r *http.Request) (*operation.Held, bool) {
+	held, err := h.lock.Acquire(operation.Operation{Kind: operation.Trash, StartedBy: client(r)})
+	if err != nil {
+		writeBusy(w, err)
+		return nil, false
+	}
+	return held, true
+}
+
+// writeBusy writes a Conflict response with the operation in progress if
+// err says that another operation is in progress.
+func writeBusy(w http.ResponseWriter, err error) bool {
+	var busy *operation.BusyError
+	if !errors.As(err, &busy) {
+		return false
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusConflict)
+	json.NewEncoder(w).Encode(map[string]any{"error": err.Error(), "operation": busy.Running})
+	return true
+}
+
+// client names who sent r, by address.
+func client(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
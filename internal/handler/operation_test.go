@@ -0,0 +1,106 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/fadykuzman/schluckauf/internal/library"
+	"github.com/fadykuzman/schluckauf/internal/operation"
+	"github.com/fadykuzman/schluckauf/internal/scan"
+	"github.com/fadykuzman/schluckauf/internal/storage"
+)
+
+// TestOperationConflicts checks that scans, imports and trash runs are
+// refused while another operation holds the lock.
+func TestOperationConflicts(t *testing.T) {
+	root := t.TempDir()
+	lib, err := library.New([]library.Root{{Name: "photos", Path: root}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	root = lib.Roots()[0].Path
+
+	store, err := storage.New(filepath.Join(t.TempDir(), "db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	store.SetLibrary(lib)
+
+	lock := &operation.Lock{}
+	scans, err := scan.NewManager(store, t.TempDir(), scan.Retention{}, scan.ScannerNative, lock)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	h := New(store, store, scans, lib, lock)
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/operation", h.GetOperation)
+	mux.HandleFunc("POST /api/scan", h.ScanDirectory)
+	mux.HandleFunc("POST /api/import", h.ImportResults)
+	mux.HandleFunc("POST /api/files/actions/trash", h.TrashImages)
+	mux.HandleFunc("POST /api/findings/{kind}/actions/trash", h.TrashFindings)
+
+	do := func(method, target, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, httptest.NewRequest(method, target, strings.NewReader(body)))
+		return w
+	}
+	status := func() OperationStatus {
+		t.Helper()
+
+		var status OperationStatus
+		if err := json.NewDecoder(do("GET", "/api/operation", "").Body).Decode(&status); err != nil {
+			t.Fatal(err)
+		}
+		return status
+	}
+
+	if s := status(); s.Running {
+		t.Errorf("operation = %+v, want none", s)
+	}
+
+	held, err := lock.Acquire(operation.Operation{Kind: operation.Trash, StartedBy: "192.0.2.1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if s := status(); !s.Running || s.Operation.Kind != operation.Trash || s.Operation.StartedBy != "192.0.2.1" {
+		t.Errorf("operation = %+v, want the trash run", s)
+	}
+
+	for _, req := range []struct{ method, target, body string }{
+		{"POST", "/api/scan", `{"kind": "file", "directory": "` + root + `"}`},
+		{"POST", "/api/import", `{"5": [[{"path": "/a"}, {"path": "/b"}]]}`},
+		{"POST", "/api/files/actions/trash", ""},
+		{"POST", "/api/findings/temp/actions/trash", `{"ids": [1]}`},
+	} {
+		w := do(req.method, req.target, req.body)
+		if w.Code != http.StatusConflict {
+			t.Errorf("%s %s = %d %q, want %d", req.method, req.target, w.Code, w.Body.String(), http.StatusConflict)
+			continue
+		}
+		var body struct {
+			Error     string              `json:"error"`
+			Operation operation.Operation `json:"operation"`
+		}
+		if err := json.NewDecoder(w.Body).Decode(&body); err != nil {
+			t.Fatal(err)
+		}
+		if body.Operation.Kind != operation.Trash || !strings.Contains(body.Error, "trash in progress") {
+			t.Errorf("%s %s conflict = %+v, want the trash run", req.method, req.target, body)
+		}
+	}
+
+	held.Release()
+	if s := status(); s.Running {
+		t.Errorf("operation = %+v after release, want none", s)
+	}
+	if w := do("POST", "/api/files/actions/trash", ""); w.Code != http.StatusOK {
+		t.Errorf("trash run after release = %d %q, want %d", w.Code, w.Body.String(), http.StatusOK)
+	}
+}
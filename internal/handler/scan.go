@@ -2,129 +2,167 @@ package handler
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
 	"net/http"
 	"os"
-	"os/exec"
+	"strconv"
 
-	"github.com/fadykuzman/schluckauf/internal/loader"
+	"github.com/fadykuzman/schluckauf/internal/library"
+	"github.com/fadykuzman/schluckauf/internal/scan"
+	"github.com/fadykuzman/schluckauf/internal/storage"
 )
 
 type ScanRequest struct {
-	Directory string `json:"directory"`
-}
-
-type ScanResponse struct {
-	Success    bool   `json:"success"`
-	GroupCount int    `json:"groupCount"`
-	Message    string `json:"message"`
+	Kind      storage.Kind `json:"kind"`
+	Directory string       `json:"directory"`
+	Options   scan.Options `json:"options"`
+	Merge     bool         `json:"merge"`
 }
 
 func (h *Handler) ScanDirectory(w http.ResponseWriter, r *http.Request) {
 	// parse the request body
 	var req ScanRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&req); err != nil {
+		http.Error(w, fmt.Sprintf("Invalid request body (%v)", err), http.StatusBadRequest)
 		return
 	}
 
-	// validate the directory path
-	info, err := os.Stat(req.Directory)
-	if err != nil {
-		http.Error(w, "Directory does not exist", http.StatusBadRequest)
+	if req.Kind == "" {
+		req.Kind = storage.KindImage
+	}
+	directory, ok := h.checkScan(w, req.Kind, req.Directory, req.Options)
+	if !ok {
 		return
 	}
 
-	if !info.IsDir() {
-		http.Error(w, "Path is not a directory", http.StatusBadRequest)
+	// check that a scanner is installed and supports the scan
+	if err := h.scans.CheckScanner(req.Kind, req.Options); errors.Is(err, scan.ErrNoScanner) {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	// check if czkawka_cli is installed
-	if _, err := exec.LookPath("czkawka_cli"); err != nil {
-		http.Error(w, "Czkawka CLI is not installed. Install with: cargo install czkawka_cli", http.StatusInternalServerError)
+	job, err := h.scans.Submit(req.Kind, directory, req.Options, req.Merge, client(r))
+	if writeBusy(w, err) {
 		return
 	}
-
-	scansDir := os.Getenv("SCANS_DIR")
-	if scansDir == "" {
-		scansDir = "./scans"
+	if errors.Is(err, scan.ErrQueueFull) {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
 	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Location", "/api/scan/jobs/"+strconv.Itoa(job.ID))
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(job)
+}
 
-	os.MkdirAll(scansDir, 0o770)
+func (h *Handler) GetScanJob(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Invalid Job ID", http.StatusBadRequest)
+		return
+	}
 
-	tempFile, err := os.CreateTemp(scansDir, "czkawka-scan-*.json")
+	job, err := h.scans.Job(id)
+	if errors.Is(err, storage.ErrNotFound) {
+		http.Error(w, "Scan job not found", http.StatusNotFound)
+		return
+	}
 	if err != nil {
-		http.Error(w, "Failed to create temp file", http.StatusInternalServerError)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	// defer os.Remove(tempFile.Name())
-	tempFile.Close()
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(job)
+}
 
-	// execute the cli command
-	cmd := exec.Command("czkawka_cli", "image", "-d", req.Directory, "-C", tempFile.Name())
+func (h *Handler) CancelScanJob(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Invalid Job ID", http.StatusBadRequest)
+		return
+	}
 
-	output, err := cmd.CombinedOutput()
-	groups, parseErr := loader.ParseImageDuplicates(tempFile.Name())
-	if parseErr != nil {
-		http.Error(w, fmt.Sprintf("Scan failed: %s (parse error: %v)", string(output), parseErr), http.StatusInternalServerError)
+	err = h.scans.Cancel(id)
+	switch {
+	case errors.Is(err, storage.ErrNotFound):
+		http.Error(w, "Scan job not found", http.StatusNotFound)
+		return
+	case errors.Is(err, scan.ErrFinished):
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
+	job, err := h.scans.Job(id)
 	if err != nil {
-		log.Printf("warning: czkawka exited with error (%v) but produced valid output", err)
-	}
-
-	// parse the JSON results
-	if len(groups) == 0 {
-		resp := ScanResponse{
-			Success:    true,
-			GroupCount: 0,
-			Message:    "No Duplicates found",
-		}
-		w.WriteHeader(http.StatusOK)
-		json.NewEncoder(w).Encode(resp)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	// Clear pending data
-	if err := h.store.DeleteAllImages(); err != nil {
-		http.Error(
-			w,
-			fmt.Sprintf("error clearing previous scan data: %v", err),
-			http.StatusInternalServerError)
-		return
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(job)
+}
+
+// checkScan validates a scan of kind for directory with options, returning
+// the real path of directory to scan. It writes a Bad Request response if
+// the scan is invalid, or a Forbidden one if directory is not within the
+// library roots.
+func (h *Handler) checkScan(w http.ResponseWriter, kind storage.Kind, directory string, options scan.Options) (string, bool) {
+	if !kind.Valid() {
+		http.Error(w, fmt.Sprintf("Unsupported scan kind %q", kind), http.StatusBadRequest)
+		return "", false
 	}
 
-	// Load new scan results into database
-	for _, group := range groups {
-		gid, err := h.store.CreateImageGroup(
-			group.Hash,
-			group.Size,
-			group.ImageCount)
-		if err != nil {
-			http.Error(w, fmt.Sprintf("Failed to create group with hash: %d", group.Hash), http.StatusInternalServerError)
-			return
-		}
+	// validate the directory path
+	directory, ok := h.checkDirectory(w, directory)
+	if !ok {
+		return "", false
+	}
+	info, err := os.Stat(directory)
+	if err != nil {
+		http.Error(w, "Directory does not exist", http.StatusBadRequest)
+		return "", false
+	}
 
-		for _, file := range group.Images {
-			_, err := h.store.CreateImage(gid, file.Path, group.Size)
-			if err != nil {
-				http.Error(w, fmt.Sprintf("Failed to create image with gid %d and path %s: \n error (%v)", gid, file.Path, err), http.StatusInternalServerError)
-				return
-			}
-		}
+	if !info.IsDir() {
+		http.Error(w, "Path is not a directory", http.StatusBadRequest)
+		return "", false
 	}
 
-	// Return success response
-	resp := ScanResponse{
-		Success:    true,
-		GroupCount: len(groups),
-		Message:    "Scan successfully done",
+	if err := options.Validate(kind, directory); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return "", false
 	}
+	return directory, true
+}
 
-	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(resp)
+// checkDirectory returns the real path of directory. It writes a Bad
+// Request response if directory does not exist, or a Forbidden one if its
+// real path is not within the library roots.
+func (h *Handler) checkDirectory(w http.ResponseWriter, directory string) (string, bool) {
+	real, err := h.library.Resolve(directory)
+	if errors.Is(err, library.ErrOutsideRoots) {
+		http.Error(w, "Directory is outside the library roots", http.StatusForbidden)
+		return "", false
+	}
+	if err != nil {
+		http.Error(w, "Directory does not exist", http.StatusBadRequest)
+		return "", false
+	}
+	return real, true
 }
@@ -0,0 +1,56 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/fadykuzman/schluckauf/internal/library"
+	"github.com/fadykuzman/schluckauf/internal/operation"
+	"github.com/fadykuzman/schluckauf/internal/scan"
+	"github.com/fadykuzman/schluckauf/internal/storage"
+)
+
+// TestCheckScanResolvesSymlinks checks that scans run on the real path of
+// a directory, so that a symlink can't be pointed elsewhere after the check.
+func TestCheckScanResolvesSymlinks(t *testing.T) {
+	root := t.TempDir()
+	lib, err := library.New([]library.Root{{Name: "photos", Path: root}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	root = lib.Roots()[0].Path
+
+	albums := filepath.Join(root, "albums")
+	if err := os.Mkdir(albums, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(albums, filepath.Join(root, "link")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(t.TempDir(), filepath.Join(root, "outside")); err != nil {
+		t.Fatal(err)
+	}
+
+	h := New(storage.NewMemory(), nil, nil, lib, &operation.Lock{})
+	tests := []struct {
+		directory string
+		want      string
+		code      int
+	}{
+		{albums, albums, http.StatusOK},
+		{filepath.Join(root, "link"), albums, http.StatusOK},
+		{filepath.Join(root, "link", "..", "albums"), albums, http.StatusOK},
+		{filepath.Join(root, "outside"), "", http.StatusForbidden},
+		{filepath.Join(root, "missing"), "", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		got, ok := h.checkScan(w, storage.KindImage, tt.directory, scan.Options{})
+		if got != tt.want || ok != (tt.code == http.StatusOK) || w.Code != tt.code {
+			t.Errorf("checkScan(%q) = %q, %v with %d, want %q with %d", tt.directory, got, ok, w.Code, tt.want, tt.code)
+		}
+	}
+}
@@ -0,0 +1,218 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/fadykuzman/schluckauf/internal/scan"
+	"github.com/fadykuzman/schluckauf/internal/schedule"
+	"github.com/fadykuzman/schluckauf/internal/storage"
+)
+
+// defaultScheduleRunsSize is the number of runs listed without a limit.
+const defaultScheduleRunsSize = 50
+
+// ScheduleRequest defines a scan run periodically. Cron is a five field
+// cron expression or a macro like @daily, evaluated in the server's local
+// time. Schedules are enabled unless Enabled is false.
+type ScheduleRequest struct {
+	Name      string       `json:"name"`
+	Kind      storage.Kind `json:"kind"`
+	Directory string       `json:"directory"`
+	Options   scan.Options `json:"options"`
+	Merge     bool         `json:"merge"`
+	Cron      string       `json:"cron"`
+	Enabled   *bool        `json:"enabled"`
+}
+
+func (h *Handler) ListSchedules(w http.ResponseWriter, r *http.Request) {
+	schedules, err := h.store.ListSchedules()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(schedules)
+}
+
+func (h *Handler) GetSchedule(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Invalid Schedule ID", http.StatusBadRequest)
+		return
+	}
+
+	s, err := h.store.GetSchedule(id)
+	if errors.Is(err, storage.ErrNotFound) {
+		http.Error(w, "Schedule not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s)
+}
+
+func (h *Handler) CreateSchedule(w http.ResponseWriter, r *http.Request) {
+	s, ok := h.decodeSchedule(w, r)
+	if !ok {
+		return
+	}
+
+	id, err := h.store.CreateSchedule(s)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	s, err = h.store.GetSchedule(id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Location", "/api/schedules/"+strconv.Itoa(id))
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(s)
+}
+
+func (h *Handler) UpdateSchedule(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Invalid Schedule ID", http.StatusBadRequest)
+		return
+	}
+
+	s, ok := h.decodeSchedule(w, r)
+	if !ok {
+		return
+	}
+	s.ID = id
+
+	err = h.store.UpdateSchedule(s)
+	if errors.Is(err, storage.ErrNotFound) {
+		http.Error(w, "Schedule not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	s, err = h.store.GetSchedule(id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s)
+}
+
+func (h *Handler) DeleteSchedule(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Invalid Schedule ID", http.StatusBadRequest)
+		return
+	}
+
+	err = h.store.DeleteSchedule(id)
+	if errors.Is(err, storage.ErrNotFound) {
+		http.Error(w, "Schedule not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) ListScheduleRuns(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Invalid Schedule ID", http.StatusBadRequest)
+		return
+	}
+
+	limit := defaultScheduleRunsSize
+	if v := r.URL.Query().Get("limit"); v != "" {
+		limit, err = strconv.Atoi(v)
+		if err != nil || limit < 1 {
+			http.Error(w, "Invalid limit", http.StatusBadRequest)
+			return
+		}
+	}
+
+	if _, err := h.store.GetSchedule(id); errors.Is(err, storage.ErrNotFound) {
+		http.Error(w, "Schedule not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	runs, err := h.store.ListScheduleRuns(id, limit)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(runs)
+}
+
+// decodeSchedule reads and validates a ScheduleRequest, writing a Bad
+// Request response if it is invalid.
+func (h *Handler) decodeSchedule(w http.ResponseWriter, r *http.Request) (storage.Schedule, bool) {
+	var req ScheduleRequest
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&req); err != nil {
+		http.Error(w, fmt.Sprintf("Invalid request body (%v)", err), http.StatusBadRequest)
+		return storage.Schedule{}, false
+	}
+
+	if req.Kind == "" {
+		req.Kind = storage.KindImage
+	}
+	directory, ok := h.checkScan(w, req.Kind, req.Directory, req.Options)
+	if !ok {
+		return storage.Schedule{}, false
+	}
+
+	if _, err := schedule.ParseCron(req.Cron); err != nil {
+		http.Error(w, fmt.Sprintf("Invalid cron expression (%v)", err), http.StatusBadRequest)
+		return storage.Schedule{}, false
+	}
+
+	optionsJSON, err := json.Marshal(req.Options)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return storage.Schedule{}, false
+	}
+
+	s := storage.Schedule{
+		Name:      req.Name,
+		Kind:      req.Kind,
+		Directory: directory,
+		Options:   optionsJSON,
+		Merge:     req.Merge,
+		Cron:      req.Cron,
+		Enabled:   req.Enabled == nil || *req.Enabled,
+	}
+	if s.Enabled {
+		s.NextRunAt = schedule.NextRun(req.Cron, time.Now())
+	}
+	return s, true
+}
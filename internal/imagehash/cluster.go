@@ -0,0 +1,109 @@
+package imagehash
+
+// bkTree indexes hashes by their Hamming distance, so that the hashes
+// close to a given one are found without comparing all of them.
+type bkTree struct {
+	root *bkNode
+}
+
+type bkNode struct {
+	hash Hash
+	// items are the indexes of everything inserted with this hash
+	items    []int
+	children map[int]*bkNode
+}
+
+func (t *bkTree) insert(hash Hash, item int) {
+	if t.root == nil {
+		t.root = &bkNode{hash: hash, items: []int{item}}
+		return
+	}
+
+	node := t.root
+	for {
+		d := node.hash.Distance(hash)
+		if d == 0 {
+			node.items = append(node.items, item)
+			return
+		}
+		child, ok := node.children[d]
+		if !ok {
+			if node.children == nil {
+				node.children = make(map[int]*bkNode)
+			}
+			node.children[d] = &bkNode{hash: hash, items: []int{item}}
+			return
+		}
+		node = child
+	}
+}
+
+// within calls fn for the items inserted with a hash at most maxDistance
+// away from hash.
+func (t *bkTree) within(hash Hash, maxDistance int, fn func(item, distance int)) {
+	if t.root == nil {
+		return
+	}
+
+	stack := []*bkNode{t.root}
+	for len(stack) > 0 {
+		node := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+
+		d := node.hash.Distance(hash)
+		if d <= maxDistance {
+			for _, item := range node.items {
+				fn(item, d)
+			}
+		}
+		// by the triangle inequality, only children between d-maxDistance
+		// and d+maxDistance can hold matches
+		for childDistance, child := range node.children {
+			if childDistance >= d-maxDistance && childDistance <= d+maxDistance {
+				stack = append(stack, child)
+			}
+		}
+	}
+}
+
+// Member is an item of a cluster with its distance to the first item.
+type Member struct {
+	Index    int
+	Distance int
+}
+
+// Cluster groups the hashes that are at most maxDistance away from each
+// other, returning the indexes of the hashes in each group of two or more.
+// Hashes are taken as group references in order, so callers put the ones
+// they prefer as reference first. Each hash ends up in at most one group,
+// with the reference first.
+func Cluster(hashes []Hash, maxDistance int) [][]Member {
+	var tree bkTree
+	for i, hash := range hashes {
+		tree.insert(hash, i)
+	}
+
+	grouped := make([]bool, len(hashes))
+	var clusters [][]Member
+	for i, hash := range hashes {
+		if grouped[i] {
+			continue
+		}
+
+		cluster := []Member{{Index: i}}
+		tree.within(hash, maxDistance, func(item, distance int) {
+			if item != i && !grouped[item] {
+				cluster = append(cluster, Member{Index: item, Distance: distance})
+			}
+		})
+		if len(cluster) < 2 {
+			continue
+		}
+
+		for _, member := range cluster {
+			grouped[member.Index] = true
+		}
+		clusters = append(clusters, cluster)
+	}
+	return clusters
+}
@@ -0,0 +1,192 @@
+// Package imagehash computes perceptual hashes of images and clusters similar ones
+package imagehash
+
+import (
+	"fmt"
+	"image"
+	"math"
+	"math/bits"
+	"slices"
+)
+
+// Hash is a 64 bit perceptual hash. Similar images have hashes with a
+// small Hamming distance.
+type Hash uint64
+
+// Algorithm is the way a Hash is computed.
+type Algorithm string
+
+const (
+	// DHash compares the brightness of neighbouring pixels. It is cheap and
+	// robust against scaling and compression.
+	DHash Algorithm = "dhash"
+	// PHash compares the low frequencies of the image to their median. It
+	// is slower than DHash but more robust against small edits.
+	PHash Algorithm = "phash"
+)
+
+// Algorithms lists the supported algorithms.
+var Algorithms = []Algorithm{DHash, PHash}
+
+// Distance returns the number of bits that differ between h and other.
+func (h Hash) Distance(other Hash) int {
+	return bits.OnesCount64(uint64(h ^ other))
+}
+
+// Bytes returns h as 8 bytes, most significant first, the way czkawka
+// outputs hashes.
+func (h Hash) Bytes() []int {
+	b := make([]int, 8)
+	for i := range b {
+		b[i] = int((h >> (56 - 8*i)) & 0xff)
+	}
+	return b
+}
+
+// Compute hashes img with algorithm.
+func Compute(img image.Image, algorithm Algorithm) (Hash, error) {
+	switch algorithm {
+	case DHash:
+		return dHash(img), nil
+	case PHash:
+		return pHash(img), nil
+	}
+	return 0, fmt.Errorf("unsupported hash algorithm %q", algorithm)
+}
+
+// dHash shrinks img to 9x8 and sets a bit for each pixel brighter than its
+// right neighbour.
+func dHash(img image.Image) Hash {
+	const w, h = 9, 8
+	pixels := shrink(img, w, h)
+
+	var hash Hash
+	for y := range h {
+		for x := range w - 1 {
+			hash <<= 1
+			if pixels[y*w+x] > pixels[y*w+x+1] {
+				hash |= 1
+			}
+		}
+	}
+	return hash
+}
+
+// pHash shrinks img to 32x32, takes its discrete cosine transform and sets
+// a bit for each of the 8x8 lowest frequencies above their median. The DC
+// coefficient is the average brightness, which tells nothing about the
+// structure of the image, so it is left out and the top bit is always 0.
+func pHash(img image.Image) Hash {
+	const size, low = 32, 8
+	pixels := shrink(img, size, size)
+
+	ac := dct2D(pixels, size, low)[1:]
+
+	// the median of the 63 coefficients is the middle one
+	sorted := slices.Clone(ac)
+	slices.Sort(sorted)
+	median := sorted[len(sorted)/2]
+
+	var hash Hash
+	for _, c := range ac {
+		hash <<= 1
+		if c > median {
+			hash |= 1
+		}
+	}
+	return hash
+}
+
+// dct2D returns the low x low lowest frequencies of the type II discrete
+// cosine transform of the size x size pixels, row by row.
+func dct2D(pixels []float64, size, low int) []float64 {
+	cosines := make([]float64, low*size)
+	for u := range low {
+		for x := range size {
+			cosines[u*size+x] = math.Cos(float64(2*x+1) * float64(u) * math.Pi / float64(2*size))
+		}
+	}
+
+	// transform the rows, then the columns of the result
+	rows := make([]float64, size*low)
+	for y := range size {
+		for u := range low {
+			var sum float64
+			for x := range size {
+				sum += pixels[y*size+x] * cosines[u*size+x]
+			}
+			rows[y*low+u] = sum
+		}
+	}
+
+	result := make([]float64, low*low)
+	for v := range low {
+		for u := range low {
+			var sum float64
+			for y := range size {
+				sum += rows[y*low+u] * cosines[v*size+y]
+			}
+			result[v*low+u] = sum
+		}
+	}
+	return result
+}
+
+// shrink converts img to grayscale and scales it down to w x h, averaging
+// the pixels that fall into each cell.
+func shrink(img image.Image, w, h int) []float64 {
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+
+	sums := make([]float64, w*h)
+	counts := make([]int, w*h)
+	for y := range height {
+		cy := y * h / height
+		for x := range width {
+			cx := x * w / width
+			sums[cy*w+cx] += luminance(img, bounds.Min.X+x, bounds.Min.Y+y)
+			counts[cy*w+cx]++
+		}
+	}
+
+	// images smaller than the grid leave cells empty, fill them from the
+	// nearest pixel instead
+	for cy := range h {
+		for cx := range w {
+			i := cy*w + cx
+			if counts[i] == 0 && width > 0 && height > 0 {
+				x := bounds.Min.X + cx*width/w
+				y := bounds.Min.Y + cy*height/h
+				sums[i] = luminance(img, x, y)
+				counts[i] = 1
+			}
+			if counts[i] > 0 {
+				sums[i] /= float64(counts[i])
+			}
+		}
+	}
+	return sums
+}
+
+// luminance returns the brightness of the pixel at x, y between 0 and 255,
+// reading the common image types directly since going through At is slow.
+func luminance(img image.Image, x, y int) float64 {
+	switch img := img.(type) {
+	case *image.YCbCr:
+		return float64(img.Y[img.YOffset(x, y)])
+	case *image.Gray:
+		return float64(img.Pix[img.PixOffset(x, y)])
+	case *image.RGBA:
+		i := img.PixOffset(x, y)
+		return gray(uint32(img.Pix[i]), uint32(img.Pix[i+1]), uint32(img.Pix[i+2]))
+	case *image.NRGBA:
+		i := img.PixOffset(x, y)
+		return gray(uint32(img.Pix[i]), uint32(img.Pix[i+1]), uint32(img.Pix[i+2]))
+	}
+	r, g, b, _ := img.At(x, y).RGBA()
+	return gray(r>>8, g>>8, b>>8)
+}
+
+func gray(r, g, b uint32) float64 {
+	return 0.299*float64(r) + 0.587*float64(g) + 0.114*float64(b)
+}
@@ -0,0 +1,144 @@
+// Package library restricts the files the application scans, serves and
+// trashes to a set of configured root directories.
+package library
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ErrOutsideRoots is returned for paths that are not within any root.
+var ErrOutsideRoots = errors.New("path is outside the library roots")
+
+// Root is a named directory of the library. Path is its real path, with
+// symlinks resolved.
+type Root struct {
+	Name string `json:"name"`
+	Path string `json:"path"`
+}
+
+// Library is a set of roots that paths are checked against.
+type Library struct {
+	roots []Root
+}
+
+// Parse reads a comma separated list of roots, each either name=path or a
+// bare path named after its last element, like "photos=/photos,/music".
+// Every root has to be an existing directory and names have to be unique.
+func Parse(spec string) (*Library, error) {
+	var roots []Root
+	for entry := range strings.SplitSeq(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		name, path, ok := strings.Cut(entry, "=")
+		if !ok {
+			path = name
+			name = filepath.Base(filepath.Clean(path))
+		}
+		roots = append(roots, Root{Name: strings.TrimSpace(name), Path: strings.TrimSpace(path)})
+	}
+	return New(roots)
+}
+
+// New resolves the paths of roots into a Library.
+func New(roots []Root) (*Library, error) {
+	if len(roots) == 0 {
+		return nil, fmt.Errorf("no library roots configured")
+	}
+
+	lib := &Library{}
+	seen := make(map[string]bool)
+	for _, root := range roots {
+		if root.Name == "" || root.Path == "" {
+			return nil, fmt.Errorf("library root %q needs a name and a path", root.Name+"="+root.Path)
+		}
+		if seen[root.Name] {
+			return nil, fmt.Errorf("library root %q is configured twice", root.Name)
+		}
+		seen[root.Name] = true
+
+		path, err := realPath(root.Path)
+		if err != nil {
+			return nil, fmt.Errorf("library root %s: %w", root.Name, err)
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, fmt.Errorf("library root %s: %w", root.Name, err)
+		}
+		if !info.IsDir() {
+			return nil, fmt.Errorf("library root %s: %s is not a directory", root.Name, root.Path)
+		}
+		lib.roots = append(lib.roots, Root{Name: root.Name, Path: path})
+	}
+	return lib, nil
+}
+
+// Roots returns the roots of the library.
+func (l *Library) Roots() []Root {
+	return append([]Root(nil), l.roots...)
+}
+
+// Resolve returns the real path of path, following symlinks all the way,
+// if it is within a root. It fails for paths that do not exist.
+func (l *Library) Resolve(path string) (string, error) {
+	real, err := realPath(path)
+	if err != nil {
+		return "", err
+	}
+	return l.check(real)
+}
+
+// ResolveEntry is like Resolve, but only follows the symlinks leading to
+// the directory holding path. A symlink is checked where it is rather than
+// where it points to, for operations on the entry itself, like moving it to
+// the trash.
+func (l *Library) ResolveEntry(path string) (string, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	dir, err := realPath(filepath.Dir(abs))
+	if err != nil {
+		return "", err
+	}
+	if _, err := os.Lstat(abs); err != nil {
+		return "", err
+	}
+	return l.check(filepath.Join(dir, filepath.Base(abs)))
+}
+
+// check returns path if it is one of the roots or below one.
+func (l *Library) check(path string) (string, error) {
+	for _, root := range l.roots {
+		if within(root.Path, path) {
+			return path, nil
+		}
+	}
+	return "", fmt.Errorf("%s: %w", path, ErrOutsideRoots)
+}
+
+// within reports whether path is root or below it. Both are clean absolute
+// paths, so that /photos-private is not within /photos.
+func within(root, path string) bool {
+	if path == root {
+		return true
+	}
+	if !strings.HasSuffix(root, string(filepath.Separator)) {
+		root += string(filepath.Separator)
+	}
+	return strings.HasPrefix(path, root)
+}
+
+func realPath(path string) (string, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	return filepath.EvalSymlinks(abs)
+}
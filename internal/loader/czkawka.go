@@ -2,10 +2,8 @@
 package loader
 
 import (
-	"crypto/sha256"
-	"encoding/json"
-	"fmt"
-	"os"
+	"slices"
+	"strings"
 )
 
 type CzkawkaFileOutput map[string][][]FileInfo
@@ -44,85 +42,146 @@ type DuplicateImageGroup struct {
 }
 
 func ParseFileDuplicates(filepath string) ([]DuplicateFileGroup, error) {
-	data, err := os.ReadFile(filepath)
-	if err != nil {
-		return nil, err
-	}
+	return parseStream(filepath, StreamFileDuplicates)
+}
 
-	var czkawka CzkawkaFileOutput
+func ParseImageDuplicates(filepath string) ([]DuplicateImageGroup, error) {
+	return parseStream(filepath, StreamImageDuplicates)
+}
 
-	if err := json.Unmarshal(data, &czkawka); err != nil {
-		return nil, err
-	}
+type CzkawkaVideoOutput [][]VideoInfo
 
-	var groups []DuplicateFileGroup
+type VideoInfo struct {
+	Path         string `json:"path"`
+	ModifiedDate int64  `json:"modified_date"`
+	Size         int64  `json:"size"`
+	Error        string `json:"error"`
+}
 
-	for sizeKey, dupGroups := range czkawka {
-		for _, fileGroup := range dupGroups {
-			if len(fileGroup) < 2 {
-				continue
-			}
+type DuplicateVideoGroup struct {
+	Hash      string
+	Size      int64
+	FileCount int
+	Files     []VideoInfo
+}
 
-			firstFile := fileGroup[0]
+func ParseVideoDuplicates(filepath string) ([]DuplicateVideoGroup, error) {
+	return parseStream(filepath, StreamVideoDuplicates)
+}
 
-			groupHash := firstFile.Hash
+type CzkawkaMusicOutput [][]MusicInfo
 
-			if groupHash == "" {
-				h := sha256.New()
-				h.Write([]byte(sizeKey))
-				for _, f := range fileGroup {
-					h.Write([]byte(f.Path))
-				}
-				groupHash = fmt.Sprintf("%x", h.Sum(nil))
-			}
+type MusicInfo struct {
+	Path         string `json:"path"`
+	ModifiedDate int64  `json:"modified_date"`
+	Size         int64  `json:"size"`
+	TrackTitle   string `json:"track_title"`
+	TrackArtist  string `json:"track_artist"`
+	Album        string `json:"album"`
+	Year         string `json:"year"`
+	Length       string `json:"length"`
+	Genre        string `json:"genre"`
+	Bitrate      int    `json:"bitrate"`
+}
 
-			groups = append(groups, DuplicateFileGroup{
-				Hash:      groupHash,
-				Size:      firstFile.Size,
-				FileCount: len(fileGroup),
-				Files:     fileGroup,
-			})
+type DuplicateMusicGroup struct {
+	Hash      string
+	Size      int64
+	FileCount int
+	Files     []MusicInfo
+}
 
-		}
-	}
-	return groups, nil
+func ParseMusicDuplicates(filepath string) ([]DuplicateMusicGroup, error) {
+	return parseStream(filepath, StreamMusicDuplicates)
 }
 
-func ParseImageDuplicates(filepath string) ([]DuplicateImageGroup, error) {
-	data, err := os.ReadFile(filepath)
-	if err != nil {
-		return nil, err
-	}
+type CzkawkaBrokenOutput []BrokenFile
 
-	var czkawka CzkawkaImageOutput
+type BrokenFile struct {
+	Path         string `json:"path"`
+	ModifiedDate int64  `json:"modified_date"`
+	Size         int64  `json:"size"`
+	TypeOfFile   string `json:"type_of_file"`
+	ErrorString  string `json:"error_string"`
+}
+
+func ParseBrokenFiles(filepath string) ([]BrokenFile, error) {
+	return parseStream(filepath, StreamBrokenFiles)
+}
+
+// FileEntry is a single file reported by the czkawka modes that list files
+// instead of grouping them, like big, empty-files and temp.
+type FileEntry struct {
+	Path         string `json:"path"`
+	ModifiedDate int64  `json:"modified_date"`
+	Size         int64  `json:"size"`
+}
+
+func ParseBigFiles(filepath string) ([]FileEntry, error) {
+	return parseFileEntries(filepath)
+}
+
+func ParseEmptyFiles(filepath string) ([]FileEntry, error) {
+	return parseFileEntries(filepath)
+}
+
+func ParseTemporaryFiles(filepath string) ([]FileEntry, error) {
+	return parseFileEntries(filepath)
+}
+
+func parseFileEntries(filepath string) ([]FileEntry, error) {
+	return parseStream(filepath, StreamFileEntries)
+}
+
+type FolderEntry struct {
+	Path         string `json:"path"`
+	ModifiedDate int64  `json:"modified_date"`
+}
 
-	if err := json.Unmarshal(data, &czkawka); err != nil {
+// ParseEmptyFolders reads the output of czkawka empty-folders. Depending on
+// the czkawka version that is either a list of paths or a map from path to
+// folder entry.
+func ParseEmptyFolders(filepath string) ([]FolderEntry, error) {
+	folders, err := parseStream(filepath, StreamEmptyFolders)
+	if err != nil {
 		return nil, err
 	}
 
-	var groups []DuplicateImageGroup
+	slices.SortFunc(folders, func(a, b FolderEntry) int {
+		return strings.Compare(a.Path, b.Path)
+	})
+	return folders, nil
+}
 
-	for _, dupGroup := range czkawka {
-		if len(dupGroup) < 2 {
-			continue
-		}
+type CzkawkaSymlinksOutput []SymlinkEntry
 
-		firstFile := dupGroup[0]
+type SymlinkEntry struct {
+	Path         string      `json:"path"`
+	ModifiedDate int64       `json:"modified_date"`
+	Size         int64       `json:"size"`
+	SymlinkInfo  SymlinkInfo `json:"symlink_info"`
+}
 
-		groupHash := firstFile.Hash
+type SymlinkInfo struct {
+	DestinationPath string `json:"destination_path"`
+	TypeOfError     string `json:"type_of_error"`
+}
 
-		if len(groupHash) == 0 {
-			return nil, fmt.Errorf(
-				"image hash is missing for file: %s ", firstFile.Path)
-		}
+func ParseInvalidSymlinks(filepath string) ([]SymlinkEntry, error) {
+	return parseStream(filepath, StreamInvalidSymlinks)
+}
 
-		groups = append(groups, DuplicateImageGroup{
-			Hash:       groupHash,
-			Size:       firstFile.Size,
-			ImageCount: len(dupGroup),
-			Images:     dupGroup,
-		})
+type CzkawkaBadExtensionsOutput []BadExtensionEntry
 
-	}
-	return groups, nil
+type BadExtensionEntry struct {
+	Path                  string `json:"path"`
+	ModifiedDate          int64  `json:"modified_date"`
+	Size                  int64  `json:"size"`
+	CurrentExtension      string `json:"current_extension"`
+	ProperExtensionsGroup string `json:"proper_extensions_group"`
+	ProperExtension       string `json:"proper_extension"`
+}
+
+func ParseBadExtensions(filepath string) ([]BadExtensionEntry, error) {
+	return parseStream(filepath, StreamBadExtensions)
 }
@@ -0,0 +1,430 @@
+package loader
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// OutputType is the type of a czkawka JSON output, named after the
+// czkawka_cli subcommand producing it.
+type OutputType string
+
+const (
+	OutputImage        OutputType = "image"
+	OutputDup          OutputType = "dup"
+	OutputVideo        OutputType = "video"
+	OutputMusic        OutputType = "music"
+	OutputBroken       OutputType = "broken"
+	OutputBig          OutputType = "big"
+	OutputEmptyFolders OutputType = "empty-folders"
+	OutputEmptyFiles   OutputType = "empty-files"
+	OutputTemp         OutputType = "temp"
+	OutputSymlinks     OutputType = "symlinks"
+	OutputExtensions   OutputType = "ext"
+)
+
+var (
+	ErrUnknownOutput   = errors.New("unknown czkawka output")
+	ErrAmbiguousOutput = errors.New("czkawka output type can't be detected")
+)
+
+// Validation reports how many groups, or entries for outputs that don't
+// group files, of a czkawka output were accepted and which were left out.
+type Validation struct {
+	Type     OutputType `json:"type"`
+	Accepted int        `json:"accepted"`
+	Skipped  []Problem  `json:"skipped"`
+}
+
+// Problem is a group or entry left out of an output, located by its index
+// or, for duplicate file outputs, its size key and index.
+type Problem struct {
+	Location string `json:"location"`
+	Reason   string `json:"reason"`
+}
+
+// DetectOutput tells which czkawka subcommand produced the output read
+// from r by its first entries. Lists of plain files and empty outputs return
+// ErrAmbiguousOutput. The returned reader reads the whole output again, from
+// the start.
+func DetectOutput(r io.Reader) (OutputType, io.Reader, error) {
+	var head bytes.Buffer
+	t, err := detectOutput(json.NewDecoder(io.TeeReader(r, &head)))
+	return t, io.MultiReader(&head, r), err
+}
+
+func detectOutput(dec *json.Decoder) (OutputType, error) {
+	tok, err := dec.Token()
+	if err == io.EOF {
+		return "", fmt.Errorf("%w: empty file", ErrUnknownOutput)
+	}
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrUnknownOutput, err)
+	}
+
+	switch tok {
+	case json.Delim('{'):
+		if !dec.More() {
+			return "", fmt.Errorf("%w: no results", ErrAmbiguousOutput)
+		}
+		// the value of the first key tells
+		if _, err := dec.Token(); err != nil {
+			return "", fmt.Errorf("%w: %v", ErrUnknownOutput, err)
+		}
+		switch tok, _ := dec.Token(); tok {
+		case json.Delim('['):
+			return OutputDup, nil
+		case json.Delim('{'):
+			return OutputEmptyFolders, nil
+		}
+		return "", ErrUnknownOutput
+	case json.Delim('['):
+		for dec.More() {
+			tok, err := dec.Token()
+			if err != nil {
+				return "", fmt.Errorf("%w: %v", ErrUnknownOutput, err)
+			}
+			switch tok := tok.(type) {
+			case string:
+				return OutputEmptyFolders, nil
+			case json.Delim:
+				if tok == '{' {
+					entry, err := decodeEntry(dec)
+					if err != nil {
+						return "", fmt.Errorf("%w: %v", ErrUnknownOutput, err)
+					}
+					return detectEntry(entry)
+				}
+				if tok != '[' {
+					return "", ErrUnknownOutput
+				}
+				if !dec.More() {
+					// an empty group
+					if _, err := dec.Token(); err != nil {
+						return "", fmt.Errorf("%w: %v", ErrUnknownOutput, err)
+					}
+					continue
+				}
+				if tok, err := dec.Token(); err != nil || tok != json.Delim('{') {
+					return "", fmt.Errorf("%w: malformed group", ErrUnknownOutput)
+				}
+				entry, err := decodeEntry(dec)
+				if err != nil {
+					return "", fmt.Errorf("%w: %v", ErrUnknownOutput, err)
+				}
+				return detectGroupEntry(entry), nil
+			default:
+				return "", ErrUnknownOutput
+			}
+		}
+		return "", fmt.Errorf("%w: no results", ErrAmbiguousOutput)
+	}
+
+	return "", ErrUnknownOutput
+}
+
+// decodeEntry decodes the rest of an object whose opening brace was
+// already read from dec.
+func decodeEntry(dec *json.Decoder) (map[string]json.RawMessage, error) {
+	entry := make(map[string]json.RawMessage)
+	err := decodeFields(dec, func(key string) (bool, error) {
+		var value json.RawMessage
+		if err := dec.Decode(&value); err != nil {
+			return false, err
+		}
+		entry[key] = value
+		return true, nil
+	})
+	return entry, err
+}
+
+// detectGroupEntry tells similar images, videos and music apart by the
+// fields of one of their files.
+func detectGroupEntry(entry map[string]json.RawMessage) OutputType {
+	switch {
+	case has(entry, "width") || has(entry, "similarity"):
+		return OutputImage
+	case has(entry, "track_title") || has(entry, "track_artist"):
+		return OutputMusic
+	}
+	return OutputVideo
+}
+
+func detectEntry(entry map[string]json.RawMessage) (OutputType, error) {
+	switch {
+	case has(entry, "symlink_info"):
+		return OutputSymlinks, nil
+	case has(entry, "error_string") || has(entry, "type_of_file"):
+		return OutputBroken, nil
+	case has(entry, "proper_extension"):
+		return OutputExtensions, nil
+	}
+	return "", fmt.Errorf("%w: a list of files is written by big, empty-files and temp", ErrAmbiguousOutput)
+}
+
+// Validate checks the czkawka output of type t read from r and writes it to
+// w without the groups or entries that can't be loaded. Groups and entries
+// are decoded and written one at a time, so that outputs of any size are
+// validated with flat memory use.
+func Validate(r io.Reader, w io.Writer, t OutputType) (Validation, error) {
+	validation := Validation{Type: t, Skipped: []Problem{}}
+
+	detected, r, err := DetectOutput(r)
+	if err == nil && detected != t {
+		return validation, fmt.Errorf("file looks like %s output, not %s", detected, t)
+	}
+
+	dec := json.NewDecoder(r)
+	out := bufio.NewWriter(w)
+	switch t {
+	case OutputDup:
+		err = validateFileGroups(dec, out, &validation)
+	case OutputImage:
+		err = validateGroups(dec, out, &validation, func(f ImageInfo) string {
+			if len(f.Hash) == 0 {
+				return "image hash is missing for file " + f.Path
+			}
+			return ""
+		})
+	case OutputVideo:
+		err = validateGroups[VideoInfo](dec, out, &validation, nil)
+	case OutputMusic:
+		err = validateGroups[MusicInfo](dec, out, &validation, nil)
+	case OutputBroken:
+		err = validateEntries[BrokenFile](dec, out, &validation)
+	case OutputSymlinks:
+		err = validateEntries[SymlinkEntry](dec, out, &validation)
+	case OutputExtensions:
+		err = validateEntries[BadExtensionEntry](dec, out, &validation)
+	case OutputBig, OutputEmptyFiles, OutputTemp:
+		// all three are written as a plain list of files
+		err = validateEntries[FileEntry](dec, out, &validation)
+	case OutputEmptyFolders:
+		err = validateEmptyFolders(dec, out, &validation)
+	default:
+		return validation, fmt.Errorf("%w: %q", ErrUnknownOutput, t)
+	}
+	if err != nil {
+		return validation, err
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return validation, errors.New("unexpected data after the output")
+	}
+	return validation, out.Flush()
+}
+
+// validateGroups keeps the groups of at least two files that all have a
+// path and pass check, if given.
+func validateGroups[T interface{ path() string }](dec *json.Decoder, out *bufio.Writer, v *Validation, check func(T) string) error {
+	list := listWriter{out: out}
+	err := decodeList(dec, func(i int, group json.RawMessage) {
+		if reason := checkGroup(group, check); reason != "" {
+			v.Skipped = append(v.Skipped, Problem{Location: strconv.Itoa(i), Reason: reason})
+			return
+		}
+		list.add(group)
+		v.Accepted++
+	})
+	list.close()
+	return err
+}
+
+func validateFileGroups(dec *json.Decoder, out *bufio.Writer, v *Validation) error {
+	out.WriteByte('{')
+	keys := 0
+	err := decodeObject(dec, func(size string) (bool, error) {
+		// the size is only written once one of its groups is kept
+		var list listWriter
+		err := decodeList(dec, func(i int, group json.RawMessage) {
+			if reason := checkGroup[FileInfo](group, nil); reason != "" {
+				v.Skipped = append(v.Skipped, Problem{Location: fmt.Sprintf("%s/%d", size, i), Reason: reason})
+				return
+			}
+			if list.out == nil {
+				if keys > 0 {
+					out.WriteByte(',')
+				}
+				keys++
+				writeKey(out, size)
+				list.out = out
+			}
+			list.add(group)
+			v.Accepted++
+		})
+		if list.out != nil {
+			list.close()
+		}
+		return true, err
+	})
+	out.WriteByte('}')
+	return err
+}
+
+func checkGroup[T interface{ path() string }](group json.RawMessage, check func(T) string) string {
+	var files []T
+	if err := json.Unmarshal(group, &files); err != nil {
+		return fmt.Sprintf("malformed group: %v", err)
+	}
+	if len(files) < 2 {
+		return "fewer than two files"
+	}
+	for _, f := range files {
+		if f.path() == "" {
+			return "file without path"
+		}
+		if check != nil {
+			if reason := check(f); reason != "" {
+				return reason
+			}
+		}
+	}
+	return ""
+}
+
+// validateEntries keeps the entries of a flat list that have a path.
+func validateEntries[T interface{ path() string }](dec *json.Decoder, out *bufio.Writer, v *Validation) error {
+	list := listWriter{out: out}
+	err := decodeList(dec, func(i int, raw json.RawMessage) {
+		var entry T
+		if err := json.Unmarshal(raw, &entry); err != nil {
+			v.Skipped = append(v.Skipped, Problem{Location: strconv.Itoa(i), Reason: fmt.Sprintf("malformed entry: %v", err)})
+			return
+		}
+		if entry.path() == "" {
+			v.Skipped = append(v.Skipped, Problem{Location: strconv.Itoa(i), Reason: "entry without path"})
+			return
+		}
+		list.add(raw)
+		v.Accepted++
+	})
+	list.close()
+	return err
+}
+
+// validateEmptyFolders keeps the folders with a path, in whichever of the
+// formats ParseEmptyFolders reads the output is.
+func validateEmptyFolders(dec *json.Decoder, out *bufio.Writer, v *Validation) error {
+	tok, err := dec.Token()
+	if err != nil {
+		return err
+	}
+
+	switch tok {
+	case nil:
+		out.WriteString("[]")
+		return nil
+	case json.Delim('['):
+		list := listWriter{out: out}
+		for i := 0; dec.More(); i++ {
+			var path string
+			if err := dec.Decode(&path); err != nil {
+				return err
+			}
+			if path == "" {
+				v.Skipped = append(v.Skipped, Problem{Location: strconv.Itoa(i), Reason: "entry without path"})
+				continue
+			}
+			raw, _ := json.Marshal(path)
+			list.add(raw)
+			v.Accepted++
+		}
+		list.close()
+		return closeDelim(dec, ']')
+	case json.Delim('{'):
+		out.WriteByte('{')
+		kept := 0
+		err := decodeFields(dec, func(path string) (bool, error) {
+			var raw json.RawMessage
+			if err := dec.Decode(&raw); err != nil {
+				return false, err
+			}
+			var folder FolderEntry
+			if err := json.Unmarshal(raw, &folder); err != nil {
+				v.Skipped = append(v.Skipped, Problem{Location: path, Reason: fmt.Sprintf("malformed entry: %v", err)})
+				return true, nil
+			}
+			if path == "" {
+				v.Skipped = append(v.Skipped, Problem{Location: path, Reason: "entry without path"})
+				return true, nil
+			}
+			if kept > 0 {
+				out.WriteByte(',')
+			}
+			kept++
+			writeKey(out, path)
+			out.Write(raw)
+			v.Accepted++
+			return true, nil
+		})
+		out.WriteByte('}')
+		return err
+	}
+	return fmt.Errorf("expected [ or {, got %v", tok)
+}
+
+// decodeList decodes a JSON array from dec, calling fn with the index and
+// raw value of each element. A null array has no elements.
+func decodeList(dec *json.Decoder, fn func(i int, raw json.RawMessage)) error {
+	ok, err := openDelim(dec, '[')
+	if err != nil || !ok {
+		return err
+	}
+
+	for i := 0; dec.More(); i++ {
+		var raw json.RawMessage
+		if err := dec.Decode(&raw); err != nil {
+			return err
+		}
+		fn(i, raw)
+	}
+	return closeDelim(dec, ']')
+}
+
+// listWriter writes the elements of a JSON array to out as they are added.
+// Write errors are kept by out until it is flushed.
+type listWriter struct {
+	out *bufio.Writer
+	n   int
+}
+
+func (l *listWriter) add(raw json.RawMessage) {
+	if l.n == 0 {
+		l.out.WriteByte('[')
+	} else {
+		l.out.WriteByte(',')
+	}
+	l.out.Write(raw)
+	l.n++
+}
+
+func (l *listWriter) close() {
+	if l.n == 0 {
+		l.out.WriteByte('[')
+	}
+	l.out.WriteByte(']')
+}
+
+func writeKey(out *bufio.Writer, key string) {
+	raw, _ := json.Marshal(key)
+	out.Write(raw)
+	out.WriteByte(':')
+}
+
+func has(entry map[string]json.RawMessage, key string) bool {
+	_, ok := entry[key]
+	return ok
+}
+
+func (f FileInfo) path() string          { return f.Path }
+func (f ImageInfo) path() string         { return f.Path }
+func (f VideoInfo) path() string         { return f.Path }
+func (f MusicInfo) path() string         { return f.Path }
+func (f BrokenFile) path() string        { return f.Path }
+func (f FileEntry) path() string         { return f.Path }
+func (f SymlinkEntry) path() string      { return f.Path }
+func (f BadExtensionEntry) path() string { return f.Path }
@@ -0,0 +1,159 @@
+package loader
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestDetectOutput(t *testing.T) {
+	tests := []struct {
+		data string
+		want OutputType
+		err  error
+	}{
+		{`[[], [{"path": "/a.jpg", "width": 1, "hash": [1]}]]`, OutputImage, nil},
+		{`[[{"path": "/a.mp4", "size": 1}]]`, OutputVideo, nil},
+		{`[[{"path": "/a.mp3", "track_title": "Song"}]]`, OutputMusic, nil},
+		{`{"100": [[{"path": "/a"}, {"path": "/b"}]]}`, OutputDup, nil},
+		{`{"/a": {"path": "/a"}}`, OutputEmptyFolders, nil},
+		{`["/a", "/b"]`, OutputEmptyFolders, nil},
+		{`[{"path": "/a.jpg", "type_of_file": "Image", "error_string": "truncated"}]`, OutputBroken, nil},
+		{`[{"path": "/l", "symlink_info": {"destination_path": "/x"}}]`, OutputSymlinks, nil},
+		{`[{"path": "/a.jpg", "proper_extension": "png"}]`, OutputExtensions, nil},
+		{`[{"path": "/a.iso", "size": 3}]`, "", ErrAmbiguousOutput},
+		{`[]`, "", ErrAmbiguousOutput},
+		{`{}`, "", ErrAmbiguousOutput},
+		{"  ", "", ErrUnknownOutput},
+		{`[1, 2]`, "", ErrUnknownOutput},
+		{`"text"`, "", ErrUnknownOutput},
+		{`[[{"path": `, "", ErrUnknownOutput},
+	}
+	for _, tt := range tests {
+		got, r, err := DetectOutput(strings.NewReader(tt.data))
+		if got != tt.want || !errors.Is(err, tt.err) {
+			t.Errorf("DetectOutput(%s) = %q, %v, want %q, %v", tt.data, got, err, tt.want, tt.err)
+		}
+
+		// the whole output can be read again after detecting it
+		data, err := io.ReadAll(r)
+		if err != nil || string(data) != tt.data {
+			t.Errorf("DetectOutput(%s) reader = %q, %v, want the whole output", tt.data, data, err)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name     string
+		t        OutputType
+		data     string
+		want     string
+		accepted int
+		skipped  []Problem
+	}{
+		{
+			name: "image groups",
+			t:    OutputImage,
+			data: `[
+				[{"path": "/a.jpg", "width": 1, "hash": [1]}, {"path": "/b.jpg", "hash": [1]}],
+				[{"path": "/c.jpg", "hash": [1]}],
+				[{"path": "/d.jpg"}, {"path": "/e.jpg"}],
+				[{"path": "/f.jpg", "hash": [2]}, {"path": "/g.jpg", "hash": [2]}]
+			]`,
+			want:     `[[{"path": "/a.jpg", "width": 1, "hash": [1]}, {"path": "/b.jpg", "hash": [1]}],[{"path": "/f.jpg", "hash": [2]}, {"path": "/g.jpg", "hash": [2]}]]`,
+			accepted: 2,
+			skipped: []Problem{
+				{"1", "fewer than two files"},
+				{"2", "image hash is missing for file /d.jpg"},
+			},
+		},
+		{
+			name: "duplicate files by size",
+			t:    OutputDup,
+			data: `{
+				"1": [[{"path": "/a"}]],
+				"2": [[{"path": "/b"}, {"path": ""}], [{"path": "/c"}, {"path": "/d"}]]
+			}`,
+			want:     `{"2":[[{"path": "/c"}, {"path": "/d"}]]}`,
+			accepted: 1,
+			skipped: []Problem{
+				{"1/0", "fewer than two files"},
+				{"2/0", "file without path"},
+			},
+		},
+		{
+			name:     "entries",
+			t:        OutputBig,
+			data:     `[{"path": "/a.iso", "size": 3}, {"size": 2}, {"path": 1}]`,
+			want:     `[{"path": "/a.iso", "size": 3}]`,
+			accepted: 1,
+			skipped: []Problem{
+				{"1", "entry without path"},
+				{"2", "malformed entry: json: cannot unmarshal number into Go struct field FileEntry.path of type string"},
+			},
+		},
+		{
+			name:     "empty folders by path",
+			t:        OutputEmptyFolders,
+			data:     `{"/a": {"path": "/a"}, "": {"path": ""}}`,
+			want:     `{"/a":{"path": "/a"}}`,
+			accepted: 1,
+			skipped:  []Problem{{"", "entry without path"}},
+		},
+		{
+			name:     "empty folder list",
+			t:        OutputEmptyFolders,
+			data:     `["/a", ""]`,
+			want:     `["/a"]`,
+			accepted: 1,
+			skipped:  []Problem{{"1", "entry without path"}},
+		},
+		{
+			name: "null",
+			t:    OutputVideo,
+			data: `null`,
+			want: `[]`,
+		},
+	}
+	for _, tt := range tests {
+		var out bytes.Buffer
+		v, err := Validate(strings.NewReader(tt.data), &out, tt.t)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if out.String() != tt.want {
+			t.Errorf("%s: output = %s, want %s", tt.name, out.String(), tt.want)
+		}
+		if v.Type != tt.t || v.Accepted != tt.accepted || len(v.Skipped) != len(tt.skipped) {
+			t.Errorf("%s: validation = %+v, want %d accepted, %+v skipped", tt.name, v, tt.accepted, tt.skipped)
+			continue
+		}
+		for i, p := range v.Skipped {
+			if p != tt.skipped[i] {
+				t.Errorf("%s: skipped %+v, want %+v", tt.name, p, tt.skipped[i])
+			}
+		}
+	}
+}
+
+func TestValidateRejects(t *testing.T) {
+	tests := []struct {
+		t    OutputType
+		data string
+	}{
+		{OutputImage, `[[{"path": "/a.mp4"}, {"path": "/b.mp4"}]]`}, // video output
+		{OutputVideo, `[[{"path": "/a"}, {"path": "/b"}]`},          // truncated
+		{OutputBig, `[{"path": "/a"}] [{"path": "/b"}]`},            // trailing data
+		{OutputDup, `[[{"path": "/a"}, {"path": "/b"}]]`},           // not by size
+		{"photos", `[]`},
+	}
+	for _, tt := range tests {
+		if v, err := Validate(strings.NewReader(tt.data), io.Discard, tt.t); err == nil {
+			t.Errorf("Validate(%s, %s) = %+v, want an error", tt.data, tt.t, v)
+		}
+	}
+}
@@ -0,0 +1,324 @@
+package loader
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"iter"
+	"os"
+)
+
+// StreamImageDuplicates decodes the groups of a czkawka image output from r
+// one at a time, so that outputs of any size are read with flat memory use.
+// Decoding stops at the first error, which is yielded last.
+func StreamImageDuplicates(r io.Reader) iter.Seq2[DuplicateImageGroup, error] {
+	return func(yield func(DuplicateImageGroup, error) bool) {
+		err := decodeGroups(json.NewDecoder(r), func(images []ImageInfo) bool {
+			if len(images) < 2 {
+				return true
+			}
+			if len(images[0].Hash) == 0 {
+				yield(DuplicateImageGroup{}, fmt.Errorf("image hash is missing for file: %s ", images[0].Path))
+				return false
+			}
+			return yield(DuplicateImageGroup{
+				Hash:       images[0].Hash,
+				Size:       images[0].Size,
+				ImageCount: len(images),
+				Images:     images,
+			}, nil)
+		})
+		if err != nil {
+			yield(DuplicateImageGroup{}, err)
+		}
+	}
+}
+
+// StreamFileDuplicates decodes the groups of a czkawka duplicate file
+// output from r one at a time, like StreamImageDuplicates.
+func StreamFileDuplicates(r io.Reader) iter.Seq2[DuplicateFileGroup, error] {
+	return func(yield func(DuplicateFileGroup, error) bool) {
+		dec := json.NewDecoder(r)
+		err := decodeObject(dec, func(sizeKey string) (bool, error) {
+			more := true
+			err := decodeGroups(dec, func(files []FileInfo) bool {
+				if len(files) < 2 {
+					return true
+				}
+
+				groupHash := files[0].Hash
+				if groupHash == "" {
+					h := sha256.New()
+					h.Write([]byte(sizeKey))
+					for _, f := range files {
+						h.Write([]byte(f.Path))
+					}
+					groupHash = fmt.Sprintf("%x", h.Sum(nil))
+				}
+
+				more = yield(DuplicateFileGroup{
+					Hash:      groupHash,
+					Size:      files[0].Size,
+					FileCount: len(files),
+					Files:     files,
+				}, nil)
+				return more
+			})
+			return more, err
+		})
+		if err != nil {
+			yield(DuplicateFileGroup{}, err)
+		}
+	}
+}
+
+// StreamVideoDuplicates decodes the groups of a czkawka video output from r
+// one at a time, like StreamImageDuplicates.
+func StreamVideoDuplicates(r io.Reader) iter.Seq2[DuplicateVideoGroup, error] {
+	return func(yield func(DuplicateVideoGroup, error) bool) {
+		err := decodeGroups(json.NewDecoder(r), func(files []VideoInfo) bool {
+			if len(files) < 2 {
+				return true
+			}
+
+			// czkawka does not export a group hash for videos
+			h := sha256.New()
+			for _, f := range files {
+				h.Write([]byte(f.Path))
+			}
+
+			return yield(DuplicateVideoGroup{
+				Hash:      fmt.Sprintf("%x", h.Sum(nil)),
+				Size:      files[0].Size,
+				FileCount: len(files),
+				Files:     files,
+			}, nil)
+		})
+		if err != nil {
+			yield(DuplicateVideoGroup{}, err)
+		}
+	}
+}
+
+// StreamMusicDuplicates decodes the groups of a czkawka music output from r
+// one at a time, like StreamImageDuplicates.
+func StreamMusicDuplicates(r io.Reader) iter.Seq2[DuplicateMusicGroup, error] {
+	return func(yield func(DuplicateMusicGroup, error) bool) {
+		err := decodeGroups(json.NewDecoder(r), func(files []MusicInfo) bool {
+			if len(files) < 2 {
+				return true
+			}
+
+			// czkawka does not export a group hash for music
+			h := sha256.New()
+			for _, f := range files {
+				h.Write([]byte(f.Path))
+			}
+
+			return yield(DuplicateMusicGroup{
+				Hash:      fmt.Sprintf("%x", h.Sum(nil)),
+				Size:      files[0].Size,
+				FileCount: len(files),
+				Files:     files,
+			}, nil)
+		})
+		if err != nil {
+			yield(DuplicateMusicGroup{}, err)
+		}
+	}
+}
+
+// StreamBrokenFiles decodes the files of a czkawka broken output from r
+// one at a time, like StreamImageDuplicates.
+func StreamBrokenFiles(r io.Reader) iter.Seq2[BrokenFile, error] {
+	return streamList[BrokenFile](r)
+}
+
+// StreamFileEntries decodes the files of a czkawka big, empty-files or temp
+// output from r one at a time, like StreamImageDuplicates.
+func StreamFileEntries(r io.Reader) iter.Seq2[FileEntry, error] {
+	return streamList[FileEntry](r)
+}
+
+// StreamInvalidSymlinks decodes the symlinks of a czkawka symlinks output
+// from r one at a time, like StreamImageDuplicates.
+func StreamInvalidSymlinks(r io.Reader) iter.Seq2[SymlinkEntry, error] {
+	return streamList[SymlinkEntry](r)
+}
+
+// StreamBadExtensions decodes the files of a czkawka ext output from r one
+// at a time, like StreamImageDuplicates.
+func StreamBadExtensions(r io.Reader) iter.Seq2[BadExtensionEntry, error] {
+	return streamList[BadExtensionEntry](r)
+}
+
+// StreamEmptyFolders decodes the folders of a czkawka empty-folders output
+// from r one at a time, in either of the formats read by ParseEmptyFolders.
+// Folders are yielded in the order of the output.
+func StreamEmptyFolders(r io.Reader) iter.Seq2[FolderEntry, error] {
+	return func(yield func(FolderEntry, error) bool) {
+		dec := json.NewDecoder(r)
+		err := func() error {
+			tok, err := dec.Token()
+			if err != nil || tok == nil {
+				return err
+			}
+
+			switch tok {
+			case json.Delim('['):
+				for dec.More() {
+					var path string
+					if err := dec.Decode(&path); err != nil {
+						return err
+					}
+					if !yield(FolderEntry{Path: path}, nil) {
+						return nil
+					}
+				}
+				return closeDelim(dec, ']')
+			case json.Delim('{'):
+				return decodeFields(dec, func(path string) (bool, error) {
+					var folder FolderEntry
+					if err := dec.Decode(&folder); err != nil {
+						return false, err
+					}
+					if folder.Path == "" {
+						folder.Path = path
+					}
+					return yield(folder, nil), nil
+				})
+			}
+			return fmt.Errorf("expected [ or {, got %v", tok)
+		}()
+		if err != nil {
+			yield(FolderEntry{}, err)
+		}
+	}
+}
+
+// streamList decodes a JSON array of entries from r one at a time. A null
+// array has no entries.
+func streamList[T any](r io.Reader) iter.Seq2[T, error] {
+	return func(yield func(T, error) bool) {
+		dec := json.NewDecoder(r)
+		err := func() error {
+			ok, err := openDelim(dec, '[')
+			if err != nil || !ok {
+				return err
+			}
+
+			for dec.More() {
+				var entry T
+				if err := dec.Decode(&entry); err != nil {
+					return err
+				}
+				if !yield(entry, nil) {
+					return nil
+				}
+			}
+			return closeDelim(dec, ']')
+		}()
+		if err != nil {
+			var zero T
+			yield(zero, err)
+		}
+	}
+}
+
+// decodeGroups decodes a JSON array of groups from dec, calling fn with
+// each group until it returns false. A null array has no groups.
+func decodeGroups[T any](dec *json.Decoder, fn func([]T) bool) error {
+	ok, err := openDelim(dec, '[')
+	if err != nil || !ok {
+		return err
+	}
+
+	for dec.More() {
+		var group []T
+		if err := dec.Decode(&group); err != nil {
+			return err
+		}
+		if !fn(group) {
+			return nil
+		}
+	}
+	return closeDelim(dec, ']')
+}
+
+// decodeObject decodes a JSON object from dec, calling fn with each key
+// while dec is positioned at its value, which fn has to consume. It stops
+// when fn returns false. A null object has no keys.
+func decodeObject(dec *json.Decoder, fn func(key string) (bool, error)) error {
+	ok, err := openDelim(dec, '{')
+	if err != nil || !ok {
+		return err
+	}
+	return decodeFields(dec, fn)
+}
+
+// decodeFields decodes the rest of an object whose opening brace was
+// already read from dec, like decodeObject.
+func decodeFields(dec *json.Decoder, fn func(key string) (bool, error)) error {
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		key, ok := tok.(string)
+		if !ok {
+			return fmt.Errorf("expected object key, got %v", tok)
+		}
+
+		more, err := fn(key)
+		if err != nil || !more {
+			return err
+		}
+	}
+	return closeDelim(dec, '}')
+}
+
+// openDelim reads the opening delim of an array or object from dec,
+// returning false for null.
+func openDelim(dec *json.Decoder, delim json.Delim) (bool, error) {
+	tok, err := dec.Token()
+	if err != nil {
+		return false, err
+	}
+	if tok == nil {
+		return false, nil
+	}
+	if tok != delim {
+		return false, fmt.Errorf("expected %v, got %v", delim, tok)
+	}
+	return true, nil
+}
+
+func closeDelim(dec *json.Decoder, delim json.Delim) error {
+	tok, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	if tok != delim {
+		return fmt.Errorf("expected %v, got %v", delim, tok)
+	}
+	return nil
+}
+
+// parseStream reads all the groups decoded by stream from the file at path.
+func parseStream[T any](path string, stream func(io.Reader) iter.Seq2[T, error]) ([]T, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var groups []T
+	for group, err := range stream(file) {
+		if err != nil {
+			return nil, err
+		}
+		groups = append(groups, group)
+	}
+	return groups, nil
+}
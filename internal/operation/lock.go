@@ -0,0 +1,110 @@
+// Package operation keeps scans, loads and trash runs from running at the
+// same time, as they all rewrite the stored groups and the files on disk.
+package operation
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/fadykuzman/schluckauf/internal/storage"
+)
+
+// ErrBusy is matched by the errors of operations refused because another
+// one is in progress.
+var ErrBusy = errors.New("another operation is in progress")
+
+type Kind string
+
+const (
+	Scan   Kind = "scan"
+	Import Kind = "import"
+	Trash  Kind = "trash"
+)
+
+// Operation describes what holds a Lock.
+type Operation struct {
+	Kind      Kind         `json:"kind"`
+	ScanKind  storage.Kind `json:"scanKind,omitempty"`
+	Directory string       `json:"directory,omitempty"`
+	JobID     *int         `json:"jobId,omitempty"`
+	StartedBy string       `json:"startedBy"`
+	StartedAt time.Time    `json:"startedAt"`
+}
+
+// BusyError is returned when an operation can't start because Running is
+// in progress.
+type BusyError struct {
+	Running Operation
+}
+
+func (e *BusyError) Error() string {
+	return fmt.Sprintf("%s in progress, started by %s at %s",
+		e.Running.Kind, e.Running.StartedBy, e.Running.StartedAt.Format(time.RFC3339))
+}
+
+func (e *BusyError) Is(target error) bool {
+	return target == ErrBusy
+}
+
+// Lock lets one operation run at a time. The zero value is unlocked.
+type Lock struct {
+	mu      sync.Mutex
+	running *Operation
+}
+
+// Held is an operation that holds its Lock until it is released.
+type Held struct {
+	lock *Lock
+	op   *Operation
+	once sync.Once
+}
+
+// Acquire starts op, failing with a *BusyError if another operation is in
+// progress. Operations don't wait for each other.
+func (l *Lock) Acquire(op Operation) (*Held, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.running != nil {
+		return nil, &BusyError{Running: *l.running}
+	}
+	if op.StartedAt.IsZero() {
+		op.StartedAt = time.Now().UTC()
+	}
+	l.running = &op
+	return &Held{lock: l, op: l.running}, nil
+}
+
+// Running returns the operation in progress, if any.
+func (l *Lock) Running() (Operation, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.running == nil {
+		return Operation{}, false
+	}
+	return *l.running, true
+}
+
+// SetJob records the scan job that carries out the held operation. It does
+// nothing once the operation has been released.
+func (h *Held) SetJob(id int) {
+	h.lock.mu.Lock()
+	defer h.lock.mu.Unlock()
+
+	if h.lock.running == h.op {
+		h.op.JobID = &id
+	}
+}
+
+// Release ends the held operation. Releasing it again does nothing.
+func (h *Held) Release() {
+	h.once.Do(func() {
+		h.lock.mu.Lock()
+		defer h.lock.mu.Unlock()
+
+		h.lock.running = nil
+	})
+}
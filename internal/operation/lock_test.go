@@ -0,0 +1,43 @@
+package operation
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestLock(t *testing.T) {
+	var lock Lock
+
+	scan, err := lock.Acquire(Operation{Kind: Scan, StartedBy: "a"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := lock.Acquire(Operation{Kind: Trash, StartedBy: "b"}); !errors.Is(err, ErrBusy) {
+		t.Fatalf("Acquire while busy = %v, want %v", err, ErrBusy)
+	}
+
+	scan.SetJob(1)
+	if op, ok := lock.Running(); !ok || op.JobID == nil || *op.JobID != 1 {
+		t.Errorf("running = %+v, want job 1", op)
+	}
+
+	scan.Release()
+	scan.Release()
+	if op, ok := lock.Running(); ok {
+		t.Errorf("running = %+v after release, want none", op)
+	}
+	scan.SetJob(2)
+
+	trash, err := lock.Acquire(Operation{Kind: Trash, StartedBy: "b"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer trash.Release()
+
+	// a released operation doesn't touch the one holding the lock now
+	scan.SetJob(3)
+	scan.Release()
+	if op, ok := lock.Running(); !ok || op.Kind != Trash || op.JobID != nil {
+		t.Errorf("running = %+v, want the trash run without a job", op)
+	}
+}
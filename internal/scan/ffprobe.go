@@ -0,0 +1,87 @@
+package scan
+
+import (
+	"context"
+	"encoding/json"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/fadykuzman/schluckauf/internal/storage"
+)
+
+type ffprobeOutput struct {
+	Streams []struct {
+		CodecType string `json:"codec_type"`
+		CodecName string `json:"codec_name"`
+		Width     int    `json:"width"`
+		Height    int    `json:"height"`
+		BitRate   string `json:"bit_rate"`
+	} `json:"streams"`
+	Format struct {
+		FormatName string `json:"format_name"`
+		Duration   string `json:"duration"`
+		BitRate    string `json:"bit_rate"`
+	} `json:"format"`
+}
+
+// ffprobeAvailable reports whether ffprobe can be used for video metadata.
+func ffprobeAvailable() bool {
+	_, err := exec.LookPath("ffprobe")
+	return err == nil
+}
+
+// probeVideo reads duration, resolution, codec, bitrate and container of
+// the video at path with ffprobe.
+func probeVideo(ctx context.Context, path string) (storage.VideoMetadata, error) {
+	out, err := exec.CommandContext(ctx, "ffprobe",
+		"-v", "quiet",
+		"-print_format", "json",
+		"-show_format",
+		"-show_streams",
+		path,
+	).Output()
+	if err != nil {
+		return storage.VideoMetadata{}, err
+	}
+
+	var probe ffprobeOutput
+	if err := json.Unmarshal(out, &probe); err != nil {
+		return storage.VideoMetadata{}, err
+	}
+
+	meta := storage.VideoMetadata{
+		Container: containerName(path, probe.Format.FormatName),
+	}
+	meta.Duration, _ = strconv.ParseFloat(probe.Format.Duration, 64)
+	meta.Bitrate, _ = strconv.ParseInt(probe.Format.BitRate, 10, 64)
+
+	for _, stream := range probe.Streams {
+		if stream.CodecType != "video" {
+			continue
+		}
+		meta.Codec = stream.CodecName
+		meta.Width = stream.Width
+		meta.Height = stream.Height
+		if meta.Bitrate == 0 {
+			meta.Bitrate, _ = strconv.ParseInt(stream.BitRate, 10, 64)
+		}
+		break
+	}
+
+	return meta, nil
+}
+
+// containerName picks the entry of ffprobe's comma separated format list
+// (e.g. "mov,mp4,m4a,3gp,3g2,mj2") that matches the file extension.
+func containerName(path, formatName string) string {
+	ext := strings.TrimPrefix(strings.ToLower(filepath.Ext(path)), ".")
+	formats := strings.Split(formatName, ",")
+	for _, f := range formats {
+		if f == ext {
+			return f
+		}
+	}
+	return formats[0]
+}
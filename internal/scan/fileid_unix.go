@@ -0,0 +1,17 @@
+//go:build unix
+
+package scan
+
+import (
+	"io/fs"
+	"syscall"
+)
+
+// fileID returns the device and inode of a file, which hardlinks share.
+func fileID(info fs.FileInfo) (fileKey, bool) {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return fileKey{}, false
+	}
+	return fileKey{device: uint64(stat.Dev), inode: uint64(stat.Ino)}, true
+}
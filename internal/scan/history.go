@@ -0,0 +1,92 @@
+package scan
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"time"
+
+	"github.com/fadykuzman/schluckauf/internal/loader"
+	"github.com/fadykuzman/schluckauf/internal/storage"
+)
+
+// ErrNoArtifact is returned for jobs whose czkawka output was pruned or
+// never written.
+var ErrNoArtifact = errors.New("scan job has no artifact")
+
+// Retention limits the czkawka outputs kept as artifacts of finished scans.
+// Keep is the number of most recent artifacts kept and MaxAge how long they
+// are kept; zero values don't limit them.
+type Retention struct {
+	Keep   int
+	MaxAge time.Duration
+}
+
+// Artifact returns the path of the czkawka output job id was loaded from.
+func (m *Manager) Artifact(id int) (storage.ScanJob, error) {
+	job, err := m.store.GetScanJob(id)
+	if err != nil {
+		return storage.ScanJob{}, err
+	}
+	if job.Artifact == "" {
+		return job, ErrNoArtifact
+	}
+	if _, err := os.Stat(job.Artifact); errors.Is(err, fs.ErrNotExist) {
+		return job, ErrNoArtifact
+	}
+	return job, nil
+}
+
+// Reimport queues loading the artifact of job id again, as a new job of the
+// same kind and directory, requested by startedBy.
+func (m *Manager) Reimport(id int, merge bool, startedBy string) (storage.ScanJob, loader.Validation, error) {
+	job, err := m.Artifact(id)
+	if err != nil {
+		return storage.ScanJob{}, loader.Validation{}, err
+	}
+
+	if merge && job.Directory == "" {
+		return storage.ScanJob{}, loader.Validation{}, fmt.Errorf("%w: merging needs the directory that was scanned", ErrInvalidImport)
+	}
+
+	file, err := os.Open(job.Artifact)
+	if err != nil {
+		return storage.ScanJob{}, loader.Validation{}, fmt.Errorf("failed to read artifact of scan job %d: %w", id, err)
+	}
+	defer file.Close()
+
+	return m.Import(job.Kind, job.Directory, file, merge, startedBy)
+}
+
+// prune removes the artifacts beyond the retention limits.
+func (m *Manager) prune() {
+	if m.retention.Keep <= 0 && m.retention.MaxAge <= 0 {
+		return
+	}
+
+	var before time.Time
+	if m.retention.MaxAge > 0 {
+		before = time.Now().Add(-m.retention.MaxAge)
+	}
+
+	jobs, err := m.store.ScanArtifactsToPrune(m.retention.Keep, before)
+	if err != nil {
+		log.Printf("error: %v", err)
+		return
+	}
+
+	for _, job := range jobs {
+		if err := os.Remove(job.Artifact); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			log.Printf("error pruning artifact of scan job %d: %v", job.ID, err)
+			continue
+		}
+		if err := m.store.ClearScanJobArtifact(job.ID); err != nil {
+			log.Printf("error: %v", err)
+		}
+	}
+	if len(jobs) > 0 {
+		log.Printf("Pruned %d scan artifacts", len(jobs))
+	}
+}
@@ -0,0 +1,166 @@
+package scan
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+
+	"github.com/fadykuzman/schluckauf/internal/loader"
+	"github.com/fadykuzman/schluckauf/internal/operation"
+	"github.com/fadykuzman/schluckauf/internal/storage"
+)
+
+// ErrInvalidImport is returned for czkawka outputs that can't be imported.
+var ErrInvalidImport = errors.New("invalid czkawka output")
+
+// Import validates a czkawka output produced elsewhere, read from r, and
+// queues loading it as a job of kind, requested by startedBy, without
+// running czkawka. An empty kind is detected from the output. With merge set, the results are
+// reconciled with the stored groups under directory instead of replacing
+// them. Like Submit, it fails if another operation is in progress.
+func (m *Manager) Import(kind storage.Kind, directory string, r io.Reader, merge bool, startedBy string) (storage.ScanJob, loader.Validation, error) {
+	kind, artifact, validation, err := prepareImport(m.scansDir, kind, r)
+	if err != nil {
+		return storage.ScanJob{}, validation, err
+	}
+
+	held, err := m.lock.Acquire(operation.Operation{
+		Kind:      operation.Import,
+		ScanKind:  kind,
+		Directory: directory,
+		StartedBy: startedBy,
+	})
+	if err != nil {
+		os.Remove(artifact)
+		return storage.ScanJob{}, validation, err
+	}
+
+	id, err := m.store.CreateScanJob(kind, directory, nil, merge)
+	if err != nil {
+		held.Release()
+		os.Remove(artifact)
+		return storage.ScanJob{}, validation, err
+	}
+	if err := m.store.SetScanJobArtifact(id, artifact); err != nil {
+		held.Release()
+		return storage.ScanJob{}, validation, err
+	}
+
+	if err := m.enqueue(id, artifact, held); err != nil {
+		return storage.ScanJob{}, validation, err
+	}
+
+	job, err := m.Job(id)
+	return job, validation, err
+}
+
+// ImportFile loads the czkawka output at path into store right away, the
+// way Import does in the background.
+func ImportFile(store *storage.Storage, scansDir string, kind storage.Kind, directory string, path string, merge bool) (storage.ScanJob, loader.Validation, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return storage.ScanJob{}, loader.Validation{}, err
+	}
+	defer file.Close()
+
+	kind, artifact, validation, err := prepareImport(scansDir, kind, file)
+	if err != nil {
+		return storage.ScanJob{}, validation, err
+	}
+
+	id, err := store.CreateScanJob(kind, directory, nil, merge)
+	if err != nil {
+		return storage.ScanJob{}, validation, err
+	}
+	if err := store.SetScanJobArtifact(id, artifact); err != nil {
+		return storage.ScanJob{}, validation, err
+	}
+	if err := store.StartScanJob(id); err != nil {
+		return storage.ScanJob{}, validation, err
+	}
+
+	job, err := store.GetScanJob(id)
+	if err != nil {
+		return storage.ScanJob{}, validation, err
+	}
+
+	setState := func(state storage.ScanState, message string) {
+		if err := store.UpdateScanJobState(id, state, message, nil); err != nil {
+			log.Printf("error: %v", err)
+		}
+	}
+
+	count, err := loadResults(context.Background(), store, job, artifact, func(state storage.ScanState) {
+		setState(state, "")
+	})
+	if err != nil {
+		setState(storage.ScanFailed, err.Error())
+		return storage.ScanJob{}, validation, err
+	}
+	setState(storage.ScanDone, doneMessage(kind, count))
+
+	job, err = store.GetScanJob(id)
+	return job, validation, err
+}
+
+// prepareImport detects the kind of the output read from r if it isn't
+// given, and validates it while writing what can be loaded to a new file in
+// scansDir.
+func prepareImport(scansDir string, kind storage.Kind, r io.Reader) (storage.Kind, string, loader.Validation, error) {
+	validation := loader.Validation{Skipped: []loader.Problem{}}
+
+	var outputType loader.OutputType
+	if kind == "" {
+		detected, output, err := loader.DetectOutput(r)
+		if err != nil {
+			return "", "", validation, fmt.Errorf("%w: %w", ErrInvalidImport, err)
+		}
+		outputType, r = detected, output
+
+		for k, subcommand := range subcommands {
+			if subcommand == string(detected) {
+				kind = k
+			}
+		}
+		if kind == "" {
+			return "", "", validation, fmt.Errorf("%w: unsupported output type %q", ErrInvalidImport, detected)
+		}
+	} else {
+		subcommand, ok := subcommands[kind]
+		if !ok {
+			return "", "", validation, fmt.Errorf("%w: unsupported kind %q", ErrInvalidImport, kind)
+		}
+		outputType = loader.OutputType(subcommand)
+	}
+
+	if err := os.MkdirAll(scansDir, 0o770); err != nil {
+		return "", "", validation, fmt.Errorf("failed to create scans directory: %w", err)
+	}
+
+	file, err := os.CreateTemp(scansDir, "czkawka-import-*.json")
+	if err != nil {
+		return "", "", validation, fmt.Errorf("failed to create import file: %w", err)
+	}
+	defer file.Close()
+
+	validation, err = loader.Validate(r, file, outputType)
+	if err != nil {
+		os.Remove(file.Name())
+		return "", "", validation, fmt.Errorf("%w: %w", ErrInvalidImport, err)
+	}
+	// loading nothing would wipe the stored results of kind
+	if validation.Accepted == 0 && len(validation.Skipped) > 0 {
+		os.Remove(file.Name())
+		return "", "", validation, fmt.Errorf("%w: nothing in the file can be loaded as %s output", ErrInvalidImport, outputType)
+	}
+
+	if err := file.Close(); err != nil {
+		os.Remove(file.Name())
+		return "", "", validation, fmt.Errorf("failed to write import file: %w", err)
+	}
+
+	return kind, file.Name(), validation, nil
+}
@@ -0,0 +1,731 @@
+// Package scan runs czkawka scans as background jobs and loads their results into storage
+package scan
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"iter"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/fadykuzman/schluckauf/internal/loader"
+	"github.com/fadykuzman/schluckauf/internal/operation"
+	"github.com/fadykuzman/schluckauf/internal/storage"
+)
+
+const (
+	// queueSize bounds the jobs waiting for the worker. Jobs hold the
+	// operation lock from submission until they have finished, so there is
+	// never more than one.
+	queueSize = 1
+	waitDelay = 2 * time.Second
+
+	versionTimeout = 5 * time.Second
+)
+
+// subcommands maps the kinds of scans to the czkawka_cli subcommand running them.
+var subcommands = map[storage.Kind]string{
+	storage.KindImage: "image",
+	storage.KindFile:  "dup",
+	storage.KindVideo: "video",
+	storage.KindMusic: "music",
+
+	storage.KindBroken: "broken",
+	storage.KindBig:    "big",
+
+	storage.KindEmptyFolders: "empty-folders",
+	storage.KindEmptyFiles:   "empty-files",
+	storage.KindTemp:         "temp",
+	storage.KindSymlinks:     "symlinks",
+	storage.KindExtensions:   "ext",
+}
+
+var (
+	ErrQueueFull = errors.New("too many scans queued")
+	ErrFinished  = errors.New("scan job already finished")
+)
+
+// Manager queues scan jobs and runs them one at a time in the background.
+// A job holds the operation lock from the time it is submitted until it
+// has finished, so jobs are refused while another one or a trash run is
+// in progress.
+type Manager struct {
+	store     *storage.Storage
+	scansDir  string
+	retention Retention
+	// defaultScanner names the scanner used when the options don't
+	defaultScanner string
+	scanners       map[string]Scanner
+	queue          chan int
+	lock           *operation.Lock
+
+	mu   sync.Mutex
+	jobs map[int]*activeJob
+}
+
+type activeJob struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	output *progressWriter
+	held   *operation.Held
+	// artifact is the czkawka output to load for imports, which don't run
+	// czkawka.
+	artifact string
+}
+
+// NewManager marks jobs left over from a previous run as failed, prunes
+// artifacts beyond retention and starts the worker that executes queued
+// scans, with defaultScanner unless their options name another one.
+func NewManager(store *storage.Storage, scansDir string, retention Retention, defaultScanner string, lock *operation.Lock) (*Manager, error) {
+	if !validScanner(defaultScanner) {
+		return nil, fmt.Errorf("unknown scanner %q", defaultScanner)
+	}
+
+	n, err := store.FailInterruptedScanJobs()
+	if err != nil {
+		return nil, err
+	}
+	if n > 0 {
+		log.Printf("Marked %d interrupted scan jobs as failed", n)
+	}
+
+	m := &Manager{
+		store:          store,
+		scansDir:       scansDir,
+		retention:      retention,
+		defaultScanner: defaultScanner,
+		scanners: map[string]Scanner{
+			ScannerCzkawka: czkawkaScanner{},
+			ScannerNative:  nativeScanner{},
+		},
+		queue: make(chan int, queueSize),
+		lock:  lock,
+		jobs:  make(map[int]*activeJob),
+	}
+	m.prune()
+	go m.work()
+
+	return m, nil
+}
+
+// Submit records a new scan job of kind for directory, requested by
+// startedBy, and queues it. It fails with an operation.BusyError if another
+// operation is in progress. The options are expected to be validated
+// already. With merge set, the results are reconciled with the stored
+// groups instead of replacing them.
+func (m *Manager) Submit(kind storage.Kind, directory string, options Options, merge bool, startedBy string) (storage.ScanJob, error) {
+	optionsJSON, err := json.Marshal(options)
+	if err != nil {
+		return storage.ScanJob{}, err
+	}
+
+	held, err := m.lock.Acquire(operation.Operation{
+		Kind:      operation.Scan,
+		ScanKind:  kind,
+		Directory: directory,
+		StartedBy: startedBy,
+	})
+	if err != nil {
+		return storage.ScanJob{}, err
+	}
+
+	id, err := m.store.CreateScanJob(kind, directory, optionsJSON, merge)
+	if err != nil {
+		held.Release()
+		return storage.ScanJob{}, err
+	}
+
+	if err := m.enqueue(id, "", held); err != nil {
+		return storage.ScanJob{}, err
+	}
+	return m.Job(id)
+}
+
+// enqueue tracks job id and hands it to the worker, loading artifact
+// instead of running czkawka if one is given. The job releases held once
+// it has finished.
+func (m *Manager) enqueue(id int, artifact string, held *operation.Held) error {
+	held.SetJob(id)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	m.mu.Lock()
+	m.jobs[id] = &activeJob{ctx: ctx, cancel: cancel, output: &progressWriter{}, held: held, artifact: artifact}
+	m.mu.Unlock()
+
+	select {
+	case m.queue <- id:
+	default:
+		m.untrack(id)
+		if err := m.store.UpdateScanJobState(id, storage.ScanFailed, ErrQueueFull.Error(), nil); err != nil {
+			log.Printf("error: %v", err)
+		}
+		return ErrQueueFull
+	}
+	return nil
+}
+
+// Job returns the stored job, with live progress if it is still running.
+func (m *Manager) Job(id int) (storage.ScanJob, error) {
+	job, err := m.store.GetScanJob(id)
+	if err != nil {
+		return storage.ScanJob{}, err
+	}
+
+	if active := m.active(id); active != nil {
+		if progress := active.output.Snapshot(); len(progress) > 0 {
+			job.Progress = progress
+		}
+	}
+	return job, nil
+}
+
+// Cancel stops a queued or running job, killing the czkawka process if
+// one has been started.
+func (m *Manager) Cancel(id int) error {
+	job, err := m.store.GetScanJob(id)
+	if err != nil {
+		return err
+	}
+	if job.State.Finished() {
+		return ErrFinished
+	}
+
+	active := m.active(id)
+	if active == nil {
+		return m.store.UpdateScanJobState(id, storage.ScanCancelled, "cancelled", job.Progress)
+	}
+	active.cancel()
+	return nil
+}
+
+func (m *Manager) work() {
+	for id := range m.queue {
+		m.run(id)
+		m.prune()
+	}
+}
+
+func (m *Manager) run(id int) {
+	active := m.active(id)
+	defer m.untrack(id)
+
+	if active.ctx.Err() != nil {
+		m.setState(id, storage.ScanCancelled, "cancelled before start", active)
+		return
+	}
+
+	job, err := m.store.GetScanJob(id)
+	if err != nil {
+		log.Printf("error loading scan job %d: %v", id, err)
+		return
+	}
+
+	if err := m.store.StartScanJob(id); err != nil {
+		log.Printf("error: %v", err)
+	}
+
+	groupCount, err := m.execute(active, job)
+	switch {
+	case err != nil && active.ctx.Err() != nil:
+		m.setState(id, storage.ScanCancelled, "cancelled", active)
+	case err != nil:
+		log.Printf("scan job %d failed: %v", id, err)
+		m.setState(id, storage.ScanFailed, err.Error(), active)
+	default:
+		m.setState(id, storage.ScanDone, doneMessage(job.Kind, groupCount), active)
+	}
+}
+
+func doneMessage(kind storage.Kind, count int) string {
+	switch {
+	case count == 0 && kind.Grouped():
+		return "No Duplicates found"
+	case count == 0:
+		return "No files found"
+	}
+	return "Scan successfully done"
+}
+
+func (m *Manager) execute(active *activeJob, job storage.ScanJob) (int, error) {
+	if active.artifact != "" {
+		count, err := m.loadResults(active, job, active.artifact)
+		var parseErr *parseError
+		if errors.As(err, &parseErr) {
+			return 0, fmt.Errorf("import failed: %v", parseErr.err)
+		}
+		return count, err
+	}
+
+	if err := os.MkdirAll(m.scansDir, 0o770); err != nil {
+		return 0, fmt.Errorf("failed to create scans directory: %w", err)
+	}
+
+	var options Options
+	if len(job.Options) > 0 {
+		if err := json.Unmarshal(job.Options, &options); err != nil {
+			return 0, fmt.Errorf("invalid scan options: %w", err)
+		}
+	}
+
+	tempFile, err := os.CreateTemp(m.scansDir, "czkawka-scan-*.json")
+	if err != nil {
+		return 0, fmt.Errorf("failed to create temp file: %w", err)
+	}
+	tempFile.Close()
+
+	// the output is kept as an artifact of the scan until it is pruned
+	if err := m.store.SetScanJobArtifact(job.ID, tempFile.Name()); err != nil {
+		return 0, err
+	}
+
+	scanner, err := m.scanner(job.Kind, options)
+	if err != nil {
+		return 0, err
+	}
+
+	run, runErr := scanner.Scan(active.ctx, job.Kind, job.Directory, options, tempFile.Name(), active.output)
+	active.output.Flush()
+
+	if err := m.store.SetScanJobExit(job.ID, run.Version, run.ExitCode, run.StderrTail); err != nil {
+		log.Printf("error: %v", err)
+	}
+
+	if err := active.ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	count, err := m.loadResults(active, job, tempFile.Name())
+	var parseErr *parseError
+	if errors.As(err, &parseErr) {
+		return 0, fmt.Errorf("scan failed: %s (parse error: %v)", active.output.Tail(), parseErr.err)
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	if runErr != nil {
+		log.Printf("warning: scanner exited with error (%v) but produced valid output", runErr)
+	}
+
+	return count, nil
+}
+
+func (m *Manager) loadResults(active *activeJob, job storage.ScanJob, path string) (int, error) {
+	return loadResults(active.ctx, m.store, job, path, func(state storage.ScanState) {
+		m.setState(job.ID, state, "", active)
+	})
+}
+
+// parseError marks a failure to read czkawka output, as opposed to a
+// failure to store it.
+type parseError struct {
+	err error
+}
+
+func (e *parseError) Error() string {
+	return fmt.Sprintf("parse error: %v", e.err)
+}
+
+// loadResults parses the czkawka output at path and stores it as the
+// result of job, calling onState as it moves on to parsing and loading. It
+// returns the number of groups or findings that were found.
+func loadResults(ctx context.Context, store *storage.Storage, job storage.ScanJob, path string, onState func(storage.ScanState)) (int, error) {
+	onState(storage.ScanParsing)
+
+	if !job.Kind.Grouped() {
+		return loadFindings(store, job, path, onState)
+	}
+
+	// videos are probed before the groups are stored, so that ffprobe
+	// doesn't run while the write transaction is open
+	var videos map[string]storage.VideoMetadata
+	if job.Kind == storage.KindVideo {
+		var err error
+		if videos, err = probeResults(ctx, path); err != nil {
+			return 0, err
+		}
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, &parseError{err}
+	}
+	defer file.Close()
+
+	groups, err := streamGroups(job.Kind, file, videos)
+	if err != nil {
+		return 0, err
+	}
+
+	// an empty result doesn't replace the stored groups
+	next, stop := iter.Pull2(groups)
+	defer stop()
+	first, err, ok := next()
+	if err != nil {
+		return 0, err
+	}
+	if !ok && !job.Merge {
+		return 0, nil
+	}
+
+	onState(storage.ScanLoading)
+
+	count := 0
+	counted := func(yield func(storage.ScanGroup, error) bool) {
+		group, err := first, error(nil)
+		for ok {
+			if err == nil {
+				count++
+			}
+			if !yield(group, err) {
+				return
+			}
+			group, err, ok = next()
+		}
+	}
+
+	var report storage.LoadReport
+	if job.Merge {
+		report, err = store.MergeImageGroups(job.Kind, job.Directory, counted)
+	} else {
+		report, err = store.ReplaceImageGroups(job.Kind, counted)
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	if err := store.SetScanJobResult(job.ID, count, report); err != nil {
+		return 0, err
+	}
+
+	return count, nil
+}
+
+func loadFindings(store *storage.Storage, job storage.ScanJob, path string, onState func(storage.ScanState)) (int, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, &parseError{err}
+	}
+	defer file.Close()
+
+	findings, err := streamFindings(job.Kind, file)
+	if err != nil {
+		return 0, err
+	}
+
+	onState(storage.ScanLoading)
+
+	count := 0
+	counted := func(yield func(storage.ScanFinding, error) bool) {
+		for f, err := range findings {
+			if err == nil {
+				count++
+			}
+			if !yield(f, err) {
+				return
+			}
+		}
+	}
+
+	report, err := store.ReplaceFindings(job.Kind, counted)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := store.SetScanJobResult(job.ID, count, report); err != nil {
+		return 0, err
+	}
+
+	return count, nil
+}
+
+// streamGroups decodes the czkawka output of a scan of kind from r into
+// groups ready to be stored, one group at a time, attaching the metadata of
+// probed videos by path. Decoding errors are yielded as parse errors.
+func streamGroups(kind storage.Kind, r io.Reader, videos map[string]storage.VideoMetadata) (iter.Seq2[storage.ScanGroup, error], error) {
+	switch kind {
+	case storage.KindImage:
+		return convertGroups(loader.StreamImageDuplicates(r), withoutError(imageGroup)), nil
+	case storage.KindFile:
+		return convertGroups(loader.StreamFileDuplicates(r), withoutError(fileGroup)), nil
+	case storage.KindVideo:
+		return convertGroups(loader.StreamVideoDuplicates(r), withoutError(func(group loader.DuplicateVideoGroup) storage.ScanGroup {
+			scanGroup := videoGroup(group)
+			for i, file := range scanGroup.Files {
+				if meta, ok := videos[file.Path]; ok {
+					scanGroup.Files[i].Video = &meta
+				}
+			}
+			return scanGroup
+		})), nil
+	case storage.KindMusic:
+		return convertGroups(loader.StreamMusicDuplicates(r), withoutError(musicGroup)), nil
+	default:
+		return nil, fmt.Errorf("unsupported scan kind %q", kind)
+	}
+}
+
+// convertGroups converts decoded groups with convert, stopping at the first
+// error.
+func convertGroups[T any](groups iter.Seq2[T, error], convert func(T) (storage.ScanGroup, error)) iter.Seq2[storage.ScanGroup, error] {
+	return func(yield func(storage.ScanGroup, error) bool) {
+		for group, err := range groups {
+			if err != nil {
+				yield(storage.ScanGroup{}, &parseError{err})
+				return
+			}
+			scanGroup, err := convert(group)
+			if err != nil {
+				yield(storage.ScanGroup{}, err)
+				return
+			}
+			if !yield(scanGroup, nil) {
+				return
+			}
+		}
+	}
+}
+
+func withoutError[T any](convert func(T) storage.ScanGroup) func(T) (storage.ScanGroup, error) {
+	return func(group T) (storage.ScanGroup, error) {
+		return convert(group), nil
+	}
+}
+
+// streamFindings decodes the czkawka output of a scan of kind from r into
+// findings ready to be stored, one finding at a time. Decoding errors are
+// yielded as parse errors.
+func streamFindings(kind storage.Kind, r io.Reader) (iter.Seq2[storage.ScanFinding, error], error) {
+	switch kind {
+	case storage.KindBroken:
+		return convertFindings(loader.StreamBrokenFiles(r), func(file loader.BrokenFile) storage.ScanFinding {
+			return storage.ScanFinding{
+				Path:         file.Path,
+				Size:         file.Size,
+				ModifiedDate: file.ModifiedDate,
+				ErrorType:    file.TypeOfFile,
+				ErrorMessage: file.ErrorString,
+			}
+		}), nil
+	case storage.KindBig, storage.KindEmptyFiles, storage.KindTemp:
+		return convertFindings(loader.StreamFileEntries(r), func(file loader.FileEntry) storage.ScanFinding {
+			return storage.ScanFinding{
+				Path:         file.Path,
+				Size:         file.Size,
+				ModifiedDate: file.ModifiedDate,
+			}
+		}), nil
+	case storage.KindSymlinks:
+		return convertFindings(loader.StreamInvalidSymlinks(r), func(link loader.SymlinkEntry) storage.ScanFinding {
+			return storage.ScanFinding{
+				Path:         link.Path,
+				Size:         link.Size,
+				ModifiedDate: link.ModifiedDate,
+				ErrorType:    link.SymlinkInfo.TypeOfError,
+				Target:       link.SymlinkInfo.DestinationPath,
+			}
+		}), nil
+	case storage.KindExtensions:
+		return convertFindings(loader.StreamBadExtensions(r), func(file loader.BadExtensionEntry) storage.ScanFinding {
+			return storage.ScanFinding{
+				Path:            file.Path,
+				Size:            file.Size,
+				ModifiedDate:    file.ModifiedDate,
+				ErrorMessage:    file.ProperExtensionsGroup,
+				ProperExtension: file.ProperExtension,
+			}
+		}), nil
+	case storage.KindEmptyFolders:
+		return convertFindings(loader.StreamEmptyFolders(r), func(folder loader.FolderEntry) storage.ScanFinding {
+			return storage.ScanFinding{
+				Path:         folder.Path,
+				ModifiedDate: folder.ModifiedDate,
+			}
+		}), nil
+	default:
+		return nil, fmt.Errorf("unsupported scan kind %q", kind)
+	}
+}
+
+// convertFindings converts decoded entries with convert, stopping at the
+// first error.
+func convertFindings[T any](entries iter.Seq2[T, error], convert func(T) storage.ScanFinding) iter.Seq2[storage.ScanFinding, error] {
+	return func(yield func(storage.ScanFinding, error) bool) {
+		for entry, err := range entries {
+			if err != nil {
+				yield(storage.ScanFinding{}, &parseError{err})
+				return
+			}
+			if !yield(convert(entry), nil) {
+				return
+			}
+		}
+	}
+}
+
+func imageGroup(group loader.DuplicateImageGroup) storage.ScanGroup {
+	hashJSON, _ := json.Marshal(group.Hash)
+
+	files := make([]storage.ScanFile, 0, len(group.Images))
+	for _, image := range group.Images {
+		files = append(files, storage.ScanFile{
+			Path:         image.Path,
+			Size:         image.Size,
+			ModifiedDate: image.ModifiedDate,
+			Image: &storage.ImageMetadata{
+				Width:      image.Width,
+				Height:     image.Height,
+				Similarity: image.Similarity,
+				Hash:       hexHash(image.Hash),
+			},
+		})
+	}
+
+	return storage.ScanGroup{
+		Hash:  string(hashJSON),
+		Size:  group.Size,
+		Files: files,
+	}
+}
+
+// hexHash encodes the bytes of a czkawka hash as hex.
+func hexHash(hash []int) string {
+	b := make([]byte, len(hash))
+	for i, v := range hash {
+		b[i] = byte(v)
+	}
+	return hex.EncodeToString(b)
+}
+
+func (m *Manager) setState(id int, state storage.ScanState, message string, active *activeJob) {
+	if err := m.store.UpdateScanJobState(id, state, message, active.output.Snapshot()); err != nil {
+		log.Printf("error: %v", err)
+	}
+}
+
+func (m *Manager) active(id int) *activeJob {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.jobs[id]
+}
+
+func (m *Manager) untrack(id int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if active, ok := m.jobs[id]; ok {
+		active.cancel()
+		active.held.Release()
+		delete(m.jobs, id)
+	}
+}
+
+func fileGroup(group loader.DuplicateFileGroup) storage.ScanGroup {
+	hashJSON, _ := json.Marshal(group.Hash)
+
+	files := make([]storage.ScanFile, 0, len(group.Files))
+	for _, file := range group.Files {
+		files = append(files, storage.ScanFile{
+			Path:         file.Path,
+			Size:         file.Size,
+			ModifiedDate: file.ModifiedDate,
+		})
+	}
+
+	return storage.ScanGroup{
+		Hash:  string(hashJSON),
+		Size:  group.Size,
+		Files: files,
+	}
+}
+
+func videoGroup(group loader.DuplicateVideoGroup) storage.ScanGroup {
+	hashJSON, _ := json.Marshal(group.Hash)
+
+	files := make([]storage.ScanFile, 0, len(group.Files))
+	for _, file := range group.Files {
+		files = append(files, storage.ScanFile{
+			Path:         file.Path,
+			Size:         file.Size,
+			ModifiedDate: file.ModifiedDate,
+		})
+	}
+
+	return storage.ScanGroup{
+		Hash:  string(hashJSON),
+		Size:  group.Size,
+		Files: files,
+	}
+}
+
+func musicGroup(group loader.DuplicateMusicGroup) storage.ScanGroup {
+	hashJSON, _ := json.Marshal(group.Hash)
+
+	files := make([]storage.ScanFile, 0, len(group.Files))
+	for _, file := range group.Files {
+		files = append(files, storage.ScanFile{
+			Path:         file.Path,
+			Size:         file.Size,
+			ModifiedDate: file.ModifiedDate,
+			Music: &storage.MusicTags{
+				Artist:  file.TrackArtist,
+				Title:   file.TrackTitle,
+				Album:   file.Album,
+				Year:    file.Year,
+				Bitrate: file.Bitrate,
+				Length:  file.Length,
+				Genre:   file.Genre,
+			},
+		})
+	}
+
+	return storage.ScanGroup{
+		Hash:  string(hashJSON),
+		Size:  group.Size,
+		Files: files,
+	}
+}
+
+// probeResults runs ffprobe on the videos in the czkawka output at path,
+// returning their metadata by path. Videos are stored without metadata if
+// ffprobe is not installed.
+func probeResults(ctx context.Context, path string) (map[string]storage.VideoMetadata, error) {
+	if !ffprobeAvailable() {
+		log.Print("ffprobe is not installed, storing videos without metadata")
+		return nil, nil
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, &parseError{err}
+	}
+	defer file.Close()
+
+	videos := make(map[string]storage.VideoMetadata)
+	for group, err := range loader.StreamVideoDuplicates(file) {
+		if err != nil {
+			return nil, &parseError{err}
+		}
+
+		for _, video := range group.Files {
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+
+			meta, err := probeVideo(ctx, video.Path)
+			if err != nil {
+				log.Printf("warning: could not probe video %s: %v", video.Path, err)
+				continue
+			}
+			videos[video.Path] = meta
+		}
+	}
+	return videos, nil
+}
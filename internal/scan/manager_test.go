@@ -0,0 +1,253 @@
+package scan
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fadykuzman/schluckauf/internal/operation"
+	"github.com/fadykuzman/schluckauf/internal/storage"
+)
+
+// fakeScanner reports its start on started, then writes output as its
+// results once released, or fails when cancelled.
+type fakeScanner struct {
+	output  string
+	err     error
+	started chan struct{}
+	release chan struct{}
+}
+
+func (f *fakeScanner) Check(storage.Kind, Options) error {
+	return nil
+}
+
+func (f *fakeScanner) Scan(ctx context.Context, kind storage.Kind, directory string, options Options, output string, progress io.Writer) (Run, error) {
+	fmt.Fprintln(progress, "Stage 1/1: scanning 1/2 files")
+	f.started <- struct{}{}
+
+	select {
+	case <-f.release:
+	case <-ctx.Done():
+		return Run{Version: "fake", ExitCode: -1}, ctx.Err()
+	}
+	if err := os.WriteFile(output, []byte(f.output), 0o644); err != nil {
+		return Run{}, err
+	}
+	if f.err != nil {
+		return Run{Version: "fake", ExitCode: 1, StderrTail: f.err.Error()}, f.err
+	}
+	return Run{Version: "fake"}, nil
+}
+
+// newTestManager returns a Manager running scans with a fake scanner that
+// writes output, on a new database holding one group of files.
+func newTestManager(t *testing.T, output string) (*Manager, *storage.Storage, *fakeScanner) {
+	t.Helper()
+
+	store, err := storage.New(filepath.Join(t.TempDir(), "db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { store.Close() })
+
+	_, err = store.ReplaceImageGroups(storage.KindFile, func(yield func(storage.ScanGroup, error) bool) {
+		yield(storage.ScanGroup{Hash: "old", Size: 1, Files: []storage.ScanFile{
+			{Path: "/old/a", Size: 1},
+			{Path: "/old/b", Size: 1},
+		}}, nil)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m, err := NewManager(store, t.TempDir(), Retention{}, ScannerNative, &operation.Lock{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	scanner := &fakeScanner{output: output, started: make(chan struct{}, 1), release: make(chan struct{})}
+	m.scanners[ScannerNative] = scanner
+	return m, store, scanner
+}
+
+// waitJob waits for job id to finish and release the operation lock.
+func waitJob(t *testing.T, m *Manager, id int) storage.ScanJob {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		job, err := m.Job(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, locked := m.lock.Running()
+		if job.State.Finished() && !locked {
+			return job
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("job %d still %s, holding the lock: %v", id, job.State, locked)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// storedSizes returns the sizes of the stored file groups.
+func storedSizes(t *testing.T, store *storage.Storage) []int64 {
+	t.Helper()
+
+	page, err := store.ListImageGroups(storage.GroupFilter{Kind: storage.KindFile})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var sizes []int64
+	for _, group := range page.Groups {
+		sizes = append(sizes, group.Size)
+	}
+	return sizes
+}
+
+func TestManagerRunsJob(t *testing.T) {
+	m, store, scanner := newTestManager(t, `{"5": [[
+		{"path": "/new/a", "size": 5, "hash": "new"},
+		{"path": "/new/b", "size": 5, "hash": "new"}
+	]]}`)
+
+	job, err := m.Submit(storage.KindFile, "/new", Options{}, false, "tester")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job.State != storage.ScanQueued && job.State != storage.ScanRunning {
+		t.Errorf("submitted job = %s, want queued or running", job.State)
+	}
+
+	<-scanner.started
+	if job, err = m.Job(job.ID); err != nil {
+		t.Fatal(err)
+	}
+	if job.State != storage.ScanRunning || job.StartedAt == nil || len(job.Progress) == 0 {
+		t.Errorf("started job = %s with progress %v, want running with progress", job.State, job.Progress)
+	}
+	if op, ok := m.lock.Running(); !ok || op.Kind != operation.Scan || op.JobID == nil || *op.JobID != job.ID {
+		t.Errorf("operation = %+v, want the scan of job %d", op, job.ID)
+	}
+	if _, err := m.Submit(storage.KindFile, "/new", Options{}, false, "tester"); !errors.Is(err, operation.ErrBusy) {
+		t.Errorf("Submit while running = %v, want %v", err, operation.ErrBusy)
+	}
+
+	close(scanner.release)
+	job = waitJob(t, m, job.ID)
+	if job.State != storage.ScanDone || job.GroupCount != 1 || job.CzkawkaVersion != "fake" || job.FinishedAt == nil {
+		t.Errorf("finished job = %+v, want done with one group", job)
+	}
+	if sizes := storedSizes(t, store); len(sizes) != 1 || sizes[0] != 10 {
+		t.Errorf("stored group sizes = %v, want the new group", sizes)
+	}
+	if err := m.Cancel(job.ID); !errors.Is(err, ErrFinished) {
+		t.Errorf("Cancel of a finished job = %v, want %v", err, ErrFinished)
+	}
+}
+
+func TestManagerCancelKeepsGroups(t *testing.T) {
+	m, store, scanner := newTestManager(t, "")
+
+	job, err := m.Submit(storage.KindFile, "/new", Options{}, false, "tester")
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-scanner.started
+	if err := m.Cancel(job.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	job = waitJob(t, m, job.ID)
+	if job.State != storage.ScanCancelled {
+		t.Errorf("cancelled job = %s %q, want cancelled", job.State, job.Message)
+	}
+	if sizes := storedSizes(t, store); len(sizes) != 1 || sizes[0] != 2 {
+		t.Errorf("stored group sizes = %v, want the previous group", sizes)
+	}
+}
+
+func TestManagerFailedScanKeepsGroups(t *testing.T) {
+	m, store, scanner := newTestManager(t, "not json")
+	scanner.err = errors.New("exit status 1")
+	close(scanner.release)
+
+	job, err := m.Submit(storage.KindFile, "/new", Options{}, false, "tester")
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-scanner.started
+
+	job = waitJob(t, m, job.ID)
+	if job.State != storage.ScanFailed || job.ExitCode == nil || *job.ExitCode != 1 {
+		t.Errorf("failed job = %+v, want failed with exit code 1", job)
+	}
+	if sizes := storedSizes(t, store); len(sizes) != 1 || sizes[0] != 2 {
+		t.Errorf("stored group sizes = %v, want the previous group", sizes)
+	}
+}
+
+func TestNewManagerFailsInterruptedJobs(t *testing.T) {
+	store, err := storage.New(filepath.Join(t.TempDir(), "db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+
+	id, err := store.CreateScanJob(storage.KindImage, "/photos", nil, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.StartScanJob(id); err != nil {
+		t.Fatal(err)
+	}
+
+	m, err := NewManager(store, t.TempDir(), Retention{}, ScannerNative, &operation.Lock{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	job, err := m.Job(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job.State != storage.ScanFailed {
+		t.Errorf("interrupted job = %s, want failed", job.State)
+	}
+}
+
+func TestManagerFindingsParseErrorKeepsFindings(t *testing.T) {
+	m, store, scanner := newTestManager(t, `[{"path": "/new.tmp", "size": 1}, {"path": `)
+	close(scanner.release)
+
+	_, err := store.ReplaceFindings(storage.KindTemp, func(yield func(storage.ScanFinding, error) bool) {
+		yield(storage.ScanFinding{Path: "/old.tmp", Size: 1}, nil)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	job, err := m.Submit(storage.KindTemp, "/new", Options{}, false, "tester")
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-scanner.started
+
+	job = waitJob(t, m, job.ID)
+	if job.State != storage.ScanFailed || !strings.Contains(job.Message, "parse error") {
+		t.Errorf("job = %s %q, want failed with a parse error", job.State, job.Message)
+	}
+	page, err := store.ListFindings(storage.FindingFilter{Kind: storage.KindTemp})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page.Findings) != 1 || page.Findings[0].Path != "/old.tmp" {
+		t.Errorf("stored findings = %+v, want the previous finding", page.Findings)
+	}
+}
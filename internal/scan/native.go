@@ -0,0 +1,354 @@
+package scan
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"image"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+
+	_ "golang.org/x/image/webp"
+
+	"github.com/fadykuzman/schluckauf/internal/imagehash"
+	"github.com/fadykuzman/schluckauf/internal/loader"
+	"github.com/fadykuzman/schluckauf/internal/storage"
+)
+
+const nativeVersion = "schluckauf native"
+
+// nativeExtensions are the image types the native scanner decodes.
+var nativeExtensions = []string{"jpg", "jpeg", "png", "gif", "webp"}
+
+// maxDistances maps the czkawka similarity presets to the Hamming distance
+// they allow between 64 bit hashes, like czkawka does for its 8x8 hashes.
+var maxDistances = map[string]int{
+	"Original":  0,
+	"VeryHigh":  1,
+	"High":      2,
+	"Medium":    5,
+	"Small":     7,
+	"VerySmall": 14,
+	"Minimal":   20,
+}
+
+const defaultMaxDistance = 5
+
+// nativeScanner runs image and duplicate file scans without czkawka. It
+// finds similar images by comparing perceptual hashes and duplicate files
+// by comparing sizes, then hashes of their first and last blocks, then
+// hashes of their whole content.
+type nativeScanner struct{}
+
+func (nativeScanner) Check(kind storage.Kind, options Options) error {
+	switch kind {
+	case storage.KindImage:
+		switch {
+		case options.HashAlgorithm != "":
+			return fmt.Errorf("hashAlgorithm is not supported by the native scanner, use perceptualHash")
+		case options.HashSize != 0 && options.HashSize != 8:
+			return fmt.Errorf("the native scanner only supports hashSize 8")
+		case options.ResizeFilter != "":
+			return fmt.Errorf("resizeFilter is not supported by the native scanner")
+		}
+	case storage.KindFile:
+		if options.HashType != "" {
+			return fmt.Errorf("hashType is not supported by the native scanner, which uses SHA-256")
+		}
+	default:
+		return fmt.Errorf("the native scanner only supports image and file scans")
+	}
+	return nil
+}
+
+func (nativeScanner) Scan(ctx context.Context, kind storage.Kind, directory string, options Options, output string, progress io.Writer) (Run, error) {
+	var run Run
+	var err error
+	if kind == storage.KindFile {
+		run, err = scanFiles(ctx, directory, options, output, progress)
+	} else {
+		run, err = scanImages(ctx, directory, options, output, progress)
+	}
+	if err != nil {
+		run.ExitCode = 1
+	}
+	return run, err
+}
+
+// nativeImage is an image found by the native scanner, with its hash once
+// it has been decoded.
+type nativeImage struct {
+	info loader.ImageInfo
+	hash imagehash.Hash
+	err  error
+}
+
+// scanImages groups the images under directory whose perceptual hashes are
+// close.
+func scanImages(ctx context.Context, directory string, options Options, output string, progress io.Writer) (Run, error) {
+	algorithm := imagehash.DHash
+	if options.PerceptualHash != "" {
+		algorithm = imagehash.Algorithm(options.PerceptualHash)
+	}
+	run := Run{Version: nativeVersion + " (" + string(algorithm) + ")"}
+
+	maxDistance := defaultMaxDistance
+	if d, ok := maxDistances[options.SimilarityPreset]; ok {
+		maxDistance = d
+	}
+	if options.MaxDistance != nil {
+		maxDistance = *options.MaxDistance
+	}
+
+	fmt.Fprintf(progress, "Stage 1/3: collecting images in %s\n", directory)
+	images, err := collectImages(ctx, directory, options)
+	if err != nil {
+		return run, err
+	}
+	fmt.Fprintf(progress, "Stage 1/3: collected %d images\n", len(images))
+
+	hashImages(ctx, images, algorithm, progress)
+	if err := ctx.Err(); err != nil {
+		return run, err
+	}
+
+	var skipped []string
+	var hashed []*nativeImage
+	for i := range images {
+		if images[i].err != nil {
+			skipped = append(skipped, images[i].err.Error())
+			continue
+		}
+		hashed = append(hashed, &images[i])
+	}
+	if len(skipped) > 0 {
+		fmt.Fprintf(progress, "warning: skipped %d images that could not be decoded\n", len(skipped))
+		run.StderrTail = strings.Join(skipped[max(0, len(skipped)-progressTail):], "\n")
+	}
+
+	// the largest images become the references of their groups, like in
+	// czkawka
+	slices.SortStableFunc(hashed, func(a, b *nativeImage) int {
+		return cmp.Compare(b.info.Width*b.info.Height, a.info.Width*a.info.Height)
+	})
+
+	fmt.Fprintf(progress, "Stage 3/3: comparing %d hashes\n", len(hashed))
+	hashes := make([]imagehash.Hash, len(hashed))
+	for i, img := range hashed {
+		hashes[i] = img.hash
+	}
+
+	groups := [][]loader.ImageInfo{}
+	for _, cluster := range imagehash.Cluster(hashes, maxDistance) {
+		group := make([]loader.ImageInfo, 0, len(cluster))
+		for _, member := range cluster {
+			info := hashed[member.Index].info
+			info.Similarity = float64(member.Distance)
+			group = append(group, info)
+		}
+		groups = append(groups, group)
+	}
+	fmt.Fprintf(progress, "Found %d groups of similar images\n", len(groups))
+
+	data, err := json.Marshal(groups)
+	if err != nil {
+		return run, err
+	}
+	if err := os.WriteFile(output, data, 0o660); err != nil {
+		return run, fmt.Errorf("failed to write results: %w", err)
+	}
+	return run, nil
+}
+
+// collectImages walks directory for the images to hash.
+func collectImages(ctx context.Context, directory string, options Options) ([]nativeImage, error) {
+	extensions := nativeExtensions
+	if len(options.AllowedExtensions) > 0 {
+		extensions = nil
+		for _, ext := range options.AllowedExtensions {
+			ext = strings.ToLower(strings.TrimPrefix(ext, "."))
+			if slices.Contains(nativeExtensions, ext) {
+				extensions = append(extensions, ext)
+			}
+		}
+	}
+
+	var images []nativeImage
+	err := walkFiles(ctx, directory, options, extensions, func(path string, info fs.FileInfo) {
+		images = append(images, nativeImage{info: loader.ImageInfo{
+			Path:         path,
+			Size:         info.Size(),
+			ModifiedDate: info.ModTime().Unix(),
+		}})
+	})
+	return images, err
+}
+
+// walkFiles calls found for the regular files under directory with one of
+// extensions, or any extension if there are none, honouring the size and
+// exclusion options. Symlinks are not followed.
+func walkFiles(ctx context.Context, directory string, options Options, extensions []string, found func(path string, info fs.FileInfo)) error {
+	root, err := filepath.Abs(directory)
+	if err != nil {
+		return err
+	}
+
+	return filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err != nil {
+			// unreadable directories are skipped, like czkawka does
+			if d != nil && d.IsDir() && path != root {
+				return fs.SkipDir
+			}
+			return nil
+		}
+
+		if d.IsDir() {
+			if path != root && (excludedDirectory(path, options.ExcludedDirectories) || excludedItem(path, options.ExcludedItems)) {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() || excludedItem(path, options.ExcludedItems) {
+			return nil
+		}
+
+		if len(extensions) > 0 {
+			ext := strings.ToLower(strings.TrimPrefix(filepath.Ext(path), "."))
+			if !slices.Contains(extensions, ext) {
+				return nil
+			}
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		if info.Size() < options.MinFileSize || (options.MaxFileSize != 0 && info.Size() > options.MaxFileSize) {
+			return nil
+		}
+
+		found(path, info)
+		return nil
+	})
+}
+
+func excludedDirectory(path string, excluded []string) bool {
+	for _, dir := range excluded {
+		if path == filepath.Clean(dir) {
+			return true
+		}
+	}
+	return false
+}
+
+// excludedItem reports whether path matches one of patterns, with
+// czkawka's wildcards: * stands for any characters, including separators,
+// so that */.git/* excludes everything within .git directories, and all
+// other characters stand for themselves.
+func excludedItem(path string, patterns []string) bool {
+	for _, pattern := range patterns {
+		if matchWildcard(pattern, path) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchWildcard(pattern, s string) bool {
+	// p and i are the positions in pattern and s; star is the position in
+	// pattern after the last * seen and from where in s it took over, to go
+	// back to when a literal part doesn't match
+	p, i := 0, 0
+	star, from := -1, 0
+	for i < len(s) {
+		switch {
+		case p < len(pattern) && pattern[p] == '*':
+			p++
+			star, from = p, i
+		case p < len(pattern) && pattern[p] == s[i]:
+			p++
+			i++
+		case star >= 0:
+			from++
+			p, i = star, from
+		default:
+			return false
+		}
+	}
+	for p < len(pattern) && pattern[p] == '*' {
+		p++
+	}
+	return p == len(pattern)
+}
+
+// hashImages decodes and hashes images on all CPUs, setting their hash
+// and dimensions or the error that prevented it.
+func hashImages(ctx context.Context, images []nativeImage, algorithm imagehash.Algorithm, progress io.Writer) {
+	parallel(ctx, len(images), func(i int) {
+		hashImage(&images[i], algorithm)
+	}, func(done int) {
+		fmt.Fprintf(progress, "Stage 2/3: hashed %d/%d images\n", done, len(images))
+	})
+}
+
+// parallel calls fn for 0 to n-1 on a worker per CPU until ctx is done,
+// reporting every hundredth and the last call done to onProgress.
+func parallel(ctx context.Context, n int, fn func(i int), onProgress func(done int)) {
+	var next, done atomic.Int64
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+
+	for range min(runtime.NumCPU(), max(n, 1)) {
+		wg.Go(func() {
+			for ctx.Err() == nil {
+				i := int(next.Add(1)) - 1
+				if i >= n {
+					return
+				}
+				fn(i)
+
+				if d := int(done.Add(1)); d%100 == 0 || d == n {
+					mu.Lock()
+					onProgress(d)
+					mu.Unlock()
+				}
+			}
+		})
+	}
+	wg.Wait()
+}
+
+func hashImage(img *nativeImage, algorithm imagehash.Algorithm) {
+	file, err := os.Open(img.info.Path)
+	if err != nil {
+		img.err = err
+		return
+	}
+	defer file.Close()
+
+	decoded, _, err := image.Decode(file)
+	if err != nil {
+		img.err = fmt.Errorf("%s: %w", img.info.Path, err)
+		return
+	}
+
+	img.hash, img.err = imagehash.Compute(decoded, algorithm)
+	img.info.Hash = img.hash.Bytes()
+	img.info.Width = decoded.Bounds().Dx()
+	img.info.Height = decoded.Bounds().Dy()
+}
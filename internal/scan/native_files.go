@@ -0,0 +1,220 @@
+package scan
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/fadykuzman/schluckauf/internal/loader"
+)
+
+// partialSize is the size of the blocks at the start and the end of files
+// compared before hashing them whole. Files up to twice as big are hashed
+// whole right away.
+const partialSize = 16 << 10
+
+// fileKey identifies a file on disk, shared by its hardlinks.
+type fileKey struct {
+	device, inode uint64
+}
+
+// nativeFile is a file found by the native scanner, with the hashes
+// computed so far.
+type nativeFile struct {
+	info    loader.FileInfo
+	partial string
+	err     error
+}
+
+// scanFiles groups the files under directory with the same content.
+// Candidates are narrowed down by size, then by a hash of their first and
+// last blocks, before their whole content is hashed with SHA-256.
+func scanFiles(ctx context.Context, directory string, options Options, output string, progress io.Writer) (Run, error) {
+	run := Run{Version: nativeVersion + " (sha256)"}
+
+	fmt.Fprintf(progress, "Stage 1/3: collecting files in %s\n", directory)
+	bySize, count, err := collectFiles(ctx, directory, options)
+	if err != nil {
+		return run, err
+	}
+
+	var candidates []*nativeFile
+	for _, files := range bySize {
+		if len(files) > 1 {
+			candidates = append(candidates, files...)
+		}
+	}
+	fmt.Fprintf(progress, "Stage 1/3: collected %d files, %d with the same size as another\n", count, len(candidates))
+
+	// files too small to have separate blocks are hashed whole right away
+	var partial []*nativeFile
+	for _, file := range candidates {
+		if file.info.Size > 2*partialSize {
+			partial = append(partial, file)
+		}
+	}
+	parallel(ctx, len(partial), func(i int) {
+		partial[i].partial, partial[i].err = hashBlocks(partial[i].info.Path, partial[i].info.Size)
+	}, func(done int) {
+		fmt.Fprintf(progress, "Stage 2/3: hashed the first and last blocks of %d/%d files\n", done, len(partial))
+	})
+	if err := ctx.Err(); err != nil {
+		return run, err
+	}
+
+	var full []*nativeFile
+	for _, group := range groupFiles(candidates, func(f *nativeFile) string {
+		return strconv.FormatInt(f.info.Size, 10) + ":" + f.partial
+	}) {
+		full = append(full, group...)
+	}
+	parallel(ctx, len(full), func(i int) {
+		full[i].info.Hash, full[i].err = hashFile(full[i].info.Path)
+	}, func(done int) {
+		fmt.Fprintf(progress, "Stage 3/3: hashed %d/%d files\n", done, len(full))
+	})
+	if err := ctx.Err(); err != nil {
+		return run, err
+	}
+
+	// czkawka groups duplicates by size first
+	results := loader.CzkawkaFileOutput{}
+	groups := 0
+	for _, group := range groupFiles(full, func(f *nativeFile) string { return f.info.Hash }) {
+		files := make([]loader.FileInfo, 0, len(group))
+		for _, file := range group {
+			files = append(files, file.info)
+		}
+		slices.SortFunc(files, func(a, b loader.FileInfo) int { return strings.Compare(a.Path, b.Path) })
+
+		size := strconv.FormatInt(files[0].Size, 10)
+		results[size] = append(results[size], files)
+		groups++
+	}
+
+	var skipped []string
+	for _, file := range candidates {
+		if file.err != nil {
+			skipped = append(skipped, file.err.Error())
+		}
+	}
+	if len(skipped) > 0 {
+		fmt.Fprintf(progress, "warning: skipped %d files that could not be read\n", len(skipped))
+		run.StderrTail = strings.Join(skipped[max(0, len(skipped)-progressTail):], "\n")
+	}
+	fmt.Fprintf(progress, "Found %d groups of duplicate files\n", groups)
+
+	data, err := json.Marshal(results)
+	if err != nil {
+		return run, err
+	}
+	if err := os.WriteFile(output, data, 0o660); err != nil {
+		return run, fmt.Errorf("failed to write results: %w", err)
+	}
+	return run, nil
+}
+
+// collectFiles walks directory for the files to compare, by size. Empty
+// files are left out, and so are hardlinks to a file that was already
+// found, which share its content without taking more space.
+func collectFiles(ctx context.Context, directory string, options Options) (map[int64][]*nativeFile, int, error) {
+	bySize := make(map[int64][]*nativeFile)
+	seen := make(map[fileKey]bool)
+	count := 0
+
+	err := walkFiles(ctx, directory, options, allowedExtensions(options), func(path string, info fs.FileInfo) {
+		if info.Size() == 0 {
+			return
+		}
+		if key, ok := fileID(info); ok {
+			if seen[key] {
+				return
+			}
+			seen[key] = true
+		}
+
+		bySize[info.Size()] = append(bySize[info.Size()], &nativeFile{info: loader.FileInfo{
+			Path:         path,
+			Size:         info.Size(),
+			ModifiedDate: info.ModTime().Unix(),
+		}})
+		count++
+	})
+	return bySize, count, err
+}
+
+func allowedExtensions(options Options) []string {
+	var extensions []string
+	for _, ext := range options.AllowedExtensions {
+		extensions = append(extensions, strings.ToLower(strings.TrimPrefix(ext, ".")))
+	}
+	return extensions
+}
+
+// groupFiles groups the readable files by key, keeping the groups of two or
+// more.
+func groupFiles(files []*nativeFile, key func(*nativeFile) string) [][]*nativeFile {
+	byKey := make(map[string][]*nativeFile)
+	var keys []string
+	for _, file := range files {
+		if file.err != nil {
+			continue
+		}
+		k := key(file)
+		if _, ok := byKey[k]; !ok {
+			keys = append(keys, k)
+		}
+		byKey[k] = append(byKey[k], file)
+	}
+
+	var groups [][]*nativeFile
+	for _, k := range keys {
+		if len(byKey[k]) > 1 {
+			groups = append(groups, byKey[k])
+		}
+	}
+	return groups
+}
+
+// hashBlocks hashes the first and last partialSize bytes of the file at
+// path, which is size bytes long.
+func hashBlocks(path string, size int64) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	h := sha256.New()
+	buf := make([]byte, partialSize)
+	for _, offset := range []int64{0, size - partialSize} {
+		if _, err := file.ReadAt(buf, offset); err != nil {
+			return "", fmt.Errorf("%s: %w", path, err)
+		}
+		h.Write(buf)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// hashFile returns the SHA-256 of the content of the file at path.
+func hashFile(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, file); err != nil {
+		return "", fmt.Errorf("%s: %w", path, err)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
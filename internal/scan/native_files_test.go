@@ -0,0 +1,130 @@
+package scan
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/fadykuzman/schluckauf/internal/loader"
+)
+
+func TestScanFiles(t *testing.T) {
+	dir := t.TempDir()
+	big := content(3*partialSize, 'a')
+	middle := content(3*partialSize, 'a')
+	middle[len(middle)/2]++
+
+	write(t, dir, "big.bin", big)
+	write(t, dir, "copies/big.bin", big)
+	write(t, dir, "middle.bin", middle)
+	write(t, dir, "small.txt", []byte("small"))
+	write(t, dir, "copies/small.txt", []byte("small"))
+	write(t, dir, "other.txt", []byte("other"))
+	write(t, dir, "empty.txt", nil)
+	write(t, dir, "copies/empty.txt", nil)
+	write(t, dir, "excluded/big.bin", big)
+	write(t, dir, "a/skipped/small.txt", []byte("small"))
+	write(t, dir, "copies/small.tmp", []byte("small"))
+
+	if a, err := hashBlocks(filepath.Join(dir, "big.bin"), int64(len(big))); err != nil {
+		t.Fatal(err)
+	} else if b, err := hashBlocks(filepath.Join(dir, "middle.bin"), int64(len(middle))); err != nil {
+		t.Fatal(err)
+	} else if a != b {
+		t.Fatalf("files differing in the middle have different block hashes")
+	}
+
+	got := scanGroups(t, dir, Options{
+		ExcludedDirectories: []string{filepath.Join(dir, "excluded")},
+		ExcludedItems:       []string{"*/skipped/*", "*.tmp"},
+	})
+	want := [][]string{
+		{filepath.Join(dir, "big.bin"), filepath.Join(dir, "copies/big.bin")},
+		{filepath.Join(dir, "copies/small.txt"), filepath.Join(dir, "small.txt")},
+	}
+	if !slices.EqualFunc(got, want, slices.Equal) {
+		t.Errorf("groups = %v, want %v", got, want)
+	}
+}
+
+func TestScanFilesHardlinks(t *testing.T) {
+	dir := t.TempDir()
+	data := content(3*partialSize, 'h')
+	write(t, dir, "a.bin", data)
+	if err := os.Link(filepath.Join(dir, "a.bin"), filepath.Join(dir, "b.bin")); err != nil {
+		t.Skipf("hardlinks not supported: %v", err)
+	}
+	info, err := os.Stat(filepath.Join(dir, "a.bin"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := fileID(info); !ok {
+		t.Skip("file IDs not supported")
+	}
+
+	if got := scanGroups(t, dir, Options{}); len(got) != 0 {
+		t.Errorf("groups = %v, want hardlinks counted once", got)
+	}
+
+	write(t, dir, "c.bin", data)
+	got := scanGroups(t, dir, Options{})
+	if len(got) != 1 || len(got[0]) != 2 || !slices.Contains(got[0], filepath.Join(dir, "c.bin")) {
+		t.Errorf("groups = %v, want the copy and one of the hardlinks", got)
+	}
+}
+
+// scanGroups scans dir and returns the paths of each group, sorted.
+func scanGroups(t *testing.T, dir string, options Options) [][]string {
+	t.Helper()
+
+	output := filepath.Join(t.TempDir(), "results.json")
+	if _, err := scanFiles(context.Background(), dir, options, output, io.Discard); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var results loader.CzkawkaFileOutput
+	if err := json.Unmarshal(data, &results); err != nil {
+		t.Fatal(err)
+	}
+
+	var groups [][]string
+	for _, sized := range results {
+		for _, group := range sized {
+			var paths []string
+			for _, file := range group {
+				paths = append(paths, file.Path)
+			}
+			groups = append(groups, paths)
+		}
+	}
+	slices.SortFunc(groups, func(a, b []string) int { return strings.Compare(a[0], b[0]) })
+	return groups
+}
+
+func content(size int, fill byte) []byte {
+	data := make([]byte, size)
+	for i := range data {
+		data[i] = fill + byte(i%7)
+	}
+	return data
+}
+
+func write(t *testing.T, dir, name string, data []byte) {
+	t.Helper()
+
+	path := filepath.Join(dir, name)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,107 @@
+package scan
+
+import (
+	"image"
+	"image/color"
+	"testing"
+
+	"github.com/fadykuzman/schluckauf/internal/imagehash"
+)
+
+func TestExcludedItem(t *testing.T) {
+	tests := []struct {
+		pattern string
+		path    string
+		want    bool
+	}{
+		{"*.tmp", "/photos/x/file.tmp", true},
+		{"*.tmp", "/photos/x/file.tmp.jpg", false},
+		{"*/.git/*", "/photos/a/.git/config", true},
+		{"*/.git/*", "/photos/a/.github/config", false},
+		{"*/cache/*", "/photos/a/cache/b/c.jpg", true},
+		{"*/cache/*", "/photos/a/cached/c.jpg", false},
+		{"/photos/a/*", "/photos/a/b/c.jpg", true},
+		{"/photos/a/*", "/photos/ab/c.jpg", false},
+		{"*", "/photos/a.jpg", true},
+		{"*a*b*c*", "/xaxbxc", true},
+		{"*a*b*c*", "/xcxbxa", false},
+		{"/photos/a.jpg", "/photos/a.jpg", true},
+		{"/photos/a.jpg", "/photos/a.jpg.bak", false},
+		// only * is a wildcard
+		{"/photos/?.jpg", "/photos/a.jpg", false},
+		{"/photos/[a].jpg", "/photos/[a].jpg", true},
+	}
+	for _, tt := range tests {
+		if got := excludedItem(tt.path, []string{tt.pattern}); got != tt.want {
+			t.Errorf("excludedItem(%q, %q) = %v, want %v", tt.path, tt.pattern, got, tt.want)
+		}
+	}
+
+	if excludedItem("/photos/a.jpg", nil) {
+		t.Errorf("excludedItem without patterns = true, want false")
+	}
+}
+
+func TestResizedCopyWithinDefaultDistance(t *testing.T) {
+	original := testPattern(256, 192)
+	resized := resize(original, 100, 75)
+
+	for _, algorithm := range imagehash.Algorithms {
+		a, err := imagehash.Compute(original, algorithm)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := imagehash.Compute(resized, algorithm)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if d := a.Distance(b); d > defaultMaxDistance {
+			t.Errorf("%s distance of resized copy = %d, want at most %d", algorithm, d, defaultMaxDistance)
+		}
+
+		other, err := imagehash.Compute(testPattern(192, 256), algorithm)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if d := a.Distance(other); d <= defaultMaxDistance {
+			t.Errorf("%s distance of a different image = %d, want more than %d", algorithm, d, defaultMaxDistance)
+		}
+	}
+}
+
+// testPattern draws a gradient with a few shapes depending on the size.
+func testPattern(w, h int) image.Image {
+	img := image.NewGray(image.Rect(0, 0, w, h))
+	for y := range h {
+		for x := range w {
+			v := float64(x)/float64(w)*120 + float64(y)/float64(h)*60
+			if (x-w/3)*(x-w/3)+(y-h/2)*(y-h/2) < (h/4)*(h/4) {
+				v = 240
+			}
+			if x > w*2/3 && y < h/3 {
+				v = 10
+			}
+			img.SetGray(x, y, color.Gray{Y: uint8(v)})
+		}
+	}
+	return img
+}
+
+// resize scales img to w x h, averaging the pixels each one covers.
+func resize(img image.Image, w, h int) image.Image {
+	b := img.Bounds()
+	out := image.NewGray(image.Rect(0, 0, w, h))
+	for y := range h {
+		for x := range w {
+			var sum, n int
+			for sy := y * b.Dy() / h; sy < (y+1)*b.Dy()/h; sy++ {
+				for sx := x * b.Dx() / w; sx < (x+1)*b.Dx()/w; sx++ {
+					sum += int(color.GrayModel.Convert(img.At(sx, sy)).(color.Gray).Y)
+					n++
+				}
+			}
+			out.SetGray(x, y, color.Gray{Y: uint8(sum / max(n, 1))})
+		}
+	}
+	return out
+}
@@ -0,0 +1,246 @@
+package scan
+
+import (
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/fadykuzman/schluckauf/internal/imagehash"
+	"github.com/fadykuzman/schluckauf/internal/storage"
+)
+
+var (
+	similarityPresets = []string{"Minimal", "VerySmall", "Small", "Medium", "High", "VeryHigh", "Original"}
+	hashAlgorithms    = []string{"Mean", "Gradient", "Blockhash", "VertGradient", "DoubleGradient", "Median"}
+	resizeFilters     = []string{"Lanczos3", "Nearest", "Triangle", "Gaussian", "CatmullRom"}
+	hashSizes         = []int{8, 16, 32, 64}
+	fileHashTypes     = []string{"BLAKE3", "CRC32", "XXH3"}
+	musicTags         = []string{"track_title", "track_artist", "year", "length", "genre", "bitrate"}
+	checkedTypes      = []string{"PDF", "AUDIO", "IMAGE", "ARCHIVE", "VIDEO"}
+)
+
+// Options tunes a scan. Zero values leave the czkawka defaults in place.
+// Similarity and image hash settings only apply to image scans, HashType
+// only to duplicate file scans, VideoTolerance only to video scans and
+// MusicSimilarity, the tags that have to match, only to music scans.
+// CheckedTypes limits broken file scans to some types of files and
+// NumberOfFiles sets how many of the largest files a big file scan records.
+// File size limits and allowed extensions only apply to the scans finding
+// duplicate groups.
+// Scanner picks the scanner running the scan instead of the default one.
+// PerceptualHash and MaxDistance, the Hamming distance up to which images
+// are similar, only apply to image scans by the native scanner.
+type Options struct {
+	Scanner             string   `json:"scanner,omitempty"`
+	PerceptualHash      string   `json:"perceptualHash,omitempty"`
+	MaxDistance         *int     `json:"maxDistance,omitempty"`
+	SimilarityPreset    string   `json:"similarityPreset,omitempty"`
+	HashAlgorithm       string   `json:"hashAlgorithm,omitempty"`
+	HashSize            int      `json:"hashSize,omitempty"`
+	ResizeFilter        string   `json:"resizeFilter,omitempty"`
+	HashType            string   `json:"hashType,omitempty"`
+	VideoTolerance      *int     `json:"videoTolerance,omitempty"`
+	MusicSimilarity     []string `json:"musicSimilarity,omitempty"`
+	CheckedTypes        []string `json:"checkedTypes,omitempty"`
+	NumberOfFiles       int      `json:"numberOfFiles,omitempty"`
+	MinFileSize         int64    `json:"minFileSize,omitempty"`
+	MaxFileSize         int64    `json:"maxFileSize,omitempty"`
+	AllowedExtensions   []string `json:"allowedExtensions,omitempty"`
+	ExcludedDirectories []string `json:"excludedDirectories,omitempty"`
+	ExcludedItems       []string `json:"excludedItems,omitempty"`
+}
+
+// Validate checks the options on their own and against the kind of scan
+// and the directory that is going to be scanned.
+func (o Options) Validate(kind storage.Kind, directory string) error {
+	if kind != storage.KindImage {
+		switch {
+		case o.SimilarityPreset != "":
+			return fmt.Errorf("similarityPreset is only supported for image scans")
+		case o.HashAlgorithm != "":
+			return fmt.Errorf("hashAlgorithm is only supported for image scans")
+		case o.HashSize != 0:
+			return fmt.Errorf("hashSize is only supported for image scans")
+		case o.ResizeFilter != "":
+			return fmt.Errorf("resizeFilter is only supported for image scans")
+		case o.PerceptualHash != "":
+			return fmt.Errorf("perceptualHash is only supported for image scans")
+		case o.MaxDistance != nil:
+			return fmt.Errorf("maxDistance is only supported for image scans")
+		}
+	}
+
+	if o.Scanner != "" && !validScanner(o.Scanner) {
+		return fmt.Errorf("invalid scanner %q: must be one of %s, %s, %s", o.Scanner, ScannerAuto, ScannerCzkawka, ScannerNative)
+	}
+
+	if o.PerceptualHash != "" && !slices.Contains(imagehash.Algorithms, imagehash.Algorithm(o.PerceptualHash)) {
+		return fmt.Errorf("invalid perceptualHash %q: must be one of %s, %s", o.PerceptualHash, imagehash.DHash, imagehash.PHash)
+	}
+
+	if o.MaxDistance != nil && (*o.MaxDistance < 0 || *o.MaxDistance > 32) {
+		return fmt.Errorf("invalid maxDistance %d: must be between 0 and 32", *o.MaxDistance)
+	}
+
+	if kind != storage.KindFile && o.HashType != "" {
+		return fmt.Errorf("hashType is only supported for file scans")
+	}
+
+	if kind != storage.KindVideo && o.VideoTolerance != nil {
+		return fmt.Errorf("videoTolerance is only supported for video scans")
+	}
+
+	if o.VideoTolerance != nil && (*o.VideoTolerance < 0 || *o.VideoTolerance > 20) {
+		return fmt.Errorf("invalid videoTolerance %d: must be between 0 and 20", *o.VideoTolerance)
+	}
+
+	if kind != storage.KindMusic && len(o.MusicSimilarity) > 0 {
+		return fmt.Errorf("musicSimilarity is only supported for music scans")
+	}
+
+	for _, tag := range o.MusicSimilarity {
+		if !slices.Contains(musicTags, tag) {
+			return fmt.Errorf("invalid musicSimilarity tag %q: must be one of %s", tag, strings.Join(musicTags, ", "))
+		}
+	}
+
+	if kind != storage.KindBroken && len(o.CheckedTypes) > 0 {
+		return fmt.Errorf("checkedTypes is only supported for broken file scans")
+	}
+
+	for _, t := range o.CheckedTypes {
+		if !slices.Contains(checkedTypes, t) {
+			return fmt.Errorf("invalid checkedTypes entry %q: must be one of %s", t, strings.Join(checkedTypes, ", "))
+		}
+	}
+
+	if kind != storage.KindBig && o.NumberOfFiles != 0 {
+		return fmt.Errorf("numberOfFiles is only supported for big file scans")
+	}
+
+	if o.NumberOfFiles < 0 {
+		return fmt.Errorf("invalid numberOfFiles %d: must be positive", o.NumberOfFiles)
+	}
+
+	if o.HashType != "" && !slices.Contains(fileHashTypes, o.HashType) {
+		return fmt.Errorf("invalid hashType %q: must be one of %s", o.HashType, strings.Join(fileHashTypes, ", "))
+	}
+
+	if o.SimilarityPreset != "" && !slices.Contains(similarityPresets, o.SimilarityPreset) {
+		return fmt.Errorf("invalid similarityPreset %q: must be one of %s", o.SimilarityPreset, strings.Join(similarityPresets, ", "))
+	}
+
+	if o.HashAlgorithm != "" && !slices.Contains(hashAlgorithms, o.HashAlgorithm) {
+		return fmt.Errorf("invalid hashAlgorithm %q: must be one of %s", o.HashAlgorithm, strings.Join(hashAlgorithms, ", "))
+	}
+
+	if o.HashSize != 0 && !slices.Contains(hashSizes, o.HashSize) {
+		return fmt.Errorf("invalid hashSize %d: must be one of 8, 16, 32, 64", o.HashSize)
+	}
+
+	if o.ResizeFilter != "" && !slices.Contains(resizeFilters, o.ResizeFilter) {
+		return fmt.Errorf("invalid resizeFilter %q: must be one of %s", o.ResizeFilter, strings.Join(resizeFilters, ", "))
+	}
+
+	if !slices.Contains(storage.GroupKinds, kind) {
+		switch {
+		case o.MinFileSize != 0:
+			return fmt.Errorf("minFileSize is only supported for image, file, video and music scans")
+		case o.MaxFileSize != 0:
+			return fmt.Errorf("maxFileSize is only supported for image, file, video and music scans")
+		case len(o.AllowedExtensions) > 0:
+			return fmt.Errorf("allowedExtensions is only supported for image, file, video and music scans")
+		}
+	}
+
+	if o.MinFileSize < 0 || o.MaxFileSize < 0 {
+		return fmt.Errorf("file size limits must not be negative")
+	}
+
+	if o.MaxFileSize != 0 && o.MinFileSize > o.MaxFileSize {
+		return fmt.Errorf("minFileSize (%d) must not be greater than maxFileSize (%d)", o.MinFileSize, o.MaxFileSize)
+	}
+
+	for _, ext := range o.AllowedExtensions {
+		ext = strings.TrimPrefix(ext, ".")
+		if ext == "" || strings.ContainsAny(ext, `/\*?., `) {
+			return fmt.Errorf("invalid allowed extension %q", ext)
+		}
+	}
+
+	absDir, err := filepath.Abs(directory)
+	if err != nil {
+		return fmt.Errorf("invalid directory: %w", err)
+	}
+
+	for _, dir := range o.ExcludedDirectories {
+		if !filepath.IsAbs(dir) {
+			return fmt.Errorf("excluded directory %q must be an absolute path", dir)
+		}
+		if rel, err := filepath.Rel(filepath.Clean(dir), absDir); err == nil && !strings.HasPrefix(rel, "..") {
+			return fmt.Errorf("excluded directory %q contains the scanned directory", dir)
+		}
+	}
+
+	for _, item := range o.ExcludedItems {
+		// patterns are czkawka wildcards, where only * is special, so
+		// any pattern is valid
+		if strings.TrimSpace(item) == "" {
+			return fmt.Errorf("excluded items must not be empty")
+		}
+	}
+
+	return nil
+}
+
+// args maps the options to czkawka_cli flags.
+func (o Options) args() []string {
+	var args []string
+
+	if o.SimilarityPreset != "" {
+		args = append(args, "-s", o.SimilarityPreset)
+	}
+	if o.HashAlgorithm != "" {
+		args = append(args, "-g", o.HashAlgorithm)
+	}
+	if o.HashSize != 0 {
+		args = append(args, "-c", strconv.Itoa(o.HashSize))
+	}
+	if o.ResizeFilter != "" {
+		args = append(args, "-z", o.ResizeFilter)
+	}
+	if o.HashType != "" {
+		args = append(args, "-t", o.HashType)
+	}
+	if o.VideoTolerance != nil {
+		args = append(args, "-t", strconv.Itoa(*o.VideoTolerance))
+	}
+	if len(o.MusicSimilarity) > 0 {
+		args = append(args, "-z", strings.Join(o.MusicSimilarity, ","))
+	}
+	if len(o.CheckedTypes) > 0 {
+		args = append(args, "-c", strings.Join(o.CheckedTypes, ","))
+	}
+	if o.NumberOfFiles != 0 {
+		args = append(args, "-n", strconv.Itoa(o.NumberOfFiles))
+	}
+	if o.MinFileSize != 0 {
+		args = append(args, "-m", strconv.FormatInt(o.MinFileSize, 10))
+	}
+	if o.MaxFileSize != 0 {
+		args = append(args, "-i", strconv.FormatInt(o.MaxFileSize, 10))
+	}
+	for _, ext := range o.AllowedExtensions {
+		args = append(args, "-x", strings.TrimPrefix(ext, "."))
+	}
+	for _, dir := range o.ExcludedDirectories {
+		args = append(args, "-e", dir)
+	}
+	for _, item := range o.ExcludedItems {
+		args = append(args, "-E", item)
+	}
+
+	return args
+}
@@ -0,0 +1,88 @@
+package scan
+
+import (
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/fadykuzman/schluckauf/internal/storage"
+)
+
+func TestValidate(t *testing.T) {
+	ten := 10
+	tests := []struct {
+		kind    storage.Kind
+		options Options
+		wantErr string
+	}{
+		{storage.KindImage, Options{SimilarityPreset: "High", HashSize: 16, MinFileSize: 1, AllowedExtensions: []string{"jpg"}}, ""},
+		{storage.KindFile, Options{HashType: "XXH3", MaxFileSize: 1 << 20}, ""},
+		{storage.KindVideo, Options{VideoTolerance: &ten}, ""},
+		{storage.KindMusic, Options{MusicSimilarity: []string{"track_title", "year"}}, ""},
+		{storage.KindBroken, Options{CheckedTypes: []string{"PDF"}}, ""},
+		{storage.KindBig, Options{NumberOfFiles: 5}, ""},
+		{storage.KindEmptyFolders, Options{ExcludedItems: []string{"*/[cache]/*", "*.{tmp"}}, ""},
+		{storage.KindImage, Options{ExcludedDirectories: []string{"/other"}}, ""},
+
+		{storage.KindFile, Options{SimilarityPreset: "High"}, "similarityPreset is only supported for image scans"},
+		{storage.KindImage, Options{HashSize: 12}, "invalid hashSize 12"},
+		{storage.KindImage, Options{HashType: "XXH3"}, "hashType is only supported for file scans"},
+		{storage.KindFile, Options{HashType: "MD5"}, `invalid hashType "MD5"`},
+		{storage.KindImage, Options{VideoTolerance: &ten}, "videoTolerance is only supported for video scans"},
+		{storage.KindMusic, Options{MusicSimilarity: []string{"album"}}, `invalid musicSimilarity tag "album"`},
+		{storage.KindBig, Options{CheckedTypes: []string{"PDF"}}, "checkedTypes is only supported for broken file scans"},
+		{storage.KindImage, Options{NumberOfFiles: 5}, "numberOfFiles is only supported for big file scans"},
+		{storage.KindEmptyFolders, Options{MinFileSize: 1}, "minFileSize is only supported"},
+		{storage.KindBig, Options{MaxFileSize: 1}, "maxFileSize is only supported"},
+		{storage.KindSymlinks, Options{AllowedExtensions: []string{"jpg"}}, "allowedExtensions is only supported"},
+		{storage.KindFile, Options{MinFileSize: 10, MaxFileSize: 5}, "minFileSize (10) must not be greater than maxFileSize (5)"},
+		{storage.KindFile, Options{AllowedExtensions: []string{"*.jpg"}}, `invalid allowed extension "*.jpg"`},
+		{storage.KindImage, Options{ExcludedDirectories: []string{"relative"}}, "must be an absolute path"},
+		{storage.KindImage, Options{ExcludedDirectories: []string{"/photos"}}, "contains the scanned directory"},
+		{storage.KindImage, Options{ExcludedItems: []string{" "}}, "excluded items must not be empty"},
+		{storage.KindImage, Options{Scanner: "other"}, `invalid scanner "other"`},
+	}
+	for _, tt := range tests {
+		err := tt.options.Validate(tt.kind, "/photos/2024")
+		switch {
+		case tt.wantErr == "" && err != nil:
+			t.Errorf("%s %+v: unexpected error %v", tt.kind, tt.options, err)
+		case tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)):
+			t.Errorf("%s %+v: error = %v, want %q", tt.kind, tt.options, err, tt.wantErr)
+		}
+	}
+}
+
+func TestArgs(t *testing.T) {
+	three := 3
+	tests := []struct {
+		options Options
+		want    []string
+	}{
+		{Options{}, nil},
+		{
+			Options{SimilarityPreset: "High", HashAlgorithm: "Gradient", HashSize: 16, ResizeFilter: "Nearest"},
+			[]string{"-s", "High", "-g", "Gradient", "-c", "16", "-z", "Nearest"},
+		},
+		{Options{HashType: "XXH3"}, []string{"-t", "XXH3"}},
+		{Options{VideoTolerance: &three}, []string{"-t", "3"}},
+		{Options{MusicSimilarity: []string{"track_title", "year"}}, []string{"-z", "track_title,year"}},
+		{Options{CheckedTypes: []string{"PDF", "AUDIO"}}, []string{"-c", "PDF,AUDIO"}},
+		{Options{NumberOfFiles: 20}, []string{"-n", "20"}},
+		{
+			Options{MinFileSize: 1024, MaxFileSize: 4096, AllowedExtensions: []string{".jpg", "png"}},
+			[]string{"-m", "1024", "-i", "4096", "-x", "jpg", "-x", "png"},
+		},
+		{
+			Options{ExcludedDirectories: []string{"/a", "/b"}, ExcludedItems: []string{"*/.git/*"}},
+			[]string{"-e", "/a", "-e", "/b", "-E", "*/.git/*"},
+		},
+		// the scanner is picked by the manager, not passed to czkawka
+		{Options{Scanner: ScannerCzkawka}, nil},
+	}
+	for _, tt := range tests {
+		if got := tt.options.args(); !slices.Equal(got, tt.want) {
+			t.Errorf("%+v: args = %q, want %q", tt.options, got, tt.want)
+		}
+	}
+}
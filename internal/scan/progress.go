@@ -0,0 +1,98 @@
+package scan
+
+import (
+	"bytes"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/fadykuzman/schluckauf/internal/storage"
+)
+
+const progressTail = 20
+
+var (
+	stageRe   = regexp.MustCompile(`(?i)stage\s+(\d+)\s*/\s*(\d+)`)
+	counterRe = regexp.MustCompile(`(\d+)\s*/\s*(\d+)`)
+)
+
+// parseProgress extracts the stage and item counters from a czkawka output
+// line such as "Stage 2/4: checked 1200/5400 images".
+func parseProgress(line string) storage.ScanProgress {
+	p := storage.ScanProgress{Line: line}
+
+	rest := line
+	if m := stageRe.FindStringSubmatchIndex(line); m != nil {
+		p.Stage, _ = strconv.Atoi(line[m[2]:m[3]])
+		p.StageCount, _ = strconv.Atoi(line[m[4]:m[5]])
+		rest = line[:m[0]] + line[m[1]:]
+	}
+
+	if m := counterRe.FindStringSubmatch(rest); m != nil {
+		p.Current, _ = strconv.ParseInt(m[1], 10, 64)
+		p.Total, _ = strconv.ParseInt(m[2], 10, 64)
+	}
+
+	return p
+}
+
+// progressWriter collects the combined czkawka output, splitting it into
+// lines on both '\n' and the '\r' used by redrawn progress bars.
+type progressWriter struct {
+	mu      sync.Mutex
+	partial []byte
+	lines   []storage.ScanProgress
+}
+
+func (w *progressWriter) Write(b []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.partial = append(w.partial, b...)
+	for {
+		i := bytes.IndexAny(w.partial, "\r\n")
+		if i < 0 {
+			break
+		}
+		w.addLine(string(w.partial[:i]))
+		w.partial = w.partial[i+1:]
+	}
+	return len(b), nil
+}
+
+func (w *progressWriter) Flush() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.addLine(string(w.partial))
+	w.partial = nil
+}
+
+func (w *progressWriter) addLine(line string) {
+	line = strings.TrimSpace(line)
+	if line == "" {
+		return
+	}
+	w.lines = append(w.lines, parseProgress(line))
+	if len(w.lines) > progressTail {
+		w.lines = w.lines[len(w.lines)-progressTail:]
+	}
+}
+
+func (w *progressWriter) Snapshot() []storage.ScanProgress {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return append([]storage.ScanProgress(nil), w.lines...)
+}
+
+// Tail returns the most recent output lines joined for error messages.
+func (w *progressWriter) Tail() string {
+	lines := w.Snapshot()
+	out := make([]string, len(lines))
+	for i, l := range lines {
+		out[i] = l.Line
+	}
+	return strings.Join(out, "\n")
+}
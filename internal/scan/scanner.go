@@ -0,0 +1,140 @@
+package scan
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"strings"
+
+	"github.com/fadykuzman/schluckauf/internal/storage"
+)
+
+// Names of the scanners, as used in Options.Scanner and the SCANNER
+// setting.
+const (
+	ScannerAuto    = "auto"
+	ScannerCzkawka = "czkawka"
+	ScannerNative  = "native"
+)
+
+var ErrNoScanner = errors.New("no scanner available")
+
+// Scanner runs scans for the Manager. Results are written to a file in the
+// JSON format of czkawka_cli, so they are loaded, kept as artifacts and
+// imported again the same way whichever scanner produced them.
+type Scanner interface {
+	// Check returns an error if the scanner can't run a scan of kind with
+	// options.
+	Check(kind storage.Kind, options Options) error
+	// Scan scans directory, writes the results to output and progress
+	// lines to progress. The returned Run is filled in even if Scan fails.
+	Scan(ctx context.Context, kind storage.Kind, directory string, options Options, output string, progress io.Writer) (Run, error)
+}
+
+// Run describes how a scanner ran, for the scan history.
+type Run struct {
+	Version    string
+	ExitCode   int
+	StderrTail string
+}
+
+// czkawkaScanner runs czkawka_cli.
+type czkawkaScanner struct{}
+
+func (czkawkaScanner) Check(kind storage.Kind, options Options) error {
+	if _, err := exec.LookPath("czkawka_cli"); err != nil {
+		return fmt.Errorf("%w: Czkawka CLI is not installed. Install with: cargo install czkawka_cli", ErrNoScanner)
+	}
+	if _, ok := subcommands[kind]; !ok {
+		return fmt.Errorf("unsupported scan kind %q", kind)
+	}
+	if options.PerceptualHash != "" || options.MaxDistance != nil {
+		return fmt.Errorf("perceptualHash and maxDistance are only supported by the native scanner")
+	}
+	return nil
+}
+
+func (czkawkaScanner) Scan(ctx context.Context, kind storage.Kind, directory string, options Options, output string, progress io.Writer) (Run, error) {
+	subcommand, ok := subcommands[kind]
+	if !ok {
+		return Run{}, fmt.Errorf("unsupported scan kind %q", kind)
+	}
+
+	args := append([]string{subcommand, "-d", directory, "-C", output}, options.args()...)
+	cmd := exec.CommandContext(ctx, "czkawka_cli", args...)
+	stderr := &progressWriter{}
+	cmd.Stdout = progress
+	cmd.Stderr = io.MultiWriter(progress, stderr)
+	// don't wait forever on output pipes held open by children of a killed process
+	cmd.WaitDelay = waitDelay
+
+	run := Run{Version: czkawkaVersion(ctx)}
+	err := cmd.Run()
+	stderr.Flush()
+
+	run.ExitCode = cmd.ProcessState.ExitCode()
+	run.StderrTail = stderr.Tail()
+	return run, err
+}
+
+// czkawkaVersion asks czkawka_cli for its version, returning an empty
+// string if it can't tell.
+func czkawkaVersion(ctx context.Context) string {
+	ctx, cancel := context.WithTimeout(ctx, versionTimeout)
+	defer cancel()
+
+	out, err := exec.CommandContext(ctx, "czkawka_cli", "--version").Output()
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(out))
+}
+
+// scanner picks the scanner running a scan of kind with options: the one
+// named in the options, else the default of the Manager. The auto default
+// prefers czkawka and falls back to the native scanner when czkawka_cli
+// isn't installed.
+func (m *Manager) scanner(kind storage.Kind, options Options) (Scanner, error) {
+	name := options.Scanner
+	if name == "" {
+		name = m.defaultScanner
+	}
+
+	if name == ScannerAuto {
+		czkawka, native := m.scanners[ScannerCzkawka], m.scanners[ScannerNative]
+		if !errors.Is(czkawka.Check(kind, options), ErrNoScanner) {
+			return czkawka, nil
+		}
+		if native.Check(kind, options) == nil {
+			return native, nil
+		}
+		return czkawka, nil
+	}
+
+	scanner, ok := m.scanners[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown scanner %q", name)
+	}
+	return scanner, nil
+}
+
+// CheckScanner returns an error if no scanner can run a scan of kind with
+// options, ErrNoScanner if it is for lack of an installed scanner.
+func (m *Manager) CheckScanner(kind storage.Kind, options Options) error {
+	scanner, err := m.scanner(kind, options)
+	if err != nil {
+		return err
+	}
+	return scanner.Check(kind, options)
+}
+
+// validScanner reports whether name is a known scanner.
+func validScanner(name string) bool {
+	switch name {
+	case ScannerAuto, ScannerCzkawka, ScannerNative:
+		return true
+	}
+	return false
+}
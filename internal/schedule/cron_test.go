@@ -0,0 +1,101 @@
+package schedule
+
+import (
+	"testing"
+	"time"
+	_ "time/tzdata"
+)
+
+func TestParseCronErrors(t *testing.T) {
+	for _, expr := range []string{
+		"",
+		"* * * *",
+		"* * * * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"*/0 * * * *",
+		"5-1 * * * *",
+		"a * * * *",
+		"1,,2 * * * *",
+		"@reboot",
+	} {
+		if _, err := ParseCron(expr); err == nil {
+			t.Errorf("ParseCron(%q) succeeded, want an error", expr)
+		}
+	}
+}
+
+func TestNext(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		expr string
+		loc  *time.Location
+		from string
+		want string
+	}{
+		{"step", "*/15 * * * *", time.UTC, "2026-01-01T10:07:30Z", "2026-01-01T10:15:00Z"},
+		{"strictly after", "0 * * * *", time.UTC, "2026-01-01T10:00:00Z", "2026-01-01T11:00:00Z"},
+		{"range with step", "0-30/10 8 * * *", time.UTC, "2026-01-01T08:25:00Z", "2026-01-01T08:30:00Z"},
+		{"range with step, next day", "0-30/10 8 * * *", time.UTC, "2026-01-01T08:31:00Z", "2026-01-02T08:00:00Z"},
+		{"list", "0 6,18 * * *", time.UTC, "2026-01-01T07:00:00Z", "2026-01-01T18:00:00Z"},
+		{"weekdays", "0 9 * * 1-5", time.UTC, "2026-01-02T10:00:00Z", "2026-01-05T09:00:00Z"},
+		{"sunday as 7", "0 0 * * 7", time.UTC, "2026-01-01T00:00:00Z", "2026-01-04T00:00:00Z"},
+		{"month step", "0 0 1 */3 *", time.UTC, "2026-02-10T00:00:00Z", "2026-04-01T00:00:00Z"},
+
+		// a day matches either restricted day field, but both when one of
+		// them starts with a wildcard
+		{"day of month", "0 0 13 * *", time.UTC, "2026-01-01T00:00:00Z", "2026-01-13T00:00:00Z"},
+		{"day of month or week, friday", "0 0 13 * 5", time.UTC, "2026-01-01T00:00:00Z", "2026-01-02T00:00:00Z"},
+		{"day of month or week, 13th", "0 0 13 * 5", time.UTC, "2026-01-10T00:00:00Z", "2026-01-13T00:00:00Z"},
+		{"day of month step and week", "0 0 */2 * 5", time.UTC, "2026-01-01T00:00:00Z", "2026-01-09T00:00:00Z"},
+
+		{"hourly", "@hourly", time.UTC, "2026-01-01T10:30:00Z", "2026-01-01T11:00:00Z"},
+		{"daily", "@daily", time.UTC, "2026-01-01T10:30:00Z", "2026-01-02T00:00:00Z"},
+		{"weekly", "@weekly", time.UTC, "2026-01-01T10:30:00Z", "2026-01-04T00:00:00Z"},
+		{"monthly", "@monthly", time.UTC, "2026-01-15T00:00:00Z", "2026-02-01T00:00:00Z"},
+		{"yearly", "@yearly", time.UTC, "2026-03-01T00:00:00Z", "2027-01-01T00:00:00Z"},
+
+		{"leap day", "0 0 29 2 *", time.UTC, "2026-03-01T00:00:00Z", "2028-02-29T00:00:00Z"},
+		{"february 30th", "0 0 30 2 *", time.UTC, "2026-01-01T00:00:00Z", ""},
+		{"april 31st", "0 0 31 4 *", time.UTC, "2026-01-01T00:00:00Z", ""},
+
+		// clocks are put forward from 02:00 to 03:00 on March 29th, 2026
+		{"skipped time", "30 2 * * *", berlin, "2026-03-28T12:00:00+01:00", "2026-03-30T02:30:00+02:00"},
+		{"after skipped hour", "0 3 * * *", berlin, "2026-03-28T12:00:00+01:00", "2026-03-29T03:00:00+02:00"},
+		{"across skipped hour", "*/30 * * * *", berlin, "2026-03-29T01:45:00+01:00", "2026-03-29T03:00:00+02:00"},
+
+		// and put back from 03:00 to 02:00 on October 25th, 2026
+		{"repeated time", "30 2 * * *", berlin, "2026-10-25T00:00:00+02:00", "2026-10-25T02:30:00+02:00"},
+		{"repeated time once", "30 2 * * *", berlin, "2026-10-25T02:30:00+02:00", "2026-10-26T02:30:00+01:00"},
+		{"repeated hour", "*/30 * * * *", berlin, "2026-10-25T02:30:00+02:00", "2026-10-25T02:00:00+01:00"},
+		{"after repeated hour", "0 3 * * *", berlin, "2026-10-25T02:30:00+01:00", "2026-10-25T03:00:00+01:00"},
+	}
+	for _, tt := range tests {
+		c, err := ParseCron(tt.expr)
+		if err != nil {
+			t.Errorf("%s: ParseCron(%q): %v", tt.name, tt.expr, err)
+			continue
+		}
+		from, err := time.Parse(time.RFC3339, tt.from)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		next := c.Next(from.In(tt.loc))
+		got := ""
+		if !next.IsZero() {
+			got = next.Format(time.RFC3339)
+		}
+		if got != tt.want {
+			t.Errorf("%s: Next(%s) of %q = %q, want %q", tt.name, tt.from, tt.expr, got, tt.want)
+		}
+	}
+}
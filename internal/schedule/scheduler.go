@@ -0,0 +1,148 @@
+package schedule
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/fadykuzman/schluckauf/internal/library"
+	"github.com/fadykuzman/schluckauf/internal/operation"
+	"github.com/fadykuzman/schluckauf/internal/scan"
+	"github.com/fadykuzman/schluckauf/internal/storage"
+)
+
+// checkInterval is how often due schedules are looked for. Schedules have
+// a one minute resolution.
+const checkInterval = 30 * time.Second
+
+// Scheduler submits the scans of stored schedules when they are due.
+type Scheduler struct {
+	store   *storage.Storage
+	scans   *scan.Manager
+	library *library.Library
+}
+
+func NewScheduler(store *storage.Storage, scans *scan.Manager, lib *library.Library) *Scheduler {
+	return &Scheduler{store: store, scans: scans, library: lib}
+}
+
+// Run checks for due schedules until ctx is done.
+func (s *Scheduler) Run(ctx context.Context) {
+	ticker := time.NewTicker(checkInterval)
+	defer ticker.Stop()
+
+	for {
+		s.runDue(time.Now())
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *Scheduler) runDue(now time.Time) {
+	schedules, err := s.store.DueSchedules(now)
+	if err != nil {
+		log.Printf("error: failed to get due schedules: %v", err)
+		return
+	}
+
+	for _, schedule := range schedules {
+		run := s.trigger(schedule)
+		if run.State != storage.RunSubmitted {
+			log.Printf("Schedule %d %s: %s", schedule.ID, run.State, run.Message)
+		}
+
+		if err := s.store.RecordScheduleRun(run, NextRun(schedule.Cron, now)); err != nil {
+			log.Printf("error: %v", err)
+		}
+	}
+}
+
+// trigger submits the scan of schedule, unless the scan it submitted last
+// time or another operation is still in progress.
+func (s *Scheduler) trigger(schedule storage.Schedule) storage.ScheduleRun {
+	run := storage.ScheduleRun{ScheduleID: schedule.ID}
+
+	last, err := s.store.LastScheduledJob(schedule.ID)
+	if err != nil && !errors.Is(err, storage.ErrNotFound) {
+		run.State = storage.RunFailed
+		run.Message = err.Error()
+		return run
+	}
+	if err == nil && !last.State.Finished() {
+		run.State = storage.RunSkipped
+		run.Message = fmt.Sprintf("scan job %d is still %s", last.ID, last.State)
+		return run
+	}
+
+	job, err := s.submit(schedule)
+	if errors.Is(err, operation.ErrBusy) {
+		run.State = storage.RunSkipped
+		run.Message = err.Error()
+		return run
+	}
+	if err != nil {
+		run.State = storage.RunFailed
+		run.Message = err.Error()
+		return run
+	}
+
+	run.State = storage.RunSubmitted
+	run.JobID = &job.ID
+	return run
+}
+
+func (s *Scheduler) submit(schedule storage.Schedule) (storage.ScanJob, error) {
+	var options scan.Options
+	if len(schedule.Options) > 0 {
+		if err := json.Unmarshal(schedule.Options, &options); err != nil {
+			return storage.ScanJob{}, fmt.Errorf("invalid options: %w", err)
+		}
+	}
+
+	// the library roots, or where a symlink points to, may have changed
+	// since the schedule was saved
+	directory, err := s.library.Resolve(schedule.Directory)
+	if errors.Is(err, library.ErrOutsideRoots) {
+		return storage.ScanJob{}, err
+	}
+	if err != nil {
+		return storage.ScanJob{}, fmt.Errorf("directory %s does not exist", schedule.Directory)
+	}
+	info, err := os.Stat(directory)
+	if err != nil {
+		return storage.ScanJob{}, fmt.Errorf("directory %s does not exist", schedule.Directory)
+	}
+	if !info.IsDir() {
+		return storage.ScanJob{}, fmt.Errorf("%s is not a directory", schedule.Directory)
+	}
+	if err := options.Validate(schedule.Kind, directory); err != nil {
+		return storage.ScanJob{}, err
+	}
+	if err := s.scans.CheckScanner(schedule.Kind, options); err != nil {
+		return storage.ScanJob{}, err
+	}
+
+	return s.scans.Submit(schedule.Kind, directory, options, schedule.Merge, fmt.Sprintf("schedule %d (%s)", schedule.ID, schedule.Name))
+}
+
+// NextRun returns the next time after now that expr matches, in local
+// time, or nil if it is invalid or never matches.
+func NextRun(expr string, now time.Time) *time.Time {
+	c, err := ParseCron(expr)
+	if err != nil {
+		return nil
+	}
+	next := c.Next(now.Local())
+	if next.IsZero() {
+		return nil
+	}
+	return &next
+}
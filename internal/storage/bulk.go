@@ -0,0 +1,346 @@
+package storage
+
+import (
+	"database/sql"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+// insertChunkSize is the number of images or findings inserted per statement. Larger
+// statements don't load any faster, as binding their variables gets slower.
+const insertChunkSize = 50
+
+// bulkLoader stores scan results within a transaction through prepared
+// statements, inserting the images of a batch of groups, or a batch of
+// findings, several rows at a time.
+type bulkLoader struct {
+	tx    *sql.Tx
+	kind  Kind
+	group *sql.Stmt
+	video *sql.Stmt
+	music *sql.Stmt
+}
+
+func newBulkLoader(tx *sql.Tx, kind Kind) (*bulkLoader, error) {
+	l := &bulkLoader{tx: tx, kind: kind}
+
+	err := prepare(tx, []statement{
+		{&l.group, "INSERT INTO image_groups (kind, hash, size, image_count) VALUES (?, ?, ?, ?)"},
+		{&l.video, `
+			INSERT OR REPLACE INTO video_metadata
+				(image_id, duration, width, height, codec, bitrate, container)
+			VALUES (?, ?, ?, ?, ?, ?, ?)`},
+		{&l.music, `
+			INSERT OR REPLACE INTO music_tags
+				(image_id, artist, title, album, year, bitrate, length, genre)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?)`},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+func (l *bulkLoader) close() {
+	closeStatements(l.group, l.video, l.music)
+}
+
+// statement is a query to prepare into stmt.
+type statement struct {
+	stmt  **sql.Stmt
+	query string
+}
+
+// prepare prepares statements within tx, closing them again if one fails.
+func prepare(tx *sql.Tx, statements []statement) error {
+	for i, s := range statements {
+		stmt, err := tx.Prepare(s.query)
+		if err != nil {
+			for _, prepared := range statements[:i] {
+				(*prepared.stmt).Close()
+			}
+			return fmt.Errorf("failed to prepare statement: %w", err)
+		}
+		*s.stmt = stmt
+	}
+	return nil
+}
+
+func closeStatements(statements ...*sql.Stmt) {
+	for _, stmt := range statements {
+		if stmt != nil {
+			stmt.Close()
+		}
+	}
+}
+
+// createGroup inserts an empty group for fileCount files.
+func (l *bulkLoader) createGroup(hash string, size int64, fileCount int) (int, error) {
+	result, err := l.group.Exec(l.kind, hash, size, fileCount)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create group with hash %s: %w", hash, err)
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+	return int(id), nil
+}
+
+// pendingImage is a file waiting to be inserted with the rest of its batch.
+type pendingImage struct {
+	groupID int
+	file    ScanFile
+}
+
+// insertGroups stores groups with their files, adding them to report.
+func (l *bulkLoader) insertGroups(groups []ScanGroup, report *LoadReport) error {
+	var images []pendingImage
+	for _, group := range groups {
+		gid, err := l.createGroup(group.Hash, group.Size, len(group.Files))
+		if err != nil {
+			return err
+		}
+		report.GroupsAdded++
+
+		for _, file := range group.Files {
+			images = append(images, pendingImage{groupID: gid, file: file})
+		}
+	}
+
+	for chunk := range slices.Chunk(images, insertChunkSize) {
+		if err := l.insertImages(chunk); err != nil {
+			return err
+		}
+		report.FilesAdded += len(chunk)
+	}
+	return nil
+}
+
+// insertImages inserts images with a single statement, then their metadata.
+func (l *bulkLoader) insertImages(images []pendingImage) error {
+	if len(images) == 0 {
+		return nil
+	}
+
+	args := make([]any, 0, 8*len(images))
+	for _, img := range images {
+		args = append(args, img.groupID, img.file.Path, img.file.Size, img.file.ModifiedDate)
+		args = append(args, imageColumns(img.file)...)
+	}
+
+	values := strings.TrimSuffix(strings.Repeat("(?, ?, ?, ?, ?, ?, ?, ?), ", len(images)), ", ")
+	rows, err := l.tx.Query(
+		"INSERT INTO images (group_id, path, image_size, modified_date, width, height, similarity, hash) VALUES "+
+			values+" RETURNING id, group_id, path",
+		args...,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to insert images: %w", err)
+	}
+
+	// RETURNING doesn't guarantee any order, so ids are matched by group
+	// and path
+	type imageKey struct {
+		groupID int
+		path    string
+	}
+	ids := make(map[imageKey]int, len(images))
+	for rows.Next() {
+		var id int
+		var key imageKey
+		if err := rows.Scan(&id, &key.groupID, &key.path); err != nil {
+			rows.Close()
+			return err
+		}
+		ids[key] = id
+	}
+	if err := rows.Close(); err != nil {
+		return err
+	}
+
+	for _, img := range images {
+		if img.file.Video == nil && img.file.Music == nil {
+			continue
+		}
+		if err := l.saveMetadata(ids[imageKey{img.groupID, img.file.Path}], img.file); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// saveMetadata stores the kind specific metadata of a file, if any.
+func (l *bulkLoader) saveMetadata(imageID int, file ScanFile) error {
+	if file.Video != nil {
+		_, err := l.video.Exec(
+			imageID, file.Video.Duration, file.Video.Width, file.Video.Height,
+			file.Video.Codec, file.Video.Bitrate, file.Video.Container,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to save video metadata of image %d: %w", imageID, err)
+		}
+	}
+
+	if file.Music != nil {
+		_, err := l.music.Exec(
+			imageID, file.Music.Artist, file.Music.Title, file.Music.Album,
+			file.Music.Year, file.Music.Bitrate, file.Music.Length, file.Music.Genre,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to save music tags of image %d: %w", imageID, err)
+		}
+	}
+	return nil
+}
+
+// insertFindings inserts findings of the loader's kind with a single
+// statement.
+func (l *bulkLoader) insertFindings(findings []ScanFinding, createdAt time.Time) error {
+	if len(findings) == 0 {
+		return nil
+	}
+
+	args := make([]any, 0, 10*len(findings))
+	for _, f := range findings {
+		args = append(args,
+			l.kind, f.Path, f.Size, f.ModifiedDate, extension(f.Path), f.ErrorType, f.ErrorMessage,
+			f.Target, strings.ToLower(strings.TrimPrefix(f.ProperExtension, ".")), createdAt,
+		)
+	}
+
+	values := strings.TrimSuffix(strings.Repeat("(?, ?, ?, ?, ?, ?, ?, ?, ?, ?), ", len(findings)), ", ")
+	_, err := l.tx.Exec(`
+		INSERT INTO findings
+			(kind, path, size, modified_date, extension, error_type, error_message, target,
+			 proper_extension, created_at)
+		VALUES `+values,
+		args...,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to insert findings: %w", err)
+	}
+	return nil
+}
+
+// mergeLoader is a bulkLoader that also moves stored images into the groups
+// of a merge. New files are inserted a chunk at a time, once addImage
+// collected enough of them or on flush.
+type mergeLoader struct {
+	*bulkLoader
+	move    *sql.Stmt
+	reset   *sql.Stmt
+	regroup *sql.Stmt
+	pending []pendingImage
+}
+
+func newMergeLoader(tx *sql.Tx, kind Kind) (*mergeLoader, error) {
+	bulk, err := newBulkLoader(tx, kind)
+	if err != nil {
+		return nil, err
+	}
+	l := &mergeLoader{bulkLoader: bulk}
+
+	err = prepare(tx, []statement{
+		{&l.move, `
+			UPDATE images
+			SET group_id = ?, image_size = ?, modified_date = ?,
+				width = ?, height = ?, similarity = ?, hash = ?, stale = 0
+			WHERE id = ?`},
+		{&l.reset, `
+			UPDATE images
+			SET group_id = ?, image_size = ?, modified_date = ?,
+				width = ?, height = ?, similarity = ?, hash = ?, stale = 0, action = 'pending'
+			WHERE id = ?`},
+		{&l.regroup, "UPDATE image_groups SET hash = ?, size = ? WHERE id = ?"},
+	})
+	if err != nil {
+		bulk.close()
+		return nil, err
+	}
+	return l, nil
+}
+
+func (l *mergeLoader) close() {
+	closeStatements(l.move, l.reset, l.regroup)
+	l.bulkLoader.close()
+}
+
+// addImage queues a new file of group groupID for insertion.
+func (l *mergeLoader) addImage(groupID int, file ScanFile) error {
+	l.pending = append(l.pending, pendingImage{groupID: groupID, file: file})
+	if len(l.pending) < insertChunkSize {
+		return nil
+	}
+	return l.flush()
+}
+
+// flush inserts the queued files.
+func (l *mergeLoader) flush() error {
+	if err := l.insertImages(l.pending); err != nil {
+		return err
+	}
+	l.pending = l.pending[:0]
+	return nil
+}
+
+// moveImage moves a stored image into groupID with the file's current size,
+// modification date and metadata, resetting its action if the file changed.
+func (l *mergeLoader) moveImage(id int, groupID int, file ScanFile, resetAction bool) error {
+	stmt := l.move
+	if resetAction {
+		stmt = l.reset
+	}
+
+	args := append([]any{groupID, file.Size, file.ModifiedDate}, imageColumns(file)...)
+	if _, err := stmt.Exec(append(args, id)...); err != nil {
+		return fmt.Errorf("failed to update image %d: %w", id, err)
+	}
+	return l.saveMetadata(id, file)
+}
+
+// updateGroup sets the hash and size of a stored group taking the files of
+// group.
+func (l *mergeLoader) updateGroup(id int, group ScanGroup) error {
+	if _, err := l.regroup.Exec(group.Hash, group.Size, id); err != nil {
+		return fmt.Errorf("failed to update image group %d: %w", id, err)
+	}
+	return nil
+}
+
+// idChunkSize is the number of rows a statement selects by ID at most, well
+// below the number of variables SQLite binds.
+const idChunkSize = 500
+
+// inChunks calls fn with the placeholders and arguments of each chunk of
+// ids, to select rows by ID without binding too many variables at once.
+func inChunks(ids []int, fn func(placeholders string, args []any) error) error {
+	for chunk := range slices.Chunk(ids, idChunkSize) {
+		args := make([]any, len(chunk))
+		for i, id := range chunk {
+			args[i] = id
+		}
+		if err := fn(strings.TrimSuffix(strings.Repeat("?, ", len(chunk)), ", "), args); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// execInChunks runs query, selecting rows with IN (%s), for each chunk of
+// ids and returns the number of rows affected.
+func execInChunks(db dbtx, query string, ids []int) (int, error) {
+	var affected int
+	err := inChunks(ids, func(placeholders string, args []any) error {
+		result, err := db.Exec(fmt.Sprintf(query, placeholders), args...)
+		if err != nil {
+			return err
+		}
+		n, err := result.RowsAffected()
+		affected += int(n)
+		return err
+	})
+	return affected, err
+}
@@ -0,0 +1,612 @@
+package storage
+
+import (
+	"cmp"
+	"database/sql"
+	"errors"
+	"fmt"
+	"iter"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Finding is a single file reported by a scan that does not group
+// duplicates, e.g. a broken file.
+type Finding struct {
+	ID           int    `json:"id"`
+	Kind         Kind   `json:"kind"`
+	Path         string `json:"path"`
+	Size         int64  `json:"size"`
+	ModifiedDate int64  `json:"modifiedDate"`
+	Extension    string `json:"extension"`
+	ErrorType    string `json:"errorType,omitempty"`
+	ErrorMessage string `json:"errorMessage,omitempty"`
+	// Target is the destination of a symlink.
+	Target string `json:"target,omitempty"`
+	// ProperExtension is the extension matching the detected type of a file
+	// with a wrong extension.
+	ProperExtension string      `json:"properExtension,omitempty"`
+	Action          ImageAction `json:"action"`
+}
+
+// ScanFinding is a finding reported by a scan, ready to be stored.
+type ScanFinding struct {
+	Path            string
+	Size            int64
+	ModifiedDate    int64
+	ErrorType       string
+	ErrorMessage    string
+	Target          string
+	ProperExtension string
+}
+
+// FindingSort is the order in which findings are listed.
+type FindingSort string
+
+const (
+	SortByPath FindingSort = "path"
+	SortBySize FindingSort = "size"
+)
+
+// FindingFilter selects the findings returned by ListFindings. Empty
+// fields match everything, a zero Limit returns all findings.
+type FindingFilter struct {
+	Kind      Kind
+	ErrorType string
+	Extension string
+	Sort      FindingSort
+	Limit     int
+	Offset    int
+}
+
+// FindingPage is a page of findings together with the number of findings
+// matching the filter across all pages.
+type FindingPage struct {
+	Findings []Finding `json:"findings"`
+	Total    int       `json:"total"`
+	Limit    int       `json:"limit"`
+	Offset   int       `json:"offset"`
+}
+
+// FindingSummary totals the size of the findings of a kind by directory and
+// by extension, largest first.
+type FindingSummary struct {
+	Count       int            `json:"count"`
+	Size        int64          `json:"size"`
+	Directories []FindingTotal `json:"directories"`
+	Extensions  []FindingTotal `json:"extensions"`
+}
+
+type FindingTotal struct {
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+	Size  int64  `json:"size"`
+}
+
+const findingColumns = `
+	id, kind, path, size, modified_date, extension, error_type, error_message, target,
+	proper_extension, action`
+
+// openFindings matches the findings that have not been dealt with yet. Trashed,
+// renamed and re-pointed findings are kept as a record of what was done.
+const openFindings = "action NOT IN ('trashed', 'renamed', 'repointed')"
+
+// ReplaceFindings drops the findings of kind that have not been trashed and
+// stores findings in their place, all in one transaction: if anything fails,
+// including reading findings, the previous findings are kept. Findings are
+// inserted in chunks as they are read, so they never have to be held in
+// memory all at once.
+func (s *Storage) ReplaceFindings(kind Kind, findings iter.Seq2[ScanFinding, error]) (LoadReport, error) {
+	var report LoadReport
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return report, err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec("DELETE FROM findings WHERE kind = ? AND "+openFindings, kind)
+	if err != nil {
+		return report, fmt.Errorf("failed to delete previous findings: %w", err)
+	}
+	removed, err := result.RowsAffected()
+	if err != nil {
+		return report, err
+	}
+	report.FilesRemoved = int(removed)
+
+	loader, err := newBulkLoader(tx, kind)
+	if err != nil {
+		return report, err
+	}
+	defer loader.close()
+
+	now := time.Now().UTC()
+	batch := make([]ScanFinding, 0, insertChunkSize)
+	for f, err := range findings {
+		if err != nil {
+			return report, fmt.Errorf("failed to read findings: %w", err)
+		}
+
+		batch = append(batch, f)
+		if len(batch) == insertChunkSize {
+			if err := loader.insertFindings(batch, now); err != nil {
+				return report, err
+			}
+			report.FilesAdded += len(batch)
+			batch = batch[:0]
+		}
+	}
+	if err := loader.insertFindings(batch, now); err != nil {
+		return report, err
+	}
+	report.FilesAdded += len(batch)
+
+	return report, tx.Commit()
+}
+
+// ListFindings returns a page of the findings matching filter that have
+// not been trashed yet, ordered by path or by size, largest first.
+func (s *Storage) ListFindings(filter FindingFilter) (FindingPage, error) {
+	where := " FROM findings WHERE kind = ? AND " + openFindings
+	args := []any{filter.Kind}
+
+	if filter.ErrorType != "" {
+		where += " AND error_type = ?"
+		args = append(args, filter.ErrorType)
+	}
+	if filter.Extension != "" {
+		where += " AND extension = ?"
+		args = append(args, strings.ToLower(strings.TrimPrefix(filter.Extension, ".")))
+	}
+
+	page := FindingPage{Findings: []Finding{}, Limit: filter.Limit, Offset: filter.Offset}
+	if err := s.db.QueryRow("SELECT COUNT(*)"+where, args...).Scan(&page.Total); err != nil {
+		return page, fmt.Errorf("failed to count findings: %w", err)
+	}
+
+	query := "SELECT " + findingColumns + where
+	switch filter.Sort {
+	case SortBySize:
+		query += " ORDER BY size DESC, path"
+	default:
+		query += " ORDER BY path"
+	}
+	if filter.Limit > 0 {
+		query += " LIMIT ? OFFSET ?"
+		args = append(args, filter.Limit, filter.Offset)
+	}
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return page, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		f, err := scanFinding(rows)
+		if err != nil {
+			return page, err
+		}
+		page.Findings = append(page.Findings, f)
+	}
+	return page, rows.Err()
+}
+
+// GetFindingSummary totals the findings of kind that have not been trashed
+// yet by parent directory and by extension.
+func (s *Storage) GetFindingSummary(kind Kind) (FindingSummary, error) {
+	summary := FindingSummary{Directories: []FindingTotal{}, Extensions: []FindingTotal{}}
+
+	rows, err := s.db.Query(
+		"SELECT path, size, extension FROM findings WHERE kind = ? AND "+openFindings,
+		kind,
+	)
+	if err != nil {
+		return summary, err
+	}
+	defer rows.Close()
+
+	directories := make(map[string]*FindingTotal)
+	extensions := make(map[string]*FindingTotal)
+	add := func(totals map[string]*FindingTotal, name string, size int64) {
+		t, ok := totals[name]
+		if !ok {
+			t = &FindingTotal{Name: name}
+			totals[name] = t
+		}
+		t.Count++
+		t.Size += size
+	}
+
+	for rows.Next() {
+		var path string
+		var size sql.NullInt64
+		var ext sql.NullString
+		if err := rows.Scan(&path, &size, &ext); err != nil {
+			return summary, err
+		}
+		summary.Count++
+		summary.Size += size.Int64
+		add(directories, filepath.Dir(path), size.Int64)
+		add(extensions, ext.String, size.Int64)
+	}
+	if err := rows.Err(); err != nil {
+		return summary, err
+	}
+
+	summary.Directories = sortedTotals(directories)
+	summary.Extensions = sortedTotals(extensions)
+	return summary, nil
+}
+
+// UpdateFindingAction marks a finding of kind to be kept or trashed by the
+// next trash run.
+func (s *Storage) UpdateFindingAction(kind Kind, id int, action ImageAction) error {
+	result, err := s.db.Exec(
+		"UPDATE findings SET action = ? WHERE id = ? AND kind = ? AND "+openFindings,
+		action, id, kind,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update finding %d: %w", id, err)
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return fmt.Errorf("finding %d: %w", id, ErrNotFound)
+	}
+	return nil
+}
+
+// SelectAllFindings sets action on every finding of kind that has not been
+// trashed yet, except for the ones in exclude, which are kept. It returns the
+// number of findings set to action. IDs listed more than once in exclude are
+// only excluded once.
+func (s *Storage) SelectAllFindings(kind Kind, action ImageAction, exclude []int) (int, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(
+		"UPDATE findings SET action = ? WHERE kind = ? AND "+openFindings,
+		action, kind,
+	)
+	if err != nil {
+		return 0, fmt.Errorf("failed to update findings: %w", err)
+	}
+	selected, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+
+	for _, id := range slices.Compact(slices.Sorted(slices.Values(exclude))) {
+		result, err := tx.Exec(
+			"UPDATE findings SET action = ? WHERE id = ? AND kind = ? AND "+openFindings,
+			ActionKeep, id, kind,
+		)
+		if err != nil {
+			return 0, fmt.Errorf("failed to exclude finding %d: %w", id, err)
+		}
+		n, err := result.RowsAffected()
+		if err != nil {
+			return 0, err
+		}
+		if n == 0 {
+			return 0, fmt.Errorf("finding %d: %w", id, ErrNotFound)
+		}
+		selected--
+	}
+
+	return int(selected), tx.Commit()
+}
+
+// pendingFinding is a finding about to be dealt with by a trash run: moved
+// to the trash directory, removed if it is an empty folder or a symlink, or
+// renamed if it is marked with ActionRename.
+type pendingFinding struct {
+	ImageToTrash
+	kind            Kind
+	action          ImageAction
+	properExtension string
+}
+
+// TrashFindings moves the findings of kind with the given ids to the trash
+// directory right away. Empty folders and symlinks are removed instead.
+func (s *Storage) TrashFindings(kind Kind, ids []int) (TrashImagesResponse, error) {
+	var toTrash []pendingFinding
+	for _, id := range ids {
+		finding := pendingFinding{kind: kind, action: ActionTrash}
+		err := s.db.QueryRow(
+			"SELECT id, path FROM findings WHERE id = ? AND kind = ? AND "+openFindings,
+			id, kind,
+		).Scan(&finding.ID, &finding.Path)
+		if errors.Is(err, sql.ErrNoRows) {
+			return TrashImagesResponse{}, fmt.Errorf("finding %d: %w", id, ErrNotFound)
+		}
+		if err != nil {
+			return TrashImagesResponse{}, fmt.Errorf("failed to query finding %d: %w", id, err)
+		}
+		toTrash = append(toTrash, finding)
+	}
+
+	var response TrashImagesResponse
+	s.applyFindingActions(toTrash, time.Now().Format("2006-01-02_15-04-05"), &response)
+	return response, nil
+}
+
+// RepointSymlink points the broken symlink of finding id to target, which
+// has to exist, and records the new target.
+func (s *Storage) RepointSymlink(id int, target string) error {
+	var path string
+	err := s.db.QueryRow(
+		"SELECT path FROM findings WHERE id = ? AND kind = ? AND "+openFindings,
+		id, KindSymlinks,
+	).Scan(&path)
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("finding %d: %w", id, ErrNotFound)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to query finding %d: %w", id, err)
+	}
+
+	if err := s.checkEntry(path); err != nil {
+		return err
+	}
+	info, err := os.Lstat(path)
+	if err != nil {
+		return err
+	}
+	if info.Mode()&os.ModeSymlink == 0 {
+		return fmt.Errorf("%s is no longer a symlink", path)
+	}
+
+	// replace the link atomically, so it never goes missing
+	tmp := path + ".repoint"
+	if err := os.Symlink(target, tmp); err != nil {
+		return fmt.Errorf("failed to create symlink: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to replace symlink: %w", err)
+	}
+
+	_, err = s.db.Exec(
+		"UPDATE findings SET action = ?, target = ? WHERE id = ?",
+		ActionRepointed, target, id,
+	)
+	if err != nil {
+		return fmt.Errorf("symlink re-pointed but couldn't update database for %s: %w", path, err)
+	}
+	return nil
+}
+
+func (s *Storage) findingsMarkedForTrash() ([]pendingFinding, error) {
+	rows, err := s.db.Query(
+		"SELECT id, path, kind, action, proper_extension FROM findings WHERE action IN (?, ?)",
+		ActionTrash, ActionRename,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query findings to trash: %w", err)
+	}
+	defer rows.Close()
+
+	var findings []pendingFinding
+	for rows.Next() {
+		var finding pendingFinding
+		var properExtension sql.NullString
+		if err := rows.Scan(&finding.ID, &finding.Path, &finding.kind, &finding.action, &properExtension); err != nil {
+			return nil, err
+		}
+		finding.properExtension = properExtension.String
+		findings = append(findings, finding)
+	}
+	return findings, rows.Err()
+}
+
+// applyFindingActions deals with the given findings and adds the outcome to
+// response. Files are moved to the trash directory under timestamp. Empty
+// folders are handled last and deepest first, so that a folder holding
+// nothing but empty folders is empty by the time it is removed.
+func (s *Storage) applyFindingActions(findings []pendingFinding, timestamp string, response *TrashImagesResponse) {
+	slices.SortStableFunc(findings, func(a, b pendingFinding) int {
+		aFolder, bFolder := a.kind == KindEmptyFolders, b.kind == KindEmptyFolders
+		switch {
+		case aFolder && bFolder:
+			return cmp.Compare(pathDepth(b.Path), pathDepth(a.Path))
+		case aFolder:
+			return 1
+		case bFolder:
+			return -1
+		}
+		return 0
+	})
+
+	for _, finding := range findings {
+		if finding.action == ActionRename {
+			s.renameFinding(finding, response)
+			continue
+		}
+
+		destPath := finding.Path
+		var err error
+		switch finding.kind {
+		case KindEmptyFolders:
+			if err = s.checkEntry(finding.Path); err == nil {
+				err = removeEmptyFolder(finding.Path)
+			}
+			if err != nil {
+				log.Printf("Error removing empty folder %d", finding.ID)
+				response.Errors = append(response.Errors, fmt.Sprintf("Couldn't remove folder %s. %s", finding.Path, err))
+			}
+		case KindSymlinks:
+			if err = s.checkEntry(finding.Path); err == nil {
+				err = removeSymlink(finding.Path)
+			}
+			if err != nil {
+				log.Printf("Error removing symlink %d", finding.ID)
+				response.Errors = append(response.Errors, fmt.Sprintf("Couldn't remove symlink %s. %s", finding.Path, err))
+			}
+		default:
+			if destPath, err = moveImageToTrash(s.library, finding.ImageToTrash, timestamp); err != nil {
+				log.Printf("Error moving finding %d to trash", finding.ID)
+				response.Errors = append(response.Errors, fmt.Sprintf("Couldn't move file %s to trash. %s", finding.Path, err))
+			}
+		}
+		if err != nil {
+			response.FailedCount++
+			continue
+		}
+
+		_, err = s.db.Exec(
+			"UPDATE findings SET action = ?, path = ? WHERE id = ?",
+			ActionTrashed, destPath, finding.ID,
+		)
+		if err != nil {
+			response.Errors = append(response.Errors, fmt.Sprintf("File moved but couldn't update database for file %s: %s", finding.Path, err))
+			response.PartialFailures++
+			continue
+		}
+		response.MovedCount++
+	}
+
+	response.TotalCount = response.MovedCount + response.RenamedCount + response.FailedCount + response.PartialFailures
+}
+
+// renameFinding gives a file with a wrong extension its proper extension.
+func (s *Storage) renameFinding(finding pendingFinding, response *TrashImagesResponse) {
+	err := s.checkEntry(finding.Path)
+	var destPath string
+	if err == nil {
+		destPath, err = renameToExtension(finding.Path, finding.properExtension)
+	}
+	if err != nil {
+		log.Printf("Error renaming finding %d", finding.ID)
+		response.Errors = append(response.Errors, fmt.Sprintf("Couldn't rename file %s. %s", finding.Path, err))
+		response.FailedCount++
+		return
+	}
+
+	_, err = s.db.Exec(
+		"UPDATE findings SET action = ?, path = ?, extension = ? WHERE id = ?",
+		ActionRenamed, destPath, finding.properExtension, finding.ID,
+	)
+	if err != nil {
+		response.Errors = append(response.Errors, fmt.Sprintf("File renamed but couldn't update database for file %s: %s", finding.Path, err))
+		response.PartialFailures++
+		return
+	}
+	response.RenamedCount++
+}
+
+// renameToExtension replaces the extension of path with ext, unless a file
+// with the new name already exists.
+func renameToExtension(path, ext string) (string, error) {
+	if ext == "" {
+		return "", fmt.Errorf("no proper extension known")
+	}
+
+	destPath := strings.TrimSuffix(path, filepath.Ext(path)) + "." + ext
+	if _, err := os.Lstat(destPath); err == nil {
+		return "", fmt.Errorf("%s already exists", destPath)
+	}
+
+	if err := os.Rename(path, destPath); err != nil {
+		return "", err
+	}
+	return destPath, nil
+}
+
+// removeSymlink removes path if it is still a symlink. The target, if any,
+// is left alone.
+func removeSymlink(path string) error {
+	info, err := os.Lstat(path)
+	if err != nil {
+		return err
+	}
+	if info.Mode()&os.ModeSymlink == 0 {
+		return fmt.Errorf("%s is no longer a symlink", path)
+	}
+	return os.Remove(path)
+}
+
+// removeEmptyFolder removes path if it is still an empty directory.
+func removeEmptyFolder(path string) error {
+	info, err := os.Lstat(path)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("%s is no longer a folder", path)
+	}
+
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		return err
+	}
+	if len(entries) > 0 {
+		return fmt.Errorf("folder %s is no longer empty", path)
+	}
+
+	return os.Remove(path)
+}
+
+func pathDepth(path string) int {
+	return strings.Count(filepath.Clean(path), string(filepath.Separator))
+}
+
+func scanFinding(row rowScanner) (Finding, error) {
+	var f Finding
+	var size, modifiedDate sql.NullInt64
+	var ext, errorType, errorMessage, target, properExtension sql.NullString
+
+	if err := row.Scan(
+		&f.ID,
+		&f.Kind,
+		&f.Path,
+		&size,
+		&modifiedDate,
+		&ext,
+		&errorType,
+		&errorMessage,
+		&target,
+		&properExtension,
+		&f.Action,
+	); err != nil {
+		return Finding{}, err
+	}
+
+	f.Size = size.Int64
+	f.ModifiedDate = modifiedDate.Int64
+	f.Extension = ext.String
+	f.ErrorType = errorType.String
+	f.ErrorMessage = errorMessage.String
+	f.Target = target.String
+	f.ProperExtension = properExtension.String
+	return f, nil
+}
+
+func extension(path string) string {
+	return strings.ToLower(strings.TrimPrefix(filepath.Ext(path), "."))
+}
+
+func sortedTotals(totals map[string]*FindingTotal) []FindingTotal {
+	sorted := make([]FindingTotal, 0, len(totals))
+	for _, t := range totals {
+		sorted = append(sorted, *t)
+	}
+	slices.SortFunc(sorted, func(a, b FindingTotal) int {
+		if a.Size != b.Size {
+			return cmp.Compare(b.Size, a.Size)
+		}
+		return strings.Compare(a.Name, b.Name)
+	})
+	return sorted
+}
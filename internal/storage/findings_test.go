@@ -0,0 +1,108 @@
+package storage_test
+
+import (
+	"errors"
+	"iter"
+	"strconv"
+	"testing"
+
+	"github.com/fadykuzman/schluckauf/internal/storage"
+)
+
+// TestReplaceFindings checks a load of more findings than fit in one
+// statement, and that a load failing while reading keeps the previous
+// findings.
+func TestReplaceFindings(t *testing.T) {
+	var many []storage.ScanFinding
+	for i := range 123 {
+		many = append(many, storage.ScanFinding{Path: "/" + strconv.Itoa(i) + ".TMP", Size: int64(i)})
+	}
+
+	s := open(t)
+	if _, err := s.ReplaceFindings(storage.KindTemp, findings(many[:3]...)); err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := s.ReplaceFindings(storage.KindTemp, findings(many...))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (storage.LoadReport{FilesAdded: 123, FilesRemoved: 3}); report != want {
+		t.Errorf("report = %+v, want %+v", report, want)
+	}
+	page, err := s.ListFindings(storage.FindingFilter{Kind: storage.KindTemp, Extension: "tmp", Sort: storage.SortBySize})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if page.Total != 123 || page.Findings[0].Size != 122 {
+		t.Errorf("stored %d findings, largest %+v, want 123 by size", page.Total, page.Findings[0])
+	}
+
+	broken := errors.New("unexpected EOF")
+	_, err = s.ReplaceFindings(storage.KindTemp, func(yield func(storage.ScanFinding, error) bool) {
+		for _, f := range many[:60] {
+			if !yield(f, nil) {
+				return
+			}
+		}
+		yield(storage.ScanFinding{}, broken)
+	})
+	if !errors.Is(err, broken) {
+		t.Errorf("load of a broken output = %v, want %v", err, broken)
+	}
+	if page, err = s.ListFindings(storage.FindingFilter{Kind: storage.KindTemp}); err != nil {
+		t.Fatal(err)
+	}
+	if page.Total != 123 {
+		t.Errorf("stored %d findings after a failed load, want the previous 123", page.Total)
+	}
+}
+
+func TestSelectAllFindingsExcludesOnce(t *testing.T) {
+	s := open(t)
+
+	_, err := s.ReplaceFindings(storage.KindTemp, findings(
+		storage.ScanFinding{Path: "/a.tmp", Size: 1},
+		storage.ScanFinding{Path: "/b.tmp", Size: 1},
+		storage.ScanFinding{Path: "/c.tmp", Size: 1},
+	))
+	if err != nil {
+		t.Fatal(err)
+	}
+	page, err := s.ListFindings(storage.FindingFilter{Kind: storage.KindTemp})
+	if err != nil {
+		t.Fatal(err)
+	}
+	excluded := page.Findings[0].ID
+
+	selected, err := s.SelectAllFindings(storage.KindTemp, storage.ActionTrash, []int{excluded, excluded})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if selected != 2 {
+		t.Errorf("selected = %d, want 2", selected)
+	}
+
+	if page, err = s.ListFindings(storage.FindingFilter{Kind: storage.KindTemp}); err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range page.Findings {
+		want := storage.ActionTrash
+		if f.ID == excluded {
+			want = storage.ActionKeep
+		}
+		if f.Action != want {
+			t.Errorf("finding %s action = %q, want %q", f.Path, f.Action, want)
+		}
+	}
+}
+
+func findings(list ...storage.ScanFinding) iter.Seq2[storage.ScanFinding, error] {
+	return func(yield func(storage.ScanFinding, error) bool) {
+		for _, f := range list {
+			if !yield(f, nil) {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,259 @@
+package storage
+
+import (
+	"bytes"
+	"cmp"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"path/filepath"
+	"strings"
+)
+
+// ErrInvalidCursor is returned for cursors that were not returned by a
+// listing with the same sort.
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// GroupSort is the order in which groups are listed. The zero value lists
+// pending groups first, then by the time they were last decided on.
+type GroupSort string
+
+const (
+	SortGroupsByReclaimable GroupSort = "reclaimable"
+	SortGroupsBySize        GroupSort = "size"
+	SortGroupsByCount       GroupSort = "count"
+	SortGroupsByUpdated     GroupSort = "updated"
+)
+
+// GroupSorts are the sorts ListImageGroups supports besides the default.
+var GroupSorts = []GroupSort{SortGroupsByReclaimable, SortGroupsBySize, SortGroupsByCount, SortGroupsByUpdated}
+
+// GroupPage is a page of groups together with the number of groups
+// matching the filter across all pages. NextCursor continues the listing
+// after the last group of the page, if there are more.
+type GroupPage struct {
+	Groups     []ImageGroup `json:"groups"`
+	Total      int          `json:"total"`
+	NextCursor string       `json:"nextCursor,omitempty"`
+}
+
+// sortColumn is a key groups are ordered by. expr computes it from the
+// groups l of the listing query and value computes it from a listed group, so
+// that both stores order and page alike. Ties are broken by group ID.
+type sortColumn struct {
+	expr  string
+	desc  bool
+	value func(g ImageGroup) any
+}
+
+var (
+	byStatus = sortColumn{"CASE WHEN l.status = 'pending' THEN 0 ELSE 1 END", false, func(g ImageGroup) any {
+		if g.Status == StatusPending {
+			return int64(0)
+		}
+		return int64(1)
+	}}
+	// byUpdated compares the text SQLite stores CURRENT_TIMESTAMP as, with
+	// groups never decided on last
+	byUpdated = sortColumn{"l.updated_key", true, func(g ImageGroup) any {
+		if g.UpdatedAt == nil {
+			return ""
+		}
+		return g.UpdatedAt.UTC().Format("2006-01-02 15:04:05")
+	}}
+	byReclaimable = sortColumn{"l.reclaimable", true, func(g ImageGroup) any { return g.Reclaimable }}
+	bySize        = sortColumn{"l.total_size", true, func(g ImageGroup) any { return g.Size }}
+	byCount       = sortColumn{"l.image_count", true, func(g ImageGroup) any { return int64(g.ImageCount) }}
+)
+
+// columns returns the keys of sort, largest or most recent first.
+func (sort GroupSort) columns() []sortColumn {
+	switch sort {
+	case SortGroupsByReclaimable:
+		return []sortColumn{byReclaimable}
+	case SortGroupsBySize:
+		return []sortColumn{bySize}
+	case SortGroupsByCount:
+		return []sortColumn{byCount}
+	case SortGroupsByUpdated:
+		return []sortColumn{byUpdated}
+	default:
+		return []sortColumn{byStatus, byUpdated}
+	}
+}
+
+// paginate trims a listing fetched with one group more than filter.Limit
+// to the limit, setting the cursor of the next page if there is one.
+func (page GroupPage) paginate(filter GroupFilter) GroupPage {
+	if filter.Limit > 0 && len(page.Groups) > filter.Limit {
+		page.Groups = page.Groups[:filter.Limit]
+		page.NextCursor = encodeCursor(filter.Sort, page.Groups[filter.Limit-1])
+	}
+	return page
+}
+
+// groupCursor is the position after the last group of a page.
+type groupCursor struct {
+	Sort   GroupSort `json:"sort"`
+	Values []any     `json:"values"`
+	ID     int       `json:"id"`
+}
+
+func encodeCursor(sort GroupSort, g ImageGroup) string {
+	c := groupCursor{Sort: sort, ID: g.ID}
+	for _, col := range sort.columns() {
+		c.Values = append(c.Values, col.value(g))
+	}
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// decodeCursor reads a cursor of a listing ordered by sort. Numbers come
+// back as int64, like the values they were encoded from.
+func decodeCursor(sort GroupSort, cursor string) (groupCursor, error) {
+	var c groupCursor
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return c, ErrInvalidCursor
+	}
+
+	d := json.NewDecoder(bytes.NewReader(data))
+	d.UseNumber()
+	if err := d.Decode(&c); err != nil || c.Sort != sort || len(c.Values) != len(sort.columns()) {
+		return c, ErrInvalidCursor
+	}
+	for i, v := range c.Values {
+		switch v := v.(type) {
+		case json.Number:
+			n, err := v.Int64()
+			if err != nil {
+				return c, ErrInvalidCursor
+			}
+			c.Values[i] = n
+		case string:
+		default:
+			return c, ErrInvalidCursor
+		}
+	}
+	return c, nil
+}
+
+// compareGroups orders a before b by the keys of sort, then by ID.
+func compareGroups(sort GroupSort, a, b ImageGroup) int {
+	return compareKeys(sort, sortKeys(sort, a), a.ID, sortKeys(sort, b), b.ID)
+}
+
+func sortKeys(sort GroupSort, g ImageGroup) []any {
+	var values []any
+	for _, col := range sort.columns() {
+		values = append(values, col.value(g))
+	}
+	return values
+}
+
+func compareKeys(sort GroupSort, a []any, aID int, b []any, bID int) int {
+	for i, col := range sort.columns() {
+		var c int
+		switch av := a[i].(type) {
+		case int64:
+			bv, _ := b[i].(int64)
+			c = cmp.Compare(av, bv)
+		case string:
+			bv, _ := b[i].(string)
+			c = cmp.Compare(av, bv)
+		}
+		if col.desc {
+			c = -c
+		}
+		if c != 0 {
+			return c
+		}
+	}
+	return cmp.Compare(aID, bID)
+}
+
+// afterCursor returns the condition matching the groups ordered after c,
+// with its arguments.
+func afterCursor(sort GroupSort, c groupCursor) (string, []any) {
+	var terms []string
+	var args []any
+	var equal []string
+	var equalArgs []any
+
+	for i, col := range sort.columns() {
+		op := ">"
+		if col.desc {
+			op = "<"
+		}
+		terms = append(terms, "("+strings.Join(append(equal, col.expr+" "+op+" ?"), " AND ")+")")
+		args = append(append(args, equalArgs...), c.Values[i])
+
+		equal = append(equal, col.expr+" = ?")
+		equalArgs = append(equalArgs, c.Values[i])
+	}
+	terms = append(terms, "("+strings.Join(append(equal, "l.id > ?"), " AND ")+")")
+	args = append(append(args, equalArgs...), c.ID)
+
+	return "(" + strings.Join(terms, " OR ") + ")", args
+}
+
+// fileMatches reports whether a file matches the file conditions of
+// filter, like the file conditions of the listing query.
+func (filter GroupFilter) fileMatches(path string, size int64) bool {
+	if filter.Path != "" && !strings.Contains(path, filter.Path) {
+		return false
+	}
+	if dir := filter.directory(); dir != "" && !strings.HasPrefix(path, dir) {
+		return false
+	}
+	if ext := filter.extension(); ext != "" && !strings.HasSuffix(strings.ToLower(path), ext) {
+		return false
+	}
+	if filter.MinSize > 0 && size < filter.MinSize {
+		return false
+	}
+	if filter.MaxSize > 0 && size > filter.MaxSize {
+		return false
+	}
+	return true
+}
+
+func (filter GroupFilter) hasFileConditions() bool {
+	return filter.Path != "" || filter.Directory != "" || filter.Extension != "" ||
+		filter.MinSize > 0 || filter.MaxSize > 0
+}
+
+// directory returns the prefix of the paths below filter.Directory.
+func (filter GroupFilter) directory() string {
+	if filter.Directory == "" {
+		return ""
+	}
+	dir := filepath.Clean(filter.Directory)
+	if !strings.HasSuffix(dir, "/") {
+		dir += "/"
+	}
+	return dir
+}
+
+// extension returns the lower case suffix of the files with
+// filter.Extension, like ".jpg".
+func (filter GroupFilter) extension() string {
+	if filter.Extension == "" {
+		return ""
+	}
+	return "." + strings.ToLower(strings.TrimPrefix(filter.Extension, "."))
+}
+
+func (filter GroupFilter) countMatches(count int) bool {
+	return (filter.MinCount <= 0 || count >= filter.MinCount) &&
+		(filter.MaxCount <= 0 || count <= filter.MaxCount)
+}
+
+// statusMatches reports whether groups with status are listed, which
+// without a status are all but the archived ones.
+func (filter GroupFilter) statusMatches(status GroupStatus) bool {
+	if filter.Status == "" {
+		return status != StatusArchived
+	}
+	return status == filter.Status
+}
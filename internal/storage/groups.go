@@ -1,8 +1,10 @@
 package storage
 
 import (
-	"encoding/json"
+	"fmt"
+	"strings"
 	"time"
+	"unicode/utf8"
 
 	_ "modernc.org/sqlite"
 )
@@ -15,25 +17,57 @@ const (
 	StatusArchived GroupStatus = "archived"
 )
 
+// ImageGroup is a group of duplicate files. Size totals the files that
+// have not been trashed and Reclaimable is what trashing all but the
+// largest of them would free.
 type ImageGroup struct {
-	ID         int         `json:"id"`
-	ImageCount int         `json:"imageCount"`
-	UpdatedAt  *time.Time  `json:"updatedAt"`
-	Status     GroupStatus `json:"status"`
+	ID          int         `json:"id"`
+	Kind        Kind        `json:"kind"`
+	ImageCount  int         `json:"imageCount"`
+	Size        int64       `json:"size"`
+	Reclaimable int64       `json:"reclaimable"`
+	UpdatedAt   *time.Time  `json:"updatedAt"`
+	ArchivedAt  *time.Time  `json:"archivedAt,omitempty"`
+	Status      GroupStatus `json:"status"`
+	Music       *MusicTags  `json:"music,omitempty"`
 }
 
 type ImageGroupStats struct {
 	Pending            int `json:"pending"`
 	Decided            int `json:"decided"`
+	Archived           int `json:"archived"`
 	ImagesToTrashCount int `json:"imagesToTrashCount"`
 }
 
-func (s *Storage) CreateImageGroup(hash []int, size int64, fileCount int) (int, error) {
-	hashJSON, _ := json.Marshal(hash)
+// GroupFilter selects the groups returned by ListImageGroups. Without a
+// Status, all groups that are not archived are returned. Path, Directory,
+// Extension and the sizes select groups with a file that has not been
+// trashed matching all of them: Path is a part of its path, Directory one
+// of its parent directories. Other empty fields match everything and a zero
+// Limit returns all groups.
+type GroupFilter struct {
+	Kind      Kind
+	Status    GroupStatus
+	Path      string
+	Directory string
+	Extension string
+	MinSize   int64
+	MaxSize   int64
+	MinCount  int
+	MaxCount  int
+	Sort      GroupSort
+	Limit     int
+	Cursor    string
+}
+
+func (s *Storage) CreateImageGroup(kind Kind, hash string, size int64, fileCount int) (int, error) {
+	return createImageGroup(s.db, kind, hash, size, fileCount)
+}
 
-	result, err := s.db.Exec(
-		"INSERT INTO image_groups (hash, size, image_count) VALUES (?, ?, ?)",
-		hashJSON, size, fileCount,
+func createImageGroup(db dbtx, kind Kind, hash string, size int64, fileCount int) (int, error) {
+	result, err := db.Exec(
+		"INSERT INTO image_groups (kind, hash, size, image_count) VALUES (?, ?, ?, ?)",
+		kind, hash, size, fileCount,
 	)
 	if err != nil {
 		return 0, err
@@ -45,65 +79,175 @@ func (s *Storage) CreateImageGroup(hash []int, size int64, fileCount int) (int,
 	return int(id), nil
 }
 
-func (s *Storage) ListImageGroups() ([]ImageGroup, error) {
-	groupRows, err := s.db.Query(
-		`
-		SELECT g.id, g.image_count, g.updated_at,
-			CASE
-				WHEN SUM(
-					CASE
-						WHEN i.action = 'pending' THEN 1 
-						ELSE 0 
-						END
-					) > 0
-		    THEN 'pending'
-		    ELSE 'decided'
-		  END as status
-		FROM image_groups g
-		LEFT JOIN images i ON g.id = i.group_id
-		GROUP BY g.id
-		ORDER BY
-		  CASE WHEN status = 'pending' THEN 0 ELSE 1 END,
-		  updated_at DESC NULLS LAST
-		`)
+// groupStatus derives the status of the group g joined with its images i:
+// archived once archived, pending while any of its current files is pending,
+// decided otherwise.
+const groupStatus = `
+	CASE
+		WHEN g.archived_at IS NOT NULL THEN 'archived'
+		WHEN SUM(CASE WHEN i.action = 'pending' AND i.stale = 0 THEN 1 ELSE 0 END) > 0 THEN 'pending'
+		ELSE 'decided'
+	END`
+
+// currentFile matches the images i that have not been trashed and are
+// still on disk.
+const currentFile = "i.action != 'trashed' AND i.stale = 0"
+
+// ListImageGroups returns a page of the groups matching filter, ordered by
+// filter.Sort and starting after filter.Cursor.
+func (s *Storage) ListImageGroups(filter GroupFilter) (GroupPage, error) {
+	page := GroupPage{Groups: []ImageGroup{}}
+
+	var cursor *groupCursor
+	if filter.Cursor != "" {
+		c, err := decodeCursor(filter.Sort, filter.Cursor)
+		if err != nil {
+			return page, err
+		}
+		cursor = &c
+	}
+
+	where := "g.kind = ?"
+	args := []any{filter.Kind}
+	if filter.MinCount > 0 {
+		where += " AND g.image_count >= ?"
+		args = append(args, filter.MinCount)
+	}
+	if filter.MaxCount > 0 {
+		where += " AND g.image_count <= ?"
+		args = append(args, filter.MaxCount)
+	}
+	if filter.hasFileConditions() {
+		files := "f.action != 'trashed' AND f.stale = 0"
+		if filter.Path != "" {
+			files += " AND instr(f.path, ?) > 0"
+			args = append(args, filter.Path)
+		}
+		if dir := filter.directory(); dir != "" {
+			// a range rather than LIKE, so that the index on path is used
+			files += " AND f.path >= ? AND f.path < ?"
+			args = append(args, dir, dir[:len(dir)-1]+"0")
+		}
+		if ext := filter.extension(); ext != "" {
+			files += " AND LOWER(substr(f.path, -?)) = ?"
+			args = append(args, utf8.RuneCountInString(ext), ext)
+		}
+		if filter.MinSize > 0 {
+			files += " AND f.image_size >= ?"
+			args = append(args, filter.MinSize)
+		}
+		if filter.MaxSize > 0 {
+			files += " AND f.image_size <= ?"
+			args = append(args, filter.MaxSize)
+		}
+		where += " AND g.id IN (SELECT f.group_id FROM images f WHERE " + files + ")"
+	}
+
+	having := "status != 'archived'"
+	if filter.Status != "" {
+		having = "status = ?"
+		args = append(args, filter.Status)
+	}
+
+	listed := fmt.Sprintf(`
+		WITH listed AS (
+		  SELECT g.id, g.kind, g.image_count, g.updated_at, g.archived_at,
+		    %s as status,
+		    COALESCE(SUM(CASE WHEN %s THEN i.image_size END), 0) as total_size,
+		    COALESCE(SUM(CASE WHEN %[2]s THEN i.image_size END), 0) -
+		      COALESCE(MAX(CASE WHEN %[2]s THEN i.image_size END), 0) as reclaimable,
+		    COALESCE(g.updated_at, '') as updated_key
+		  FROM image_groups g
+		  LEFT JOIN images i ON g.id = i.group_id
+		  WHERE %s
+		  GROUP BY g.id
+		  HAVING %s
+		)`, groupStatus, currentFile, where, having)
+
+	if err := s.db.QueryRow(listed+" SELECT COUNT(*) FROM listed", args...).Scan(&page.Total); err != nil {
+		return page, fmt.Errorf("failed to count groups: %w", err)
+	}
+
+	query := listed + `
+		SELECT l.id, l.kind, l.image_count, l.total_size, l.reclaimable, g.updated_at, g.archived_at, l.status,
+		  m.image_id, m.artist, m.title, m.album, m.year, m.bitrate, m.length, m.genre
+		FROM listed l
+		JOIN image_groups g ON g.id = l.id
+		LEFT JOIN music_tags m ON m.image_id = (
+		  SELECT MIN(id) FROM images WHERE group_id = l.id
+		)`
+	if cursor != nil {
+		after, afterArgs := afterCursor(filter.Sort, *cursor)
+		query += " WHERE " + after
+		args = append(args, afterArgs...)
+	}
+
+	var order []string
+	for _, col := range filter.Sort.columns() {
+		if col.desc {
+			order = append(order, col.expr+" DESC")
+		} else {
+			order = append(order, col.expr)
+		}
+	}
+	query += " ORDER BY " + strings.Join(append(order, "l.id"), ", ")
+
+	// one more than asked for tells whether there is a next page
+	if filter.Limit > 0 {
+		query += " LIMIT ?"
+		args = append(args, filter.Limit+1)
+	}
+
+	groupRows, err := s.db.Query(query, args...)
 	if err != nil {
-		return nil, err
+		return page, err
 	}
 	defer groupRows.Close()
 
-	var groups []ImageGroup
 	for groupRows.Next() {
 		var g ImageGroup
+		var music nullMusicTags
 
 		if err := groupRows.Scan(
 			&g.ID,
+			&g.Kind,
 			&g.ImageCount,
+			&g.Size,
+			&g.Reclaimable,
 			&g.UpdatedAt,
+			&g.ArchivedAt,
 			&g.Status,
+			&music.imageID, &music.artist, &music.title, &music.album,
+			&music.year, &music.bitrate, &music.length, &music.genre,
 		); err != nil {
-			return nil, err
+			return page, err
 		}
-		groups = append(groups, g)
+		// the tags of the group's first file describe the group
+		g.Music = music.get()
+		page.Groups = append(page.Groups, g)
 	}
-	return groups, nil
+	if err := groupRows.Err(); err != nil {
+		return page, err
+	}
+
+	return page.paginate(filter), nil
 }
 
-func (s *Storage) GetImageGroupStats() (ImageGroupStats, error) {
-	rows, err := s.db.Query(`
+// GetImageGroupStats counts the pending, decided and archived groups of
+// kind. The trash count covers all kinds and findings, since a trash run
+// moves them all.
+func (s *Storage) GetImageGroupStats(kind Kind) (ImageGroupStats, error) {
+	rows, err := s.db.Query(fmt.Sprintf(`
 		SELECT status, COUNT(*) as count
 		FROM (
-		  SELECT g.id,
-				CASE
-		      WHEN SUM(CASE WHEN i.action = 'pending' THEN 1 ELSE 0 END) > 0
-		      THEN 'pending'
-		      ELSE 'decided'
-	 			END as status
-			FROM image_groups g
+		  SELECT g.id, %s as status
+		  FROM image_groups g
 		  LEFT JOIN images i ON g.id = i.group_id
+		  WHERE g.kind = ?
 		  GROUP BY g.id
 		) as group_statuses
 		GROUP BY status
-		`)
+		`, groupStatus), kind)
 	if err != nil {
 		return ImageGroupStats{}, err
 	}
@@ -125,10 +269,15 @@ func (s *Storage) GetImageGroupStats() (ImageGroupStats, error) {
 			gs.Pending = count
 		case "decided":
 			gs.Decided = count
+		case "archived":
+			gs.Archived = count
 		}
 	}
 
-	row := s.db.QueryRow("SELECT COUNT(*) FROM images WHERE action = 'trash'")
+	row := s.db.QueryRow(`
+		SELECT
+			(SELECT COUNT(*) FROM images WHERE action = 'trash' AND stale = 0) +
+			(SELECT COUNT(*) FROM findings WHERE action = 'trash')`)
 
 	if err := row.Scan(&gs.ImagesToTrashCount); err != nil {
 		return gs, err
@@ -136,3 +285,39 @@ func (s *Storage) GetImageGroupStats() (ImageGroupStats, error) {
 
 	return gs, nil
 }
+
+// SetGroupArchived archives a group, hiding it from the default listing, or
+// brings it back. Archiving an archived group keeps its archive time.
+func (s *Storage) SetGroupArchived(id int, archived bool) error {
+	query := "UPDATE image_groups SET archived_at = COALESCE(archived_at, CURRENT_TIMESTAMP) WHERE id = ?"
+	if !archived {
+		query = "UPDATE image_groups SET archived_at = NULL WHERE id = ?"
+	}
+
+	result, err := s.db.Exec(query, id)
+	if err != nil {
+		return err
+	}
+	return expectOneRow(result, fmt.Errorf("group %d: %w", id, ErrNotFound))
+}
+
+// archiveTrashedGroups archives the groups of the files moved to the trash
+// once none of their files is pending or waiting to be trashed any more.
+func archiveTrashedGroups(db dbtx, fileIDs []int) (int, error) {
+	archived, err := execInChunks(db, `
+		UPDATE image_groups
+		SET archived_at = CURRENT_TIMESTAMP
+		WHERE archived_at IS NULL
+		AND id IN (SELECT group_id FROM images WHERE id IN (%s))
+		AND NOT EXISTS (
+		  SELECT 1 FROM images
+		  WHERE group_id = image_groups.id
+		  AND action IN ('pending', 'trash') AND stale = 0
+		)`,
+		fileIDs,
+	)
+	if err != nil {
+		return archived, fmt.Errorf("failed to archive trashed groups: %w", err)
+	}
+	return archived, nil
+}
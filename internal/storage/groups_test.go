@@ -0,0 +1,42 @@
+package storage
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestArchiveTrashedGroupsOfManyFiles(t *testing.T) {
+	s, err := New(filepath.Join(t.TempDir(), "db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	gid, err := s.CreateImageGroup(KindImage, "hash", 1, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, err := s.CreateImage(gid, ScanFile{Path: "/a.jpg", Size: 1, ModifiedDate: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.updateDBForTrashedImage(id, "/trash/a.jpg"); err != nil {
+		t.Fatal(err)
+	}
+
+	// more files than SQLite binds variables in one statement, the trashed
+	// one last
+	ids := make([]int, 40000)
+	for i := range ids {
+		ids[i] = id + 1 + i
+	}
+	ids[len(ids)-1] = id
+
+	archived, err := archiveTrashedGroups(s.db, ids)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if archived != 1 {
+		t.Errorf("archived %d groups, want 1", archived)
+	}
+}
@@ -1,7 +1,8 @@
 package storage
 
 import (
-	_ "database/sql"
+	"database/sql"
+	"errors"
 	"fmt"
 	"io"
 	"log"
@@ -9,16 +10,23 @@ import (
 	"path/filepath"
 	"strings"
 	"time"
+
+	"github.com/fadykuzman/schluckauf/internal/library"
 )
 
 type ImageAction string
 
 type Image struct {
-	ID        int         `json:"id"`
-	GroupID   int         `json:"groupId"`
-	Path      string      `json:"path"`
-	Imagesize int64       `json:"imageSize"`
-	Action    ImageAction `json:"action"`
+	ID           int            `json:"id"`
+	GroupID      int            `json:"groupId"`
+	Path         string         `json:"path"`
+	Imagesize    int64          `json:"imageSize"`
+	ModifiedDate int64          `json:"modifiedDate"`
+	Action       ImageAction    `json:"action"`
+	Stale        bool           `json:"stale"`
+	Image        *ImageMetadata `json:"image,omitempty"`
+	Video        *VideoMetadata `json:"video,omitempty"`
+	Music        *MusicTags     `json:"music,omitempty"`
 }
 
 type ImageToTrash struct {
@@ -28,16 +36,23 @@ type ImageToTrash struct {
 
 type TrashImagesResponse struct {
 	MovedCount      int      `json:"movedCount"`
+	RenamedCount    int      `json:"renamedCount"`
 	FailedCount     int      `json:"failedCount"`
 	PartialFailures int      `json:"partialfailures"`
 	TotalCount      int      `json:"totalCount"`
+	ArchivedGroups  int      `json:"archivedGroups"`
 	Errors          []string `json:"errors"`
 }
 
-func (s *Storage) CreateImage(groupID int, path string, filesize int64) (int, error) {
-	result, err := s.db.Exec(
-		"INSERT INTO images (group_id, path, image_size) VALUES (?, ?,?)",
-		groupID, path, filesize,
+func (s *Storage) CreateImage(groupID int, file ScanFile) (int, error) {
+	return createImage(s.db, groupID, file)
+}
+
+func createImage(db dbtx, groupID int, file ScanFile) (int, error) {
+	result, err := db.Exec(`
+		INSERT INTO images (group_id, path, image_size, modified_date, width, height, similarity, hash)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		append([]any{groupID, file.Path, file.Size, file.ModifiedDate}, imageColumns(file)...)...,
 	)
 	if err != nil {
 		return 0, fmt.Errorf("failed to insert image: %w", err)
@@ -47,17 +62,27 @@ func (s *Storage) CreateImage(groupID int, path string, filesize int64) (int, er
 	if err != nil {
 		return 0, fmt.Errorf("failed to get last insertId for image: %w", err)
 	}
+
+	if err := saveFileMetadata(db, int(id), file); err != nil {
+		return 0, err
+	}
 	return int(id), nil
 }
 
 func (s *Storage) GetGroupImages(groupID int) ([]Image, error) {
 	rows, err := s.db.Query(
 		`
-				SELECT id, group_id, path, image_size, action 
-				FROM images 
-				WHERE group_id=?
-				AND action != 'trashed'
-				ORDER BY id
+				SELECT i.id, i.group_id, i.path, i.image_size, COALESCE(i.modified_date, 0), i.action, i.stale,
+					i.width, i.height, i.similarity, i.hash,
+					v.image_id, v.duration, v.width, v.height, v.codec, v.bitrate, v.container,
+					m.image_id, m.artist, m.title, m.album, m.year, m.bitrate, m.length, m.genre
+				FROM images i
+				LEFT JOIN video_metadata v ON v.image_id = i.id
+				LEFT JOIN music_tags m ON m.image_id = i.id
+				WHERE i.group_id=?
+				AND i.action != 'trashed'
+				AND i.stale = 0
+				ORDER BY i.id
 		`,
 		groupID,
 	)
@@ -71,15 +96,46 @@ func (s *Storage) GetGroupImages(groupID int) ([]Image, error) {
 
 	for rows.Next() {
 		var f Image
-		if err := rows.Scan(&f.ID, &f.GroupID, &f.Path, &f.Imagesize, &f.Action); err != nil {
+		var image nullImageMetadata
+		var video nullVideoMetadata
+		var music nullMusicTags
+		if err := rows.Scan(
+			&f.ID, &f.GroupID, &f.Path, &f.Imagesize, &f.ModifiedDate, &f.Action, &f.Stale,
+			&image.width, &image.height, &image.similarity, &image.hash,
+			&video.imageID, &video.duration, &video.width, &video.height,
+			&video.codec, &video.bitrate, &video.container,
+			&music.imageID, &music.artist, &music.title, &music.album,
+			&music.year, &music.bitrate, &music.length, &music.genre,
+		); err != nil {
 			return nil, err
 		}
+		f.Image = image.get()
+		f.Video = video.get()
+		f.Music = music.get()
 		images = append(images, f)
 	}
 
 	return images, nil
 }
 
+// GetImagePath returns the path of file id, unless it has been trashed.
+func (s *Storage) GetImagePath(id int) (string, error) {
+	var path string
+	err := s.db.QueryRow(
+		"SELECT path FROM images WHERE id = ? AND action != ?",
+		id, ActionTrashed,
+	).Scan(&path)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", fmt.Errorf("file %d: %w", id, ErrNotFound)
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to query file %d: %w", id, err)
+	}
+	return path, nil
+}
+
+// UpdateImageAction records the decision on file fileID of group groupID,
+// failing with ErrNotFound if the group has no such file.
 func (s *Storage) UpdateImageAction(groupID int, fileID int, action ImageAction) error {
 	tx, err := s.db.Begin()
 	if err != nil {
@@ -88,13 +144,16 @@ func (s *Storage) UpdateImageAction(groupID int, fileID int, action ImageAction)
 
 	defer tx.Rollback()
 
-	_, err = tx.Exec(
-		"UPDATE images SET action = ? WHERE id = ?",
-		action, fileID,
+	result, err := tx.Exec(
+		"UPDATE images SET action = ? WHERE id = ? AND group_id = ?",
+		action, fileID, groupID,
 	)
 	if err != nil {
 		return err
 	}
+	if err := expectOneRow(result, fmt.Errorf("file %d of group %d: %w", fileID, groupID, ErrNotFound)); err != nil {
+		return err
+	}
 
 	_, errGroup := tx.Exec(
 		" UPDATE image_groups SET updated_at = CURRENT_TIMESTAMP WHERE id = ?",
@@ -110,7 +169,7 @@ func (s *Storage) UpdateImageAction(groupID int, fileID int, action ImageAction)
 
 func (s *Storage) TrashImages() (TrashImagesResponse, error) {
 	rows, err := s.db.Query(`
-		SELECT id, path FROM images WHERE action = 'trash'
+		SELECT id, path FROM images WHERE action = 'trash' AND stale = 0
 		`)
 	if err != nil {
 		return TrashImagesResponse{}, fmt.Errorf("failed to query images to trash: %w", err)
@@ -133,12 +192,13 @@ func (s *Storage) TrashImages() (TrashImagesResponse, error) {
 	var failedCount int
 	var partialFailures int
 	var errors []string
+	var movedIDs []int
 
 	timestamp := time.Now().Format("2006-01-02_15-04-05")
 
 	for _, image := range imagesToTrash {
 		log.Printf("Moving file %d to trash", image.ID)
-		destPath, err := moveImageToTrash(image, timestamp)
+		destPath, err := moveImageToTrash(s.library, image, timestamp)
 
 		if err != nil {
 			log.Printf("Error moving file %d to trash", image.ID)
@@ -153,18 +213,32 @@ func (s *Storage) TrashImages() (TrashImagesResponse, error) {
 				partialFailures++
 			} else {
 				movedCount++
+				movedIDs = append(movedIDs, image.ID)
 			}
 		}
 	}
 
+	archivedGroups, err := archiveTrashedGroups(s.db, movedIDs)
+	if err != nil {
+		log.Print(err)
+		errors = append(errors, err.Error())
+	}
+
 	response := TrashImagesResponse{
 		MovedCount:      movedCount,
 		FailedCount:     failedCount,
 		PartialFailures: partialFailures,
 		TotalCount:      movedCount + failedCount + partialFailures,
+		ArchivedGroups:  archivedGroups,
 		Errors:          errors,
 	}
 
+	findingsToTrash, err := s.findingsMarkedForTrash()
+	if err != nil {
+		return response, err
+	}
+	s.applyFindingActions(findingsToTrash, timestamp, &response)
+
 	return response, nil
 }
 
@@ -188,7 +262,13 @@ func (s *Storage) updateDBForTrashedImage(fileID int, newPath string) error {
 	return nil
 }
 
-func moveImageToTrash(image ImageToTrash, timestamp string) (string, error) {
+// moveImageToTrash moves image to the trash directory under timestamp,
+// unless it is outside the roots of lib.
+func moveImageToTrash(lib *library.Library, image ImageToTrash, timestamp string) (string, error) {
+	if err := checkEntry(lib, image.Path); err != nil {
+		return "", err
+	}
+
 	trashPath := os.Getenv("TRASH_DIR")
 	if trashPath == "" {
 		trashPath = "./trash"
@@ -238,13 +318,29 @@ func moveImageToTrash(image ImageToTrash, timestamp string) (string, error) {
 	return destPath, nil
 }
 
-func (s *Storage) DeleteAllImages() error {
-	_, err := s.db.Exec("DELETE FROM images")
+// DeleteImageGroups deletes all groups of the given kind with their images.
+func (s *Storage) DeleteImageGroups(kind Kind) error {
+	return deleteImageGroups(s.db, kind)
+}
+
+func deleteImageGroups(db dbtx, kind Kind) error {
+	err := deleteFileMetadata(db,
+		"SELECT i.id FROM images i JOIN image_groups g ON g.id = i.group_id WHERE g.kind = ?",
+		kind,
+	)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec(
+		"DELETE FROM images WHERE group_id IN (SELECT id FROM image_groups WHERE kind = ?)",
+		kind,
+	)
 	if err != nil {
 		return fmt.Errorf("failed to delete pending images %w", err)
 	}
 
-	_, err = s.db.Exec("DELETE FROM image_groups")
+	_, err = db.Exec("DELETE FROM image_groups WHERE kind = ?", kind)
 	if err != nil {
 		return fmt.Errorf("failed to delete image groups %w", err)
 	}
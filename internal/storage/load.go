@@ -0,0 +1,392 @@
+package storage
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/fs"
+	"iter"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// ScanGroup is a duplicate group found by a scan, ready to be stored.
+// Hash is stored as-is, so callers pass it already encoded.
+type ScanGroup struct {
+	Hash  string
+	Size  int64
+	Files []ScanFile
+}
+
+type ScanFile struct {
+	Path         string
+	Size         int64
+	ModifiedDate int64
+	Image        *ImageMetadata
+	Video        *VideoMetadata
+	Music        *MusicTags
+}
+
+// LoadReport summarizes how scan results were reconciled with the stored
+// groups and images.
+type LoadReport struct {
+	GroupsAdded   int `json:"groupsAdded"`
+	GroupsCarried int `json:"groupsCarriedOver"`
+	GroupsChanged int `json:"groupsChanged"`
+	GroupsRemoved int `json:"groupsRemoved"`
+	FilesAdded    int `json:"filesAdded"`
+	FilesCarried  int `json:"filesCarriedOver"`
+	FilesChanged  int `json:"filesChanged"`
+	FilesRemoved  int `json:"filesRemoved"`
+}
+
+type dbtx interface {
+	Exec(query string, args ...any) (sql.Result, error)
+	Query(query string, args ...any) (*sql.Rows, error)
+	QueryRow(query string, args ...any) *sql.Row
+}
+
+// loadBatchSize is the number of groups read before their images are
+// inserted when replacing groups.
+const loadBatchSize = 500
+
+// ReplaceImageGroups drops all stored groups of kind, including review
+// decisions, and stores groups in their place, all in one transaction:
+// if anything fails, including reading groups, the previous groups are
+// kept. Groups are stored in batches as they are read, so they never have
+// to be held in memory all at once.
+func (s *Storage) ReplaceImageGroups(kind Kind, groups iter.Seq2[ScanGroup, error]) (LoadReport, error) {
+	var report LoadReport
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return report, err
+	}
+	defer tx.Rollback()
+
+	row := tx.QueryRow(`
+		SELECT
+			(SELECT COUNT(*) FROM image_groups WHERE kind = ?),
+			(SELECT COUNT(*) FROM images i JOIN image_groups g ON g.id = i.group_id
+			 WHERE g.kind = ? AND i.action != 'trashed')`,
+		kind, kind,
+	)
+	if err := row.Scan(&report.GroupsRemoved, &report.FilesRemoved); err != nil {
+		return report, fmt.Errorf("failed to count previous scan data: %w", err)
+	}
+
+	// Clear pending data
+	if err := deleteImageGroups(tx, kind); err != nil {
+		return report, fmt.Errorf("error clearing previous scan data: %w", err)
+	}
+
+	loader, err := newBulkLoader(tx, kind)
+	if err != nil {
+		return report, err
+	}
+	defer loader.close()
+
+	// Load new scan results into database
+	batch := make([]ScanGroup, 0, loadBatchSize)
+	for group, err := range groups {
+		if err != nil {
+			return report, fmt.Errorf("failed to read groups: %w", err)
+		}
+
+		batch = append(batch, group)
+		if len(batch) == loadBatchSize {
+			if err := loader.insertGroups(batch, &report); err != nil {
+				return report, err
+			}
+			batch = batch[:0]
+		}
+	}
+	if err := loader.insertGroups(batch, &report); err != nil {
+		return report, err
+	}
+
+	return report, tx.Commit()
+}
+
+type storedImage struct {
+	id           int
+	groupID      int
+	path         string
+	size         int64
+	modifiedDate sql.NullInt64
+	stale        bool
+}
+
+// unchanged reports whether file still matches the stored image. Images
+// stored before modification dates were recorded only match by path.
+func (i storedImage) unchanged(file ScanFile) bool {
+	if !i.modifiedDate.Valid {
+		return true
+	}
+	return i.size == file.Size && i.modifiedDate.Int64 == file.ModifiedDate
+}
+
+// MergeImageGroups reconciles groups found by scanning directory with the
+// stored ones by path, size and modification date:
+//
+//   - groups whose files are all unchanged are kept as they are,
+//   - groups that gained or lost files keep their ID, and with it when they
+//     were decided on or archived, if their stored files all come from the
+//     same group,
+//   - unchanged files keep their action when they end up in another group,
+//   - changed and new files are pending again,
+//   - files under directory missing from the results are dropped if they
+//     still exist (they are no longer duplicates) or marked stale if they
+//     vanished from disk.
+//
+// Images outside of directory or in groups of another kind are left
+// untouched. Groups are reconciled one at a time as they are read, and
+// nothing is changed if groups yields an error.
+func (s *Storage) MergeImageGroups(kind Kind, directory string, groups iter.Seq2[ScanGroup, error]) (LoadReport, error) {
+	var report LoadReport
+
+	absDir, err := filepath.Abs(directory)
+	if err != nil {
+		return report, fmt.Errorf("invalid scan directory: %w", err)
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return report, err
+	}
+	defer tx.Rollback()
+
+	stored, err := loadStoredImages(tx, kind)
+	if err != nil {
+		return report, err
+	}
+
+	loader, err := newMergeLoader(tx, kind)
+	if err != nil {
+		return report, err
+	}
+	defer loader.close()
+
+	byPath := make(map[string]storedImage, len(stored))
+	activeCount := make(map[int]int)
+	for _, img := range stored {
+		byPath[img.path] = img
+		if !img.stale {
+			activeCount[img.groupID]++
+		}
+	}
+
+	seen := make(map[int]bool)
+	claimedGroups := make(map[int]bool)
+	touchedGroups := make(map[int]bool)
+
+	for group, err := range groups {
+		if err != nil {
+			return report, fmt.Errorf("failed to read groups: %w", err)
+		}
+
+		if gid, ok := carriedOverGroup(group, byPath, activeCount, claimedGroups, seen); ok {
+			claimedGroups[gid] = true
+			for _, file := range group.Files {
+				img := byPath[file.Path]
+				if err := loader.moveImage(img.id, gid, file, false); err != nil {
+					return report, err
+				}
+				seen[img.id] = true
+			}
+			report.GroupsCarried++
+			report.FilesCarried += len(group.Files)
+			continue
+		}
+
+		gid, ok := changedGroup(group, byPath, claimedGroups, seen)
+		if ok {
+			claimedGroups[gid] = true
+			if err := loader.updateGroup(gid, group); err != nil {
+				return report, err
+			}
+		} else {
+			gid, err = loader.createGroup(group.Hash, group.Size, len(group.Files))
+			if err != nil {
+				return report, err
+			}
+		}
+
+		hadExisting := false
+		for _, file := range group.Files {
+			img, ok := byPath[file.Path]
+			if !ok {
+				if err := loader.addImage(gid, file); err != nil {
+					return report, err
+				}
+				report.FilesAdded++
+				continue
+			}
+
+			hadExisting = true
+			touchedGroups[img.groupID] = true
+			seen[img.id] = true
+
+			unchanged := img.unchanged(file)
+			if err := loader.moveImage(img.id, gid, file, !unchanged); err != nil {
+				return report, err
+			}
+			if unchanged {
+				report.FilesCarried++
+			} else {
+				report.FilesChanged++
+			}
+		}
+
+		if hadExisting {
+			report.GroupsChanged++
+		} else {
+			report.GroupsAdded++
+		}
+	}
+
+	if err := loader.flush(); err != nil {
+		return report, err
+	}
+
+	var staleIDs, removedIDs []int
+	for _, img := range stored {
+		if seen[img.id] || !withinDir(absDir, img.path) {
+			continue
+		}
+
+		_, statErr := os.Stat(img.path)
+		switch {
+		case errors.Is(statErr, fs.ErrNotExist):
+			if img.stale {
+				continue
+			}
+			staleIDs = append(staleIDs, img.id)
+		default:
+			removedIDs = append(removedIDs, img.id)
+		}
+		touchedGroups[img.groupID] = true
+		report.FilesRemoved++
+	}
+
+	if _, err := execInChunks(tx, "UPDATE images SET stale = 1 WHERE id IN (%s)", staleIDs); err != nil {
+		return report, fmt.Errorf("failed to mark images as stale: %w", err)
+	}
+	err = inChunks(removedIDs, func(placeholders string, args []any) error {
+		if err := deleteFileMetadata(tx, placeholders, args...); err != nil {
+			return err
+		}
+		if _, err := tx.Exec("DELETE FROM images WHERE id IN ("+placeholders+")", args...); err != nil {
+			return fmt.Errorf("failed to delete images: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return report, err
+	}
+
+	groupIDs := slices.Sorted(maps.Keys(touchedGroups))
+	report.GroupsRemoved, err = execInChunks(tx, `
+		DELETE FROM image_groups
+		WHERE id IN (%s)
+		AND NOT EXISTS (SELECT 1 FROM images WHERE group_id = image_groups.id)`,
+		groupIDs,
+	)
+	if err != nil {
+		return report, fmt.Errorf("failed to delete emptied image groups: %w", err)
+	}
+	_, err = execInChunks(tx, `
+		UPDATE image_groups
+		SET image_count = (
+			SELECT COUNT(*) FROM images
+			WHERE group_id = image_groups.id AND action != 'trashed' AND stale = 0
+		)
+		WHERE id IN (%s)`,
+		groupIDs,
+	)
+	if err != nil {
+		return report, fmt.Errorf("failed to update image counts: %w", err)
+	}
+
+	return report, tx.Commit()
+}
+
+// carriedOverGroup returns the stored group that consists of exactly the
+// unchanged files of group, if there is one.
+func carriedOverGroup(group ScanGroup, byPath map[string]storedImage, activeCount map[int]int, claimed map[int]bool, seen map[int]bool) (int, bool) {
+	gid := -1
+	for _, file := range group.Files {
+		img, ok := byPath[file.Path]
+		if !ok || img.stale || seen[img.id] || !img.unchanged(file) {
+			return 0, false
+		}
+		if gid == -1 {
+			gid = img.groupID
+		} else if gid != img.groupID {
+			return 0, false
+		}
+	}
+
+	if gid == -1 || claimed[gid] || activeCount[gid] != len(group.Files) {
+		return 0, false
+	}
+	return gid, true
+}
+
+// changedGroup returns the stored group that all stored files of group come
+// from, if there are any and the group wasn't claimed by another one yet.
+func changedGroup(group ScanGroup, byPath map[string]storedImage, claimed map[int]bool, seen map[int]bool) (int, bool) {
+	gid := -1
+	for _, file := range group.Files {
+		img, ok := byPath[file.Path]
+		if !ok || seen[img.id] {
+			continue
+		}
+		if gid == -1 {
+			gid = img.groupID
+		} else if gid != img.groupID {
+			return 0, false
+		}
+	}
+
+	if gid == -1 || claimed[gid] {
+		return 0, false
+	}
+	return gid, true
+}
+
+func loadStoredImages(tx dbtx, kind Kind) ([]storedImage, error) {
+	rows, err := tx.Query(`
+		SELECT i.id, i.group_id, i.path, i.image_size, i.modified_date, i.stale
+		FROM images i
+		JOIN image_groups g ON g.id = i.group_id
+		WHERE g.kind = ?
+		AND i.action != 'trashed'
+		ORDER BY i.id
+	`, kind)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query stored images: %w", err)
+	}
+	defer rows.Close()
+
+	var images []storedImage
+	for rows.Next() {
+		var img storedImage
+		if err := rows.Scan(&img.id, &img.groupID, &img.path, &img.size, &img.modifiedDate, &img.stale); err != nil {
+			return nil, err
+		}
+		images = append(images, img)
+	}
+	return images, rows.Err()
+}
+
+func withinDir(dir, path string) bool {
+	rel, err := filepath.Rel(dir, path)
+	if err != nil {
+		return false
+	}
+	return rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
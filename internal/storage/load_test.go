@@ -0,0 +1,125 @@
+package storage_test
+
+import (
+	"iter"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/fadykuzman/schluckauf/internal/storage"
+)
+
+// TestMergeKeepsChangedGroups checks that a group gaining or losing files
+// in a merge keeps its ID and when it was decided on.
+func TestMergeKeepsChangedGroups(t *testing.T) {
+	dir := t.TempDir()
+	file := func(name string) storage.ScanFile {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(name), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return storage.ScanFile{Path: path, Size: 1, ModifiedDate: 1}
+	}
+	a, b, c := file("a.jpg"), file("b.jpg"), file("c.jpg")
+
+	s := open(t)
+	if _, err := s.ReplaceImageGroups(storage.KindImage, groups(a, b)); err != nil {
+		t.Fatal(err)
+	}
+	before := listGroups(t, s)
+	if len(before) != 1 {
+		t.Fatalf("groups = %+v, want one", before)
+	}
+	gid := before[0].ID
+	images, err := s.GetGroupImages(gid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.UpdateImageAction(gid, images[0].ID, storage.ActionKeep); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		files []storage.ScanFile
+		want  storage.LoadReport
+	}{
+		{"gained", []storage.ScanFile{a, b, c}, storage.LoadReport{GroupsChanged: 1, FilesAdded: 1, FilesCarried: 2}},
+		{"lost", []storage.ScanFile{a, b}, storage.LoadReport{GroupsChanged: 1, FilesCarried: 2, FilesRemoved: 1}},
+		{"unchanged", []storage.ScanFile{a, b}, storage.LoadReport{GroupsCarried: 1, FilesCarried: 2}},
+	}
+	for _, tt := range tests {
+		report, err := s.MergeImageGroups(storage.KindImage, dir, groups(tt.files...))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if report != tt.want {
+			t.Errorf("%s: report = %+v, want %+v", tt.name, report, tt.want)
+		}
+
+		after := listGroups(t, s)
+		if len(after) != 1 || after[0].ID != gid || after[0].ImageCount != len(tt.files) || after[0].UpdatedAt == nil {
+			t.Errorf("%s: groups = %+v, want group %d of %d files, decided on", tt.name, after, gid, len(tt.files))
+		}
+	}
+}
+
+// TestMergeManyFiles checks a merge that inserts more new files than fit in
+// one statement and marks vanished ones stale.
+func TestMergeManyFiles(t *testing.T) {
+	dir := t.TempDir()
+	var files []storage.ScanFile
+	for i := range 123 {
+		path := filepath.Join(dir, strconv.Itoa(i)+".jpg")
+		if err := os.WriteFile(path, nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		files = append(files, storage.ScanFile{Path: path, Size: 1, ModifiedDate: 1})
+	}
+
+	s := open(t)
+	if _, err := s.ReplaceImageGroups(storage.KindImage, groups(files[:3]...)); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(files[2].Path); err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := s.MergeImageGroups(storage.KindImage, dir, groups(append(files[:2:2], files[3:]...)...))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := storage.LoadReport{GroupsChanged: 1, FilesAdded: 120, FilesCarried: 2, FilesRemoved: 1}
+	if report != want {
+		t.Errorf("report = %+v, want %+v", report, want)
+	}
+
+	after := listGroups(t, s)
+	if len(after) != 1 || after[0].ImageCount != 122 {
+		t.Fatalf("groups = %+v, want one of 122 files", after)
+	}
+	images, err := s.GetGroupImages(after[0].ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(images) != 122 {
+		t.Errorf("group lists %d images, want 122 without the stale one", len(images))
+	}
+}
+
+func groups(files ...storage.ScanFile) iter.Seq2[storage.ScanGroup, error] {
+	return func(yield func(storage.ScanGroup, error) bool) {
+		yield(storage.ScanGroup{Hash: "hash", Size: 1, Files: files}, nil)
+	}
+}
+
+func listGroups(t *testing.T, s *storage.Storage) []storage.ImageGroup {
+	t.Helper()
+
+	page, err := s.ListImageGroups(storage.GroupFilter{Kind: storage.KindImage})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return page.Groups
+}
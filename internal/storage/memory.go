@@ -0,0 +1,351 @@
+package storage
+
+import (
+	"cmp"
+	"fmt"
+	"log"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/fadykuzman/schluckauf/internal/library"
+)
+
+// Memory is a GroupStore that keeps groups and images in memory, with the
+// same semantics as Storage. It has no findings, so trash runs only deal
+// with images, and as scan results are not merged into it, no file ever
+// becomes stale.
+type Memory struct {
+	mu      sync.Mutex
+	library *library.Library
+
+	groups      map[int]*memoryGroup
+	images      map[int]*Image
+	nextGroupID int
+	nextImageID int
+}
+
+type memoryGroup struct {
+	id         int
+	kind       Kind
+	hash       string
+	size       int64
+	count      int
+	updatedAt  *time.Time
+	archivedAt *time.Time
+}
+
+func NewMemory() *Memory {
+	return &Memory{
+		groups:      make(map[int]*memoryGroup),
+		images:      make(map[int]*Image),
+		nextGroupID: 1,
+		nextImageID: 1,
+	}
+}
+
+// SetLibrary restricts the files moved by trash runs to the roots of lib,
+// like Storage.SetLibrary.
+func (m *Memory) SetLibrary(lib *library.Library) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.library = lib
+}
+
+func (m *Memory) CreateImageGroup(kind Kind, hash string, size int64, fileCount int) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	id := m.nextGroupID
+	m.nextGroupID++
+	m.groups[id] = &memoryGroup{id: id, kind: kind, hash: hash, size: size, count: fileCount}
+	return id, nil
+}
+
+func (m *Memory) CreateImage(groupID int, file ScanFile) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	id := m.nextImageID
+	m.nextImageID++
+	m.images[id] = &Image{
+		ID:           id,
+		GroupID:      groupID,
+		Path:         file.Path,
+		Imagesize:    file.Size,
+		ModifiedDate: file.ModifiedDate,
+		Action:       ActionPending,
+		Image:        file.Image,
+		Video:        file.Video,
+		Music:        file.Music,
+	}
+	return id, nil
+}
+
+func (m *Memory) DeleteImageGroups(kind Kind) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for id, img := range m.images {
+		if g, ok := m.groups[img.GroupID]; ok && g.kind == kind {
+			delete(m.images, id)
+		}
+	}
+	for id, g := range m.groups {
+		if g.kind == kind {
+			delete(m.groups, id)
+		}
+	}
+	return nil
+}
+
+// ListImageGroups returns a page of the groups matching filter, like
+// Storage.ListImageGroups.
+func (m *Memory) ListImageGroups(filter GroupFilter) (GroupPage, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	page := GroupPage{Groups: []ImageGroup{}}
+
+	var cursor *groupCursor
+	if filter.Cursor != "" {
+		c, err := decodeCursor(filter.Sort, filter.Cursor)
+		if err != nil {
+			return page, err
+		}
+		cursor = &c
+	}
+
+	var groups []ImageGroup
+	for _, g := range m.groups {
+		if g.kind != filter.Kind || !filter.countMatches(g.count) {
+			continue
+		}
+		status := m.status(g)
+		if !filter.statusMatches(status) {
+			continue
+		}
+
+		group := ImageGroup{
+			ID:         g.id,
+			Kind:       g.kind,
+			ImageCount: g.count,
+			UpdatedAt:  g.updatedAt,
+			ArchivedAt: g.archivedAt,
+			Status:     status,
+		}
+		matched := !filter.hasFileConditions()
+		var largest int64
+		for _, img := range m.images {
+			if img.GroupID != g.id || img.Action == ActionTrashed {
+				continue
+			}
+			matched = matched || filter.fileMatches(img.Path, img.Imagesize)
+			group.Size += img.Imagesize
+			largest = max(largest, img.Imagesize)
+		}
+		if !matched {
+			continue
+		}
+		group.Reclaimable = group.Size - largest
+
+		// the tags of the group's first file describe the group
+		if first := m.firstImage(g.id); first != nil {
+			group.Music = first.Music
+		}
+		groups = append(groups, group)
+	}
+	page.Total = len(groups)
+
+	slices.SortFunc(groups, func(a, b ImageGroup) int { return compareGroups(filter.Sort, a, b) })
+	if cursor != nil {
+		groups = slices.DeleteFunc(groups, func(g ImageGroup) bool {
+			return compareKeys(filter.Sort, sortKeys(filter.Sort, g), g.ID, cursor.Values, cursor.ID) <= 0
+		})
+	}
+
+	if filter.Limit > 0 && len(groups) > filter.Limit+1 {
+		groups = groups[:filter.Limit+1]
+	}
+	page.Groups = append(page.Groups, groups...)
+	return page.paginate(filter), nil
+}
+
+// GetGroupImages returns the files of a group that have not been trashed,
+// in the order they were added.
+func (m *Memory) GetGroupImages(groupID int) ([]Image, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var images []Image
+	for _, img := range m.sortedImages() {
+		if img.GroupID == groupID && img.Action != ActionTrashed {
+			images = append(images, *img)
+		}
+	}
+	return images, nil
+}
+
+// GetImageGroupStats counts the pending, decided and archived groups of
+// kind and the files of all kinds marked to be trashed.
+func (m *Memory) GetImageGroupStats(kind Kind) (ImageGroupStats, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var gs ImageGroupStats
+	for _, g := range m.groups {
+		if g.kind != kind {
+			continue
+		}
+		switch m.status(g) {
+		case StatusPending:
+			gs.Pending++
+		case StatusDecided:
+			gs.Decided++
+		case StatusArchived:
+			gs.Archived++
+		}
+	}
+	for _, img := range m.images {
+		if img.Action == ActionTrash {
+			gs.ImagesToTrashCount++
+		}
+	}
+	return gs, nil
+}
+
+func (m *Memory) GetImagePath(id int) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	img, ok := m.images[id]
+	if !ok || img.Action == ActionTrashed {
+		return "", fmt.Errorf("file %d: %w", id, ErrNotFound)
+	}
+	return img.Path, nil
+}
+
+func (m *Memory) UpdateImageAction(groupID int, fileID int, action ImageAction) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	img, ok := m.images[fileID]
+	if !ok || img.GroupID != groupID {
+		return fmt.Errorf("file %d of group %d: %w", fileID, groupID, ErrNotFound)
+	}
+	img.Action = action
+
+	if g, ok := m.groups[groupID]; ok {
+		// stored with the second resolution of SQLite's CURRENT_TIMESTAMP
+		now := time.Now().UTC().Truncate(time.Second)
+		g.updatedAt = &now
+	}
+	return nil
+}
+
+// SetGroupArchived archives a group or brings it back, like
+// Storage.SetGroupArchived.
+func (m *Memory) SetGroupArchived(id int, archived bool) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	g, ok := m.groups[id]
+	if !ok {
+		return fmt.Errorf("group %d: %w", id, ErrNotFound)
+	}
+	switch {
+	case !archived:
+		g.archivedAt = nil
+	case g.archivedAt == nil:
+		now := time.Now().UTC().Truncate(time.Second)
+		g.archivedAt = &now
+	}
+	return nil
+}
+
+// TrashImages moves the files marked to be trashed to the trash directory
+// and archives the groups that are done with, like Storage.TrashImages.
+func (m *Memory) TrashImages() (TrashImagesResponse, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var response TrashImagesResponse
+	timestamp := time.Now().Format("2006-01-02_15-04-05")
+	trashedGroups := make(map[int]bool)
+
+	for _, img := range m.sortedImages() {
+		if img.Action != ActionTrash {
+			continue
+		}
+
+		destPath, err := moveImageToTrash(m.library, ImageToTrash{ID: img.ID, Path: img.Path}, timestamp)
+		if err != nil {
+			log.Printf("Error moving file %d to trash", img.ID)
+			response.Errors = append(response.Errors, fmt.Sprintf("Couldn't move file %s to trash. %s", img.Path, err))
+			response.FailedCount++
+			continue
+		}
+		img.Action = ActionTrashed
+		img.Path = destPath
+		response.MovedCount++
+		trashedGroups[img.GroupID] = true
+	}
+
+	now := time.Now().UTC().Truncate(time.Second)
+	for id := range trashedGroups {
+		g, ok := m.groups[id]
+		if !ok || g.archivedAt != nil || m.hasOpenFiles(id) {
+			continue
+		}
+		g.archivedAt = &now
+		response.ArchivedGroups++
+	}
+
+	response.TotalCount = response.MovedCount + response.FailedCount
+	return response, nil
+}
+
+// status derives the status of a group: archived once archived, pending
+// while any of its files is pending, decided otherwise.
+func (m *Memory) status(g *memoryGroup) GroupStatus {
+	if g.archivedAt != nil {
+		return StatusArchived
+	}
+	for _, img := range m.images {
+		if img.GroupID == g.id && img.Action == ActionPending {
+			return StatusPending
+		}
+	}
+	return StatusDecided
+}
+
+// hasOpenFiles reports whether a group has files that are pending or
+// waiting to be trashed.
+func (m *Memory) hasOpenFiles(groupID int) bool {
+	for _, img := range m.images {
+		if img.GroupID == groupID && (img.Action == ActionPending || img.Action == ActionTrash) {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *Memory) firstImage(groupID int) *Image {
+	var first *Image
+	for _, img := range m.images {
+		if img.GroupID == groupID && (first == nil || img.ID < first.ID) {
+			first = img
+		}
+	}
+	return first
+}
+
+func (m *Memory) sortedImages() []*Image {
+	images := make([]*Image, 0, len(m.images))
+	for _, img := range m.images {
+		images = append(images, img)
+	}
+	slices.SortFunc(images, func(a, b *Image) int { return cmp.Compare(a.ID, b.ID) })
+	return images
+}
@@ -0,0 +1,14 @@
+package storage_test
+
+import (
+	"testing"
+
+	"github.com/fadykuzman/schluckauf/internal/storage"
+	"github.com/fadykuzman/schluckauf/internal/storage/storagetest"
+)
+
+func TestMemory(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) storage.GroupStore {
+		return storage.NewMemory()
+	})
+}
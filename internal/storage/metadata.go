@@ -0,0 +1,161 @@
+package storage
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// ImageMetadata describes an image as compared by the scanner. Similarity
+// is the distance of its hash to the one of the group's reference image,
+// Hash is the hex encoded perceptual hash.
+type ImageMetadata struct {
+	Width      int     `json:"width"`
+	Height     int     `json:"height"`
+	Similarity float64 `json:"similarity"`
+	Hash       string  `json:"hash"`
+}
+
+// VideoMetadata describes the encoding of a video file, as reported by ffprobe.
+type VideoMetadata struct {
+	Duration  float64 `json:"duration"`
+	Width     int     `json:"width"`
+	Height    int     `json:"height"`
+	Codec     string  `json:"codec"`
+	Bitrate   int64   `json:"bitrate"`
+	Container string  `json:"container"`
+}
+
+// MusicTags are the tags czkawka read from a music file.
+type MusicTags struct {
+	Artist  string `json:"artist"`
+	Title   string `json:"title"`
+	Album   string `json:"album"`
+	Year    string `json:"year"`
+	Bitrate int    `json:"bitrate"`
+	Length  string `json:"length"`
+	Genre   string `json:"genre"`
+}
+
+// imageColumns returns the values of the width, height, similarity and hash
+// columns of images for file, which are NULL for files that aren't images.
+func imageColumns(file ScanFile) []any {
+	if file.Image == nil {
+		return []any{nil, nil, nil, nil}
+	}
+	return []any{file.Image.Width, file.Image.Height, file.Image.Similarity, file.Image.Hash}
+}
+
+// saveFileMetadata stores the kind specific metadata of a file, if any.
+func saveFileMetadata(db dbtx, imageID int, file ScanFile) error {
+	if file.Video != nil {
+		_, err := db.Exec(`
+			INSERT OR REPLACE INTO video_metadata
+				(image_id, duration, width, height, codec, bitrate, container)
+			VALUES (?, ?, ?, ?, ?, ?, ?)`,
+			imageID, file.Video.Duration, file.Video.Width, file.Video.Height,
+			file.Video.Codec, file.Video.Bitrate, file.Video.Container,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to save video metadata of image %d: %w", imageID, err)
+		}
+	}
+
+	if file.Music != nil {
+		_, err := db.Exec(`
+			INSERT OR REPLACE INTO music_tags
+				(image_id, artist, title, album, year, bitrate, length, genre)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+			imageID, file.Music.Artist, file.Music.Title, file.Music.Album,
+			file.Music.Year, file.Music.Bitrate, file.Music.Length, file.Music.Genre,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to save music tags of image %d: %w", imageID, err)
+		}
+	}
+
+	return nil
+}
+
+// metadataTables lists the tables holding per image metadata, which have
+// to be cleaned up with the images they belong to.
+var metadataTables = []string{"video_metadata", "music_tags"}
+
+// deleteFileMetadata deletes the metadata of the images selected by
+// imageQuery, a query returning image ids.
+func deleteFileMetadata(db dbtx, imageQuery string, args ...any) error {
+	for _, table := range metadataTables {
+		_, err := db.Exec(
+			fmt.Sprintf("DELETE FROM %s WHERE image_id IN (%s)", table, imageQuery),
+			args...,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to delete from %s: %w", table, err)
+		}
+	}
+	return nil
+}
+
+// nullImageMetadata scans the image columns of images.
+type nullImageMetadata struct {
+	width, height sql.NullInt64
+	similarity    sql.NullFloat64
+	hash          sql.NullString
+}
+
+func (i nullImageMetadata) get() *ImageMetadata {
+	if !i.width.Valid && !i.hash.Valid {
+		return nil
+	}
+	return &ImageMetadata{
+		Width:      int(i.width.Int64),
+		Height:     int(i.height.Int64),
+		Similarity: i.similarity.Float64,
+		Hash:       i.hash.String,
+	}
+}
+
+// nullVideoMetadata scans the columns of a LEFT JOIN on video_metadata.
+type nullVideoMetadata struct {
+	imageID          sql.NullInt64
+	duration         sql.NullFloat64
+	width, height    sql.NullInt64
+	codec, container sql.NullString
+	bitrate          sql.NullInt64
+}
+
+func (v nullVideoMetadata) get() *VideoMetadata {
+	if !v.imageID.Valid {
+		return nil
+	}
+	return &VideoMetadata{
+		Duration:  v.duration.Float64,
+		Width:     int(v.width.Int64),
+		Height:    int(v.height.Int64),
+		Codec:     v.codec.String,
+		Bitrate:   v.bitrate.Int64,
+		Container: v.container.String,
+	}
+}
+
+// nullMusicTags scans the columns of a LEFT JOIN on music_tags.
+type nullMusicTags struct {
+	imageID                    sql.NullInt64
+	artist, title, album, year sql.NullString
+	bitrate                    sql.NullInt64
+	length, genre              sql.NullString
+}
+
+func (m nullMusicTags) get() *MusicTags {
+	if !m.imageID.Valid {
+		return nil
+	}
+	return &MusicTags{
+		Artist:  m.artist.String,
+		Title:   m.title.String,
+		Album:   m.album.String,
+		Year:    m.year.String,
+		Bitrate: int(m.bitrate.Int64),
+		Length:  m.length.String,
+		Genre:   m.genre.String,
+	}
+}
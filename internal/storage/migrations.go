@@ -0,0 +1,278 @@
+package storage
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+)
+
+// ErrSchemaTooNew is returned when opening a database migrated by a newer
+// version of the application.
+var ErrSchemaTooNew = errors.New("database schema is newer than this version supports")
+
+// migration upgrades the schema to version from the version before it.
+type migration struct {
+	version     int
+	description string
+	up          func(tx *sql.Tx) error
+}
+
+// migrations are applied in order to bring a database up to the latest
+// version. Released migrations must not be changed, new ones are appended.
+var migrations = []migration{
+	{1, "baseline schema", baselineSchema},
+	{2, "image hashes", func(tx *sql.Tx) error {
+		_, err := tx.Exec("ALTER TABLE images ADD COLUMN hash TEXT")
+		return err
+	}},
+	{3, "group archive", func(tx *sql.Tx) error {
+		_, err := tx.Exec("ALTER TABLE image_groups ADD COLUMN archived_at TIMESTAMP")
+		return err
+	}},
+	{4, "group listing indexes", func(tx *sql.Tx) error {
+		_, err := tx.Exec(`
+			CREATE INDEX idx_image_groups_kind_count ON image_groups(kind, image_count);
+			CREATE INDEX idx_image_groups_kind_updated ON image_groups(kind, updated_at);
+			CREATE INDEX idx_images_path ON images(path);
+		`)
+		return err
+	}},
+}
+
+// migrate applies the migrations a database is missing, each in its own
+// transaction. Databases holding data are copied next to dbPath first.
+func migrate(db *sql.DB, dbPath string) error {
+	_, err := db.Exec(`
+		CREATE TABLE IF NOT EXISTS schema_version (
+			version INTEGER PRIMARY KEY,
+			description TEXT NOT NULL,
+			applied_at TIMESTAMP NOT NULL
+		)`)
+	if err != nil {
+		return fmt.Errorf("failed to create schema_version table: %w", err)
+	}
+
+	var current int
+	if err := db.QueryRow("SELECT COALESCE(MAX(version), 0) FROM schema_version").Scan(&current); err != nil {
+		return fmt.Errorf("failed to read schema version: %w", err)
+	}
+
+	latest := migrations[len(migrations)-1].version
+	if current > latest {
+		return fmt.Errorf("%w: database is at version %d, latest known is %d", ErrSchemaTooNew, current, latest)
+	}
+	if current == latest {
+		return nil
+	}
+
+	if err := backupBeforeMigration(db, dbPath, current); err != nil {
+		return err
+	}
+
+	for _, m := range migrations {
+		if m.version <= current {
+			continue
+		}
+		if err := applyMigration(db, m); err != nil {
+			return err
+		}
+		log.Printf("Migrated database schema to version %d (%s)", m.version, m.description)
+	}
+	return nil
+}
+
+func applyMigration(db *sql.DB, m migration) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := m.up(tx); err != nil {
+		return fmt.Errorf("failed to migrate schema to version %d (%s): %w", m.version, m.description, err)
+	}
+
+	_, err = tx.Exec(
+		"INSERT INTO schema_version (version, description, applied_at) VALUES (?, ?, ?)",
+		m.version, m.description, time.Now().UTC(),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to record schema version %d: %w", m.version, err)
+	}
+	return tx.Commit()
+}
+
+// backupBeforeMigration copies the database at dbPath, at schema version
+// current, unless it has no tables yet.
+func backupBeforeMigration(db *sql.DB, dbPath string, current int) error {
+	var tables int
+	err := db.QueryRow(
+		"SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name NOT LIKE 'sqlite_%' AND name != 'schema_version'",
+	).Scan(&tables)
+	if err != nil {
+		return fmt.Errorf("failed to list tables: %w", err)
+	}
+	if tables == 0 {
+		return nil
+	}
+
+	backup := fmt.Sprintf("%s.v%d-%s.bak", dbPath, current, time.Now().Format("2006-01-02_15-04-05"))
+	if _, err := db.Exec("VACUUM INTO ?", backup); err != nil {
+		return fmt.Errorf("failed to back up database before migrating: %w", err)
+	}
+	log.Printf("Backed up database to %s before migrating", backup)
+	return nil
+}
+
+// baselineSchema creates the schema as it was before migrations were
+// versioned. Databases created back then may lack the columns added over
+// time, which are added if they are missing.
+func baselineSchema(tx *sql.Tx) error {
+	_, err := tx.Exec(`
+		CREATE TABLE IF NOT EXISTS image_groups (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			hash TEXT,
+			size INTEGER,
+			image_count INTEGER,
+			updated_at TIMESTAMP NULL
+		);
+		CREATE TABLE IF NOT EXISTS images (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			group_id INTEGER,
+			path TEXT,
+			image_size INTEGER,
+			width INTEGER,
+			height INTEGER,
+			similarity REAL,
+			action TEXT DEFAULT 'pending',
+			FOREIGN KEY(group_id) REFERENCES image_groups(id)
+		);
+		CREATE INDEX IF NOT EXISTS idx_image_group_action ON images(group_id, action);
+		CREATE TABLE IF NOT EXISTS video_metadata (
+			image_id INTEGER PRIMARY KEY,
+			duration REAL,
+			width INTEGER,
+			height INTEGER,
+			codec TEXT,
+			bitrate INTEGER,
+			container TEXT,
+			FOREIGN KEY(image_id) REFERENCES images(id)
+		);
+		CREATE TABLE IF NOT EXISTS music_tags (
+			image_id INTEGER PRIMARY KEY,
+			artist TEXT,
+			title TEXT,
+			album TEXT,
+			year TEXT,
+			bitrate INTEGER,
+			length TEXT,
+			genre TEXT,
+			FOREIGN KEY(image_id) REFERENCES images(id)
+		);
+		CREATE TABLE IF NOT EXISTS findings (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			kind TEXT NOT NULL,
+			path TEXT NOT NULL,
+			size INTEGER,
+			modified_date INTEGER,
+			extension TEXT,
+			error_type TEXT,
+			error_message TEXT,
+			action TEXT DEFAULT 'pending',
+			created_at TIMESTAMP NOT NULL
+		);
+		CREATE INDEX IF NOT EXISTS idx_findings_kind_action ON findings(kind, action);
+		CREATE TABLE IF NOT EXISTS schedules (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			name TEXT NOT NULL DEFAULT '',
+			kind TEXT NOT NULL,
+			directory TEXT NOT NULL,
+			options TEXT,
+			merge INTEGER NOT NULL DEFAULT 0,
+			cron TEXT NOT NULL,
+			enabled INTEGER NOT NULL DEFAULT 1,
+			next_run_at TIMESTAMP NULL,
+			last_run_at TIMESTAMP NULL,
+			created_at TIMESTAMP NOT NULL,
+			updated_at TIMESTAMP NOT NULL
+		);
+		CREATE TABLE IF NOT EXISTS schedule_runs (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			schedule_id INTEGER NOT NULL,
+			job_id INTEGER,
+			state TEXT NOT NULL,
+			message TEXT NOT NULL DEFAULT '',
+			created_at TIMESTAMP NOT NULL,
+			FOREIGN KEY(schedule_id) REFERENCES schedules(id),
+			FOREIGN KEY(job_id) REFERENCES scans(id)
+		);
+		CREATE INDEX IF NOT EXISTS idx_schedule_runs_schedule ON schedule_runs(schedule_id);
+		CREATE TABLE IF NOT EXISTS scans (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			directory TEXT NOT NULL,
+			state TEXT NOT NULL,
+			message TEXT NOT NULL DEFAULT '',
+			group_count INTEGER NOT NULL DEFAULT 0,
+			progress TEXT,
+			created_at TIMESTAMP NOT NULL,
+			started_at TIMESTAMP NULL,
+			finished_at TIMESTAMP NULL
+		);
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to create tables: %w", err)
+	}
+
+	for _, c := range []struct{ table, column, definition string }{
+		{"scans", "options", "TEXT"},
+		{"scans", "merge", "INTEGER NOT NULL DEFAULT 0"},
+		{"scans", "report", "TEXT"},
+		{"scans", "kind", "TEXT NOT NULL DEFAULT 'image'"},
+		{"image_groups", "kind", "TEXT NOT NULL DEFAULT 'image'"},
+		{"images", "modified_date", "INTEGER"},
+		{"images", "stale", "INTEGER NOT NULL DEFAULT 0"},
+		{"scans", "czkawka_version", "TEXT"},
+		{"scans", "exit_code", "INTEGER"},
+		{"scans", "stderr_tail", "TEXT"},
+		{"scans", "file_count", "INTEGER NOT NULL DEFAULT 0"},
+		{"scans", "artifact", "TEXT"},
+		{"findings", "target", "TEXT"},
+		{"findings", "proper_extension", "TEXT"},
+	} {
+		if err := addColumnIfMissing(tx, c.table, c.column, c.definition); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func addColumnIfMissing(db dbtx, table, column, definition string) error {
+	rows, err := db.Query(fmt.Sprintf("PRAGMA table_info(%s)", table))
+	if err != nil {
+		return fmt.Errorf("failed to read columns of %s: %w", table, err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var cid, notNull, pk int
+		var name, colType string
+		var dflt sql.NullString
+		if err := rows.Scan(&cid, &name, &colType, &notNull, &dflt, &pk); err != nil {
+			return err
+		}
+		if name == column {
+			return nil
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	_, err = db.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, definition))
+	if err != nil {
+		return fmt.Errorf("failed to add column %s.%s: %w", table, column, err)
+	}
+	return nil
+}
@@ -0,0 +1,127 @@
+package storage
+
+import (
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+// preMigrationSchema is the schema databases were created with before
+// migrations were versioned.
+const preMigrationSchema = `
+	CREATE TABLE image_groups (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		hash TEXT,
+		size INTEGER,
+		image_count INTEGER,
+		updated_at TIMESTAMP NULL
+	);
+	CREATE TABLE images (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		group_id INTEGER,
+		path TEXT,
+		image_size INTEGER,
+		width INTEGER,
+		height INTEGER,
+		similarity REAL,
+		action TEXT DEFAULT 'pending',
+		FOREIGN KEY(group_id) REFERENCES image_groups(id)
+	);
+	CREATE INDEX idx_image_group_action ON images(group_id, action);
+	INSERT INTO image_groups (hash, size, image_count) VALUES ('hash', 5, 2);
+	INSERT INTO images (group_id, path, image_size, action) VALUES (1, '/a.jpg', 5, 'keep'), (1, '/b.jpg', 5, 'trash');
+`
+
+func TestMigratePreMigrationDatabase(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "db")
+	db, err := sql.Open("sqlite", dbPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec(preMigrationSchema); err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+
+	s, err := New(dbPath)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+
+	for _, c := range []struct{ table, column string }{
+		{"image_groups", "kind"},
+		{"image_groups", "archived_at"},
+		{"images", "modified_date"},
+		{"images", "stale"},
+		{"images", "hash"},
+		{"scans", "artifact"},
+	} {
+		var n int
+		err := s.db.QueryRow("SELECT COUNT(*) FROM pragma_table_info(?) WHERE name = ?", c.table, c.column).Scan(&n)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n != 1 {
+			t.Errorf("column %s.%s is missing", c.table, c.column)
+		}
+	}
+
+	images, err := s.GetGroupImages(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(images) != 2 || images[0].Action != ActionKeep || images[1].Action != ActionTrash {
+		t.Errorf("images = %+v, want the decisions kept", images)
+	}
+	page, err := s.ListImageGroups(GroupFilter{Kind: KindImage})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if page.Total != 1 {
+		t.Errorf("image groups = %+v, want the stored group", page)
+	}
+
+	backups, err := filepath.Glob(dbPath + ".v0-*.bak")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(backups) != 1 {
+		t.Fatalf("backups = %v, want one", backups)
+	}
+	backup, err := sql.Open("sqlite", backups[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer backup.Close()
+	var count int
+	if err := backup.QueryRow("SELECT COUNT(*) FROM images").Scan(&count); err != nil {
+		t.Fatal(err)
+	}
+	if count != 2 {
+		t.Errorf("backup has %d images, want 2", count)
+	}
+
+	// opening a migrated database again changes nothing
+	s.Close()
+	if s, err = New(dbPath); err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	if backups, _ = filepath.Glob(dbPath + ".v*.bak"); len(backups) != 1 {
+		t.Errorf("backups = %v, want one", backups)
+	}
+
+	latest := migrations[len(migrations)-1].version
+	_, err = s.db.Exec(
+		"INSERT INTO schema_version (version, description, applied_at) VALUES (?, 'from the future', CURRENT_TIMESTAMP)",
+		latest+1,
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Close()
+
+	if _, err := New(dbPath); !errors.Is(err, ErrSchemaTooNew) {
+		t.Errorf("New = %v, want %v", err, ErrSchemaTooNew)
+	}
+}
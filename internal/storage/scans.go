@@ -0,0 +1,346 @@
+package storage
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+type ScanState string
+
+const (
+	ScanQueued    ScanState = "queued"
+	ScanRunning   ScanState = "running"
+	ScanParsing   ScanState = "parsing"
+	ScanLoading   ScanState = "loading"
+	ScanDone      ScanState = "done"
+	ScanFailed    ScanState = "failed"
+	ScanCancelled ScanState = "cancelled"
+)
+
+// Finished reports whether the scan has reached a terminal state.
+func (s ScanState) Finished() bool {
+	return s == ScanDone || s == ScanFailed || s == ScanCancelled
+}
+
+// ScanProgress is a single progress line reported by czkawka while scanning.
+type ScanProgress struct {
+	Line       string `json:"line"`
+	Stage      int    `json:"stage,omitempty"`
+	StageCount int    `json:"stageCount,omitempty"`
+	Current    int64  `json:"current,omitempty"`
+	Total      int64  `json:"total,omitempty"`
+}
+
+type ScanJob struct {
+	ID             int             `json:"id"`
+	Kind           Kind            `json:"kind"`
+	Directory      string          `json:"directory"`
+	Options        json.RawMessage `json:"options,omitempty"`
+	Merge          bool            `json:"merge"`
+	State          ScanState       `json:"state"`
+	Message        string          `json:"message"`
+	GroupCount     int             `json:"groupCount"`
+	FileCount      int             `json:"fileCount"`
+	Report         *LoadReport     `json:"report,omitempty"`
+	Progress       []ScanProgress  `json:"progress"`
+	CreatedAt      time.Time       `json:"createdAt"`
+	StartedAt      *time.Time      `json:"startedAt"`
+	FinishedAt     *time.Time      `json:"finishedAt"`
+	ElapsedSeconds float64         `json:"elapsedSeconds"`
+	// CzkawkaVersion, ExitCode and StderrTail describe the czkawka run and
+	// are empty for imports.
+	CzkawkaVersion string `json:"czkawkaVersion,omitempty"`
+	ExitCode       *int   `json:"exitCode"`
+	StderrTail     string `json:"stderrTail,omitempty"`
+	// Artifact is the czkawka output the results were loaded from, until it
+	// is pruned.
+	Artifact string `json:"artifact,omitempty"`
+}
+
+const scanJobColumns = `
+	id, kind, directory, options, merge, state, message, group_count, file_count, report, progress,
+	created_at, started_at, finished_at, czkawka_version, exit_code, stderr_tail, artifact`
+
+// CreateScanJob records a queued scan of directory. options holds the
+// JSON-encoded scan options used for it, merge whether its results are
+// merged into the stored groups instead of replacing them.
+func (s *Storage) CreateScanJob(kind Kind, directory string, options json.RawMessage, merge bool) (int, error) {
+	result, err := s.db.Exec(
+		"INSERT INTO scans (kind, directory, options, merge, state, created_at) VALUES (?, ?, ?, ?, ?, ?)",
+		kind, directory, nullableJSON(options), merge, ScanQueued, time.Now().UTC(),
+	)
+	if err != nil {
+		return 0, fmt.Errorf("failed to insert scan job: %w", err)
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get last insertId for scan job: %w", err)
+	}
+	return int(id), nil
+}
+
+func (s *Storage) GetScanJob(id int) (ScanJob, error) {
+	row := s.db.QueryRow("SELECT "+scanJobColumns+" FROM scans WHERE id = ?", id)
+
+	job, err := scanScanJob(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ScanJob{}, ErrNotFound
+	}
+	return job, err
+}
+
+// StartScanJob moves a queued job to running and records its start time.
+func (s *Storage) StartScanJob(id int) error {
+	_, err := s.db.Exec(
+		"UPDATE scans SET state = ?, started_at = ? WHERE id = ?",
+		ScanRunning, time.Now().UTC(), id,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to start scan job %d: %w", id, err)
+	}
+	return nil
+}
+
+// UpdateScanJobState records a state transition together with the latest
+// progress lines. Terminal states also set the finish time.
+func (s *Storage) UpdateScanJobState(id int, state ScanState, message string, progress []ScanProgress) error {
+	progressJSON, err := json.Marshal(progress)
+	if err != nil {
+		return err
+	}
+
+	var finishedAt *time.Time
+	if state.Finished() {
+		now := time.Now().UTC()
+		finishedAt = &now
+	}
+
+	_, err = s.db.Exec(`
+		UPDATE scans
+		SET state = ?,
+			message = ?,
+			progress = ?,
+			finished_at = COALESCE(?, finished_at)
+		WHERE id = ?`,
+		state, message, string(progressJSON), finishedAt, id,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update scan job %d: %w", id, err)
+	}
+	return nil
+}
+
+// SetScanJobResult records the number of groups or findings a job loaded
+// and how they were reconciled. The file count is taken from report.
+func (s *Storage) SetScanJobResult(id int, groupCount int, report LoadReport) error {
+	reportJSON, err := json.Marshal(report)
+	if err != nil {
+		return err
+	}
+
+	fileCount := report.FilesAdded + report.FilesCarried + report.FilesChanged
+	_, err = s.db.Exec(
+		"UPDATE scans SET group_count = ?, file_count = ?, report = ? WHERE id = ?",
+		groupCount, fileCount, string(reportJSON), id,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update result of scan job %d: %w", id, err)
+	}
+	return nil
+}
+
+// SetScanJobArtifact records the file holding the czkawka output of a job.
+func (s *Storage) SetScanJobArtifact(id int, path string) error {
+	_, err := s.db.Exec("UPDATE scans SET artifact = ? WHERE id = ?", path, id)
+	if err != nil {
+		return fmt.Errorf("failed to update artifact of scan job %d: %w", id, err)
+	}
+	return nil
+}
+
+// SetScanJobExit records the czkawka version that ran a job, its exit code
+// and the last lines it wrote to stderr.
+func (s *Storage) SetScanJobExit(id int, czkawkaVersion string, exitCode int, stderrTail string) error {
+	_, err := s.db.Exec(
+		"UPDATE scans SET czkawka_version = ?, exit_code = ?, stderr_tail = ? WHERE id = ?",
+		czkawkaVersion, exitCode, stderrTail, id,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update exit status of scan job %d: %w", id, err)
+	}
+	return nil
+}
+
+// ListScanJobs returns the most recent jobs first, at most limit of them
+// if limit is positive.
+func (s *Storage) ListScanJobs(limit int) ([]ScanJob, error) {
+	if limit <= 0 {
+		limit = -1
+	}
+
+	rows, err := s.db.Query("SELECT "+scanJobColumns+" FROM scans ORDER BY id DESC LIMIT ?", limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	jobs := []ScanJob{}
+	for rows.Next() {
+		job, err := scanScanJob(rows)
+		if err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, job)
+	}
+	return jobs, rows.Err()
+}
+
+// ScanArtifactsToPrune returns the finished jobs whose artifact is beyond
+// the keep most recent ones or, if before is set, finished before it. A keep
+// of zero or less keeps any number of artifacts.
+func (s *Storage) ScanArtifactsToPrune(keep int, before time.Time) ([]ScanJob, error) {
+	if keep <= 0 {
+		keep = -1
+	}
+
+	query := `
+		SELECT ` + scanJobColumns + ` FROM scans
+		WHERE artifact IS NOT NULL
+		AND state IN (?, ?, ?)
+		AND (id NOT IN (
+				SELECT id FROM scans WHERE artifact IS NOT NULL ORDER BY id DESC LIMIT ?
+			)`
+	args := []any{ScanDone, ScanFailed, ScanCancelled, keep}
+	if !before.IsZero() {
+		query += " OR finished_at < ?"
+		args = append(args, before.UTC())
+	}
+	query += ")"
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query scan artifacts: %w", err)
+	}
+	defer rows.Close()
+
+	var jobs []ScanJob
+	for rows.Next() {
+		job, err := scanScanJob(rows)
+		if err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, job)
+	}
+	return jobs, rows.Err()
+}
+
+// ClearScanJobArtifact forgets the artifact of a job once it was pruned.
+func (s *Storage) ClearScanJobArtifact(id int) error {
+	_, err := s.db.Exec("UPDATE scans SET artifact = NULL WHERE id = ?", id)
+	if err != nil {
+		return fmt.Errorf("failed to clear artifact of scan job %d: %w", id, err)
+	}
+	return nil
+}
+
+// FailInterruptedScanJobs marks every job that was still in flight as failed.
+// It is meant to be called on startup, before any new job is accepted.
+func (s *Storage) FailInterruptedScanJobs() (int, error) {
+	result, err := s.db.Exec(`
+		UPDATE scans
+		SET state = ?,
+			message = 'interrupted by server restart',
+			finished_at = ?
+		WHERE state IN (?, ?, ?, ?)`,
+		ScanFailed, time.Now().UTC(),
+		ScanQueued, ScanRunning, ScanParsing, ScanLoading,
+	)
+	if err != nil {
+		return 0, fmt.Errorf("failed to mark interrupted scan jobs: %w", err)
+	}
+	n, err := result.RowsAffected()
+	return int(n), err
+}
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanScanJob(row rowScanner) (ScanJob, error) {
+	var job ScanJob
+	var optionsJSON, reportJSON, progressJSON sql.NullString
+	var czkawkaVersion, stderrTail, artifact sql.NullString
+	var exitCode sql.NullInt64
+
+	if err := row.Scan(
+		&job.ID,
+		&job.Kind,
+		&job.Directory,
+		&optionsJSON,
+		&job.Merge,
+		&job.State,
+		&job.Message,
+		&job.GroupCount,
+		&job.FileCount,
+		&reportJSON,
+		&progressJSON,
+		&job.CreatedAt,
+		&job.StartedAt,
+		&job.FinishedAt,
+		&czkawkaVersion,
+		&exitCode,
+		&stderrTail,
+		&artifact,
+	); err != nil {
+		return ScanJob{}, err
+	}
+
+	if optionsJSON.Valid && optionsJSON.String != "" {
+		job.Options = json.RawMessage(optionsJSON.String)
+	}
+
+	if reportJSON.Valid && reportJSON.String != "" {
+		job.Report = &LoadReport{}
+		if err := json.Unmarshal([]byte(reportJSON.String), job.Report); err != nil {
+			return ScanJob{}, fmt.Errorf("failed to decode report of scan job %d: %w", job.ID, err)
+		}
+	}
+
+	if progressJSON.Valid && progressJSON.String != "" {
+		if err := json.Unmarshal([]byte(progressJSON.String), &job.Progress); err != nil {
+			return ScanJob{}, fmt.Errorf("failed to decode progress of scan job %d: %w", job.ID, err)
+		}
+	}
+
+	job.CzkawkaVersion = czkawkaVersion.String
+	job.StderrTail = stderrTail.String
+	job.Artifact = artifact.String
+	if exitCode.Valid {
+		code := int(exitCode.Int64)
+		job.ExitCode = &code
+	}
+
+	job.ElapsedSeconds = elapsed(job.StartedAt, job.FinishedAt)
+
+	return job, nil
+}
+
+func nullableJSON(data json.RawMessage) any {
+	if len(data) == 0 {
+		return nil
+	}
+	return string(data)
+}
+
+func elapsed(start, end *time.Time) float64 {
+	if start == nil {
+		return 0
+	}
+	if end == nil {
+		return time.Since(*start).Seconds()
+	}
+	return end.Sub(*start).Seconds()
+}
@@ -0,0 +1,56 @@
+package storage_test
+
+import (
+	"testing"
+
+	"github.com/fadykuzman/schluckauf/internal/storage"
+)
+
+func TestFailInterruptedScanJobs(t *testing.T) {
+	s := open(t)
+
+	states := []storage.ScanState{
+		storage.ScanQueued,
+		storage.ScanRunning,
+		storage.ScanParsing,
+		storage.ScanLoading,
+		storage.ScanDone,
+		storage.ScanFailed,
+		storage.ScanCancelled,
+	}
+	ids := make([]int, len(states))
+	for i, state := range states {
+		id, err := s.CreateScanJob(storage.KindImage, "/photos", nil, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if state != storage.ScanQueued {
+			if err := s.UpdateScanJobState(id, state, string(state), nil); err != nil {
+				t.Fatal(err)
+			}
+		}
+		ids[i] = id
+	}
+
+	n, err := s.FailInterruptedScanJobs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 4 {
+		t.Errorf("failed %d jobs, want 4", n)
+	}
+
+	for i, id := range ids {
+		job, err := s.GetScanJob(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		interrupted := !states[i].Finished()
+		switch {
+		case interrupted && (job.State != storage.ScanFailed || job.Message != "interrupted by server restart" || job.FinishedAt == nil):
+			t.Errorf("%s job = %s %q, want failed as interrupted", states[i], job.State, job.Message)
+		case !interrupted && (job.State != states[i] || job.Message != string(states[i])):
+			t.Errorf("%s job = %s %q, want it unchanged", states[i], job.State, job.Message)
+		}
+	}
+}
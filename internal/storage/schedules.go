@@ -0,0 +1,275 @@
+package storage
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Schedule is a scan that is run periodically, whenever Cron matches.
+type Schedule struct {
+	ID        int             `json:"id"`
+	Name      string          `json:"name"`
+	Kind      Kind            `json:"kind"`
+	Directory string          `json:"directory"`
+	Options   json.RawMessage `json:"options,omitempty"`
+	Merge     bool            `json:"merge"`
+	Cron      string          `json:"cron"`
+	Enabled   bool            `json:"enabled"`
+	NextRunAt *time.Time      `json:"nextRunAt"`
+	LastRunAt *time.Time      `json:"lastRunAt"`
+	CreatedAt time.Time       `json:"createdAt"`
+	UpdatedAt time.Time       `json:"updatedAt"`
+}
+
+type ScheduleRunState string
+
+const (
+	RunSubmitted ScheduleRunState = "submitted"
+	RunSkipped   ScheduleRunState = "skipped"
+	RunFailed    ScheduleRunState = "failed"
+)
+
+// ScheduleRun is a single time a schedule was due, with the scan job it
+// submitted, if any. JobState is the current state of that job.
+type ScheduleRun struct {
+	ID         int              `json:"id"`
+	ScheduleID int              `json:"scheduleId"`
+	JobID      *int             `json:"jobId"`
+	JobState   ScanState        `json:"jobState,omitempty"`
+	State      ScheduleRunState `json:"state"`
+	Message    string           `json:"message"`
+	CreatedAt  time.Time        `json:"createdAt"`
+}
+
+const scheduleColumns = `
+	id, name, kind, directory, options, merge, cron, enabled, next_run_at, last_run_at,
+	created_at, updated_at`
+
+func (s *Storage) CreateSchedule(schedule Schedule) (int, error) {
+	now := time.Now().UTC()
+	result, err := s.db.Exec(`
+		INSERT INTO schedules
+			(name, kind, directory, options, merge, cron, enabled, next_run_at, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		schedule.Name, schedule.Kind, schedule.Directory, nullableJSON(schedule.Options),
+		schedule.Merge, schedule.Cron, schedule.Enabled, utcTime(schedule.NextRunAt), now, now,
+	)
+	if err != nil {
+		return 0, fmt.Errorf("failed to insert schedule: %w", err)
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get last insertId for schedule: %w", err)
+	}
+	return int(id), nil
+}
+
+func (s *Storage) GetSchedule(id int) (Schedule, error) {
+	row := s.db.QueryRow("SELECT "+scheduleColumns+" FROM schedules WHERE id = ?", id)
+
+	schedule, err := scanSchedule(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Schedule{}, ErrNotFound
+	}
+	return schedule, err
+}
+
+func (s *Storage) ListSchedules() ([]Schedule, error) {
+	return s.querySchedules("SELECT " + scheduleColumns + " FROM schedules ORDER BY id")
+}
+
+// DueSchedules returns the enabled schedules whose next run is at or
+// before now.
+func (s *Storage) DueSchedules(now time.Time) ([]Schedule, error) {
+	return s.querySchedules(
+		"SELECT "+scheduleColumns+" FROM schedules WHERE enabled = 1 AND next_run_at <= ? ORDER BY next_run_at",
+		now.UTC(),
+	)
+}
+
+// UpdateSchedule replaces the definition of a schedule, keeping its run
+// history.
+func (s *Storage) UpdateSchedule(schedule Schedule) error {
+	result, err := s.db.Exec(`
+		UPDATE schedules
+		SET name = ?, kind = ?, directory = ?, options = ?, merge = ?, cron = ?, enabled = ?,
+			next_run_at = ?, updated_at = ?
+		WHERE id = ?`,
+		schedule.Name, schedule.Kind, schedule.Directory, nullableJSON(schedule.Options),
+		schedule.Merge, schedule.Cron, schedule.Enabled, utcTime(schedule.NextRunAt),
+		time.Now().UTC(), schedule.ID,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update schedule %d: %w", schedule.ID, err)
+	}
+	return expectOneRow(result, ErrNotFound)
+}
+
+// DeleteSchedule deletes a schedule with its run history. The scan jobs it
+// submitted are kept.
+func (s *Storage) DeleteSchedule(id int) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("DELETE FROM schedule_runs WHERE schedule_id = ?", id); err != nil {
+		return fmt.Errorf("failed to delete runs of schedule %d: %w", id, err)
+	}
+	result, err := tx.Exec("DELETE FROM schedules WHERE id = ?", id)
+	if err != nil {
+		return fmt.Errorf("failed to delete schedule %d: %w", id, err)
+	}
+	if err := expectOneRow(result, ErrNotFound); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// RecordScheduleRun stores a run of a schedule and moves the schedule on to
+// its next run.
+func (s *Storage) RecordScheduleRun(run ScheduleRun, nextRunAt *time.Time) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	now := time.Now().UTC()
+	_, err = tx.Exec(
+		"INSERT INTO schedule_runs (schedule_id, job_id, state, message, created_at) VALUES (?, ?, ?, ?, ?)",
+		run.ScheduleID, run.JobID, run.State, run.Message, now,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to insert run of schedule %d: %w", run.ScheduleID, err)
+	}
+
+	_, err = tx.Exec(
+		"UPDATE schedules SET last_run_at = ?, next_run_at = ? WHERE id = ?",
+		now, utcTime(nextRunAt), run.ScheduleID,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update schedule %d: %w", run.ScheduleID, err)
+	}
+
+	return tx.Commit()
+}
+
+// ListScheduleRuns returns the most recent runs of a schedule first, at
+// most limit of them.
+func (s *Storage) ListScheduleRuns(scheduleID int, limit int) ([]ScheduleRun, error) {
+	rows, err := s.db.Query(`
+		SELECT r.id, r.schedule_id, r.job_id, sc.state, r.state, r.message, r.created_at
+		FROM schedule_runs r
+		LEFT JOIN scans sc ON sc.id = r.job_id
+		WHERE r.schedule_id = ?
+		ORDER BY r.id DESC
+		LIMIT ?`,
+		scheduleID, limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	runs := []ScheduleRun{}
+	for rows.Next() {
+		var run ScheduleRun
+		var jobID sql.NullInt64
+		var jobState sql.NullString
+		if err := rows.Scan(&run.ID, &run.ScheduleID, &jobID, &jobState, &run.State, &run.Message, &run.CreatedAt); err != nil {
+			return nil, err
+		}
+		if jobID.Valid {
+			id := int(jobID.Int64)
+			run.JobID = &id
+		}
+		run.JobState = ScanState(jobState.String)
+		runs = append(runs, run)
+	}
+	return runs, rows.Err()
+}
+
+// LastScheduledJob returns the scan job most recently submitted by a
+// schedule, or ErrNotFound if it never submitted one.
+func (s *Storage) LastScheduledJob(scheduleID int) (ScanJob, error) {
+	var jobID int
+	err := s.db.QueryRow(
+		"SELECT job_id FROM schedule_runs WHERE schedule_id = ? AND job_id IS NOT NULL ORDER BY id DESC LIMIT 1",
+		scheduleID,
+	).Scan(&jobID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ScanJob{}, ErrNotFound
+	}
+	if err != nil {
+		return ScanJob{}, err
+	}
+	return s.GetScanJob(jobID)
+}
+
+func (s *Storage) querySchedules(query string, args ...any) ([]Schedule, error) {
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	schedules := []Schedule{}
+	for rows.Next() {
+		schedule, err := scanSchedule(rows)
+		if err != nil {
+			return nil, err
+		}
+		schedules = append(schedules, schedule)
+	}
+	return schedules, rows.Err()
+}
+
+func scanSchedule(row rowScanner) (Schedule, error) {
+	var schedule Schedule
+	var optionsJSON sql.NullString
+
+	if err := row.Scan(
+		&schedule.ID,
+		&schedule.Name,
+		&schedule.Kind,
+		&schedule.Directory,
+		&optionsJSON,
+		&schedule.Merge,
+		&schedule.Cron,
+		&schedule.Enabled,
+		&schedule.NextRunAt,
+		&schedule.LastRunAt,
+		&schedule.CreatedAt,
+		&schedule.UpdatedAt,
+	); err != nil {
+		return Schedule{}, err
+	}
+
+	if optionsJSON.Valid && optionsJSON.String != "" {
+		schedule.Options = json.RawMessage(optionsJSON.String)
+	}
+	return schedule, nil
+}
+
+func utcTime(t *time.Time) any {
+	if t == nil {
+		return nil
+	}
+	return t.UTC()
+}
+
+func expectOneRow(result sql.Result, notFound error) error {
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return notFound
+	}
+	return nil
+}
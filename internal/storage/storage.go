@@ -3,17 +3,26 @@ package storage
 
 import (
 	"database/sql"
+	"errors"
 	"fmt"
 
 	_ "modernc.org/sqlite"
+
+	"github.com/fadykuzman/schluckauf/internal/library"
 )
 
+// ErrNotFound is returned when a requested record does not exist.
+var ErrNotFound = errors.New("not found")
+
 type Storage struct {
-	db *sql.DB
+	db      *sql.DB
+	library *library.Library
 }
 
 func New(dbPath string) (*Storage, error) {
-	db, err := sql.Open("sqlite", dbPath)
+	// busy_timeout is set for every connection of the pool, otherwise
+	// concurrent writers fail right away with SQLITE_BUSY
+	db, err := sql.Open("sqlite", dbPath+"?_pragma=busy_timeout(5000)")
 	if err != nil {
 		return nil, fmt.Errorf("failed to open Database: %w", err)
 	}
@@ -23,39 +32,32 @@ func New(dbPath string) (*Storage, error) {
 		return nil, fmt.Errorf("failed to set journal mode: %w", err)
 	}
 
-	_, err = db.Exec("PRAGMA busy_timeout=5000")
-	if err != nil {
-		return nil, fmt.Errorf("failed to set busy_timeout: %w", err)
-	}
-	_, err = db.Exec(`
-		  
-		  CREATE TABLE IF NOT EXISTS image_groups (
-				id INTEGER PRIMARY KEY AUTOINCREMENT,
-				hash TEXT,
-				size INTEGER,
-				image_count INTEGER,
-				updated_at TIMESTAMP NULL
-			);
-		  CREATE TABLE IF NOT EXISTS images (
-				id INTEGER PRIMARY KEY AUTOINCREMENT,
-				group_id INTEGER,
-				path TEXT,
-				image_size INTEGER,
-				width INTEGER,
-				height INTEGER,
-				similarity REAL,
-				action TEXT DEFAULT 'pending',
-				FOREIGN KEY(group_id) REFERENCES image_groups(id)
-		  );
-	    CREATE INDEX IF NOT EXISTS idx_image_group_action ON images(group_id, action);
-		`)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create tables: %w", err)
+	if err := migrate(db, dbPath); err != nil {
+		return nil, err
 	}
 
 	return &Storage{db: db}, nil
 }
 
+// SetLibrary restricts the files moved, removed or renamed by trash runs to
+// the roots of lib. Without a library any file is dealt with.
+func (s *Storage) SetLibrary(lib *library.Library) {
+	s.library = lib
+}
+
+func (s *Storage) checkEntry(path string) error {
+	return checkEntry(s.library, path)
+}
+
+// checkEntry fails if path is not within the roots of lib, if there is one.
+func checkEntry(lib *library.Library, path string) error {
+	if lib == nil {
+		return nil
+	}
+	_, err := lib.ResolveEntry(path)
+	return err
+}
+
 func (s *Storage) Close() error {
 	return s.db.Close()
 }
@@ -0,0 +1,27 @@
+package storage_test
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/fadykuzman/schluckauf/internal/storage"
+	"github.com/fadykuzman/schluckauf/internal/storage/storagetest"
+)
+
+func TestStorage(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) storage.GroupStore {
+		return open(t)
+	})
+}
+
+// open creates a database in a temporary directory.
+func open(t *testing.T) *storage.Storage {
+	t.Helper()
+
+	store, err := storage.New(filepath.Join(t.TempDir(), "db"))
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	t.Cleanup(func() { store.Close() })
+	return store
+}
@@ -0,0 +1,647 @@
+// Package storagetest checks that implementations of storage.GroupStore
+// behave the same.
+package storagetest
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/fadykuzman/schluckauf/internal/storage"
+)
+
+// Run runs the conformance tests against stores returned by open, which
+// has to return a new, empty store on every call:
+//
+//	func TestMemory(t *testing.T) {
+//		storagetest.Run(t, func(t *testing.T) storage.GroupStore {
+//			return storage.NewMemory()
+//		})
+//	}
+//
+// Trash runs move files to a temporary TRASH_DIR.
+func Run(t *testing.T, open func(t *testing.T) storage.GroupStore) {
+	tests := []struct {
+		name string
+		test func(t *testing.T, store storage.GroupStore)
+	}{
+		{"ListByKind", testListByKind},
+		{"GroupImages", testGroupImages},
+		{"StatusDerivation", testStatusDerivation},
+		{"Ordering", testOrdering},
+		{"Stats", testStats},
+		{"UpdateUnknownFile", testUpdateUnknownFile},
+		{"ImagePath", testImagePath},
+		{"TrashImages", testTrashImages},
+		{"Archive", testArchive},
+		{"ArchiveAfterTrash", testArchiveAfterTrash},
+		{"DeleteGroups", testDeleteGroups},
+		{"Filters", testFilters},
+		{"Sorts", testSorts},
+		{"Pagination", testPagination},
+		{"PaginationTies", testPaginationTies},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.test(t, open(t))
+		})
+	}
+}
+
+// group creates a group of kind with a file of 100 bytes for each path.
+func group(t *testing.T, store storage.GroupStore, kind storage.Kind, paths ...string) (int, []int) {
+	t.Helper()
+
+	var files []storage.ScanFile
+	for _, path := range paths {
+		files = append(files, storage.ScanFile{Path: path, Size: 100, ModifiedDate: 1})
+	}
+	return groupFiles(t, store, kind, files...)
+}
+
+func groupFiles(t *testing.T, store storage.GroupStore, kind storage.Kind, files ...storage.ScanFile) (int, []int) {
+	t.Helper()
+
+	gid, err := store.CreateImageGroup(kind, "hash", 100, len(files))
+	if err != nil {
+		t.Fatalf("CreateImageGroup: %v", err)
+	}
+
+	var ids []int
+	for _, file := range files {
+		id, err := store.CreateImage(gid, file)
+		if err != nil {
+			t.Fatalf("CreateImage: %v", err)
+		}
+		ids = append(ids, id)
+	}
+	return gid, ids
+}
+
+func decide(t *testing.T, store storage.GroupStore, gid, id int, action storage.ImageAction) {
+	t.Helper()
+
+	if err := store.UpdateImageAction(gid, id, action); err != nil {
+		t.Fatalf("UpdateImageAction(%d, %d, %s): %v", gid, id, action, err)
+	}
+}
+
+func list(t *testing.T, store storage.GroupStore, kind storage.Kind) []storage.ImageGroup {
+	t.Helper()
+
+	return listPage(t, store, storage.GroupFilter{Kind: kind}).Groups
+}
+
+func listPage(t *testing.T, store storage.GroupStore, filter storage.GroupFilter) storage.GroupPage {
+	t.Helper()
+
+	page, err := store.ListImageGroups(filter)
+	if err != nil {
+		t.Fatalf("ListImageGroups(%+v): %v", filter, err)
+	}
+	return page
+}
+
+func groupIDs(groups []storage.ImageGroup) []int {
+	var ids []int
+	for _, g := range groups {
+		ids = append(ids, g.ID)
+	}
+	return ids
+}
+
+func testListByKind(t *testing.T, store storage.GroupStore) {
+	images, _ := group(t, store, storage.KindImage, "/a.jpg", "/b.jpg")
+	group(t, store, storage.KindFile, "/a.txt", "/b.txt")
+	music, _ := group(t, store, storage.KindImage, "/c.jpg", "/d.jpg", "/e.jpg")
+
+	groups := list(t, store, storage.KindImage)
+	if got, want := groupIDs(groups), []int{images, music}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("image groups = %v, want %v", got, want)
+	}
+	for _, g := range groups {
+		if g.Kind != storage.KindImage || g.Status != storage.StatusPending || g.UpdatedAt != nil {
+			t.Errorf("group %d = %+v, want an undecided image group", g.ID, g)
+		}
+	}
+	if groups[1].ImageCount != 3 {
+		t.Errorf("image count = %d, want 3", groups[1].ImageCount)
+	}
+
+	if groups := list(t, store, storage.KindVideo); len(groups) != 0 {
+		t.Errorf("video groups = %v, want none", groupIDs(groups))
+	}
+}
+
+func testGroupImages(t *testing.T, store storage.GroupStore) {
+	gid, err := store.CreateImageGroup(storage.KindMusic, "hash", 100, 2)
+	if err != nil {
+		t.Fatalf("CreateImageGroup: %v", err)
+	}
+
+	files := []storage.ScanFile{
+		{
+			Path: "/music/a.mp3", Size: 100, ModifiedDate: 10,
+			Music: &storage.MusicTags{Artist: "Artist", Title: "Title", Bitrate: 320},
+		},
+		{
+			Path: "/music/b.jpg", Size: 200, ModifiedDate: 20,
+			Image: &storage.ImageMetadata{Width: 800, Height: 600, Similarity: 2, Hash: "0102"},
+			Video: &storage.VideoMetadata{Duration: 1.5, Width: 800, Height: 600, Codec: "h264"},
+		},
+	}
+	var ids []int
+	for _, file := range files {
+		id, err := store.CreateImage(gid, file)
+		if err != nil {
+			t.Fatalf("CreateImage: %v", err)
+		}
+		ids = append(ids, id)
+	}
+
+	images, err := store.GetGroupImages(gid)
+	if err != nil {
+		t.Fatalf("GetGroupImages: %v", err)
+	}
+	if len(images) != len(files) {
+		t.Fatalf("got %d images, want %d", len(images), len(files))
+	}
+	for i, img := range images {
+		want := storage.Image{
+			ID:           ids[i],
+			GroupID:      gid,
+			Path:         files[i].Path,
+			Imagesize:    files[i].Size,
+			ModifiedDate: files[i].ModifiedDate,
+			Action:       storage.ActionPending,
+			Image:        files[i].Image,
+			Video:        files[i].Video,
+			Music:        files[i].Music,
+		}
+		if !reflect.DeepEqual(img, want) {
+			t.Errorf("image %d = %+v, want %+v", i, img, want)
+		}
+	}
+
+	// the tags of the first file describe the group
+	groups := list(t, store, storage.KindMusic)
+	if len(groups) != 1 || !reflect.DeepEqual(groups[0].Music, files[0].Music) {
+		t.Errorf("group music = %+v, want %+v", groups[0].Music, files[0].Music)
+	}
+
+	images, err = store.GetGroupImages(gid + 100)
+	if err != nil || len(images) != 0 {
+		t.Errorf("GetGroupImages of unknown group = %v, %v, want no images", images, err)
+	}
+}
+
+func testStatusDerivation(t *testing.T, store storage.GroupStore) {
+	gid, ids := group(t, store, storage.KindImage, "/a.jpg", "/b.jpg")
+
+	decide(t, store, gid, ids[0], storage.ActionKeep)
+	if g := list(t, store, storage.KindImage)[0]; g.Status != storage.StatusPending {
+		t.Errorf("status with a pending file = %s, want pending", g.Status)
+	}
+	if g := list(t, store, storage.KindImage)[0]; g.UpdatedAt == nil {
+		t.Errorf("updatedAt of a group with a decision is not set")
+	}
+
+	decide(t, store, gid, ids[1], storage.ActionTrash)
+	if g := list(t, store, storage.KindImage)[0]; g.Status != storage.StatusDecided {
+		t.Errorf("status with all files decided = %s, want decided", g.Status)
+	}
+
+	decide(t, store, gid, ids[1], storage.ActionPending)
+	if g := list(t, store, storage.KindImage)[0]; g.Status != storage.StatusPending {
+		t.Errorf("status after undoing a decision = %s, want pending", g.Status)
+	}
+}
+
+func testOrdering(t *testing.T, store storage.GroupStore) {
+	first, firstIDs := group(t, store, storage.KindImage, "/a.jpg", "/b.jpg")
+	second, _ := group(t, store, storage.KindImage, "/c.jpg", "/d.jpg")
+	third, thirdIDs := group(t, store, storage.KindImage, "/e.jpg", "/f.jpg")
+	fourth, _ := group(t, store, storage.KindImage, "/g.jpg", "/h.jpg")
+
+	for _, id := range firstIDs {
+		decide(t, store, first, id, storage.ActionKeep)
+	}
+	for _, id := range thirdIDs {
+		decide(t, store, third, id, storage.ActionKeep)
+	}
+
+	// pending groups come first; groups decided within the same second are
+	// ordered by id
+	got := groupIDs(list(t, store, storage.KindImage))
+	if want := []int{second, fourth, first, third}; !reflect.DeepEqual(got, want) {
+		t.Errorf("groups = %v, want %v", got, want)
+	}
+}
+
+func testStats(t *testing.T, store storage.GroupStore) {
+	decided, decidedIDs := group(t, store, storage.KindImage, "/a.jpg", "/b.jpg")
+	group(t, store, storage.KindImage, "/c.jpg", "/d.jpg")
+	files, fileIDs := group(t, store, storage.KindFile, "/a.txt", "/b.txt")
+
+	decide(t, store, decided, decidedIDs[0], storage.ActionKeep)
+	decide(t, store, decided, decidedIDs[1], storage.ActionTrash)
+	decide(t, store, files, fileIDs[0], storage.ActionTrash)
+
+	stats, err := store.GetImageGroupStats(storage.KindImage)
+	if err != nil {
+		t.Fatalf("GetImageGroupStats: %v", err)
+	}
+	// the trash count covers all kinds
+	if want := (storage.ImageGroupStats{Pending: 1, Decided: 1, ImagesToTrashCount: 2}); stats != want {
+		t.Errorf("stats = %+v, want %+v", stats, want)
+	}
+
+	stats, err = store.GetImageGroupStats(storage.KindVideo)
+	if err != nil {
+		t.Fatalf("GetImageGroupStats: %v", err)
+	}
+	if want := (storage.ImageGroupStats{ImagesToTrashCount: 2}); stats != want {
+		t.Errorf("video stats = %+v, want %+v", stats, want)
+	}
+}
+
+func testUpdateUnknownFile(t *testing.T, store storage.GroupStore) {
+	gid, ids := group(t, store, storage.KindImage, "/a.jpg", "/b.jpg")
+	other, _ := group(t, store, storage.KindImage, "/c.jpg", "/d.jpg")
+
+	if err := store.UpdateImageAction(other, ids[0], storage.ActionKeep); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("UpdateImageAction of another group's file = %v, want ErrNotFound", err)
+	}
+	if err := store.UpdateImageAction(gid, ids[1]+100, storage.ActionKeep); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("UpdateImageAction of unknown file = %v, want ErrNotFound", err)
+	}
+	if g := list(t, store, storage.KindImage)[0]; g.UpdatedAt != nil {
+		t.Errorf("refused update set updatedAt of group %d", g.ID)
+	}
+}
+
+func testImagePath(t *testing.T, store storage.GroupStore) {
+	_, ids := group(t, store, storage.KindImage, "/a.jpg", "/b.jpg")
+
+	path, err := store.GetImagePath(ids[1])
+	if err != nil || path != "/b.jpg" {
+		t.Errorf("GetImagePath = %q, %v, want /b.jpg", path, err)
+	}
+	if _, err := store.GetImagePath(ids[1] + 100); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("GetImagePath of unknown file = %v, want ErrNotFound", err)
+	}
+}
+
+func testTrashImages(t *testing.T, store storage.GroupStore) {
+	trashDir := t.TempDir()
+	t.Setenv("TRASH_DIR", trashDir)
+
+	dir := t.TempDir()
+	paths := []string{filepath.Join(dir, "a.jpg"), filepath.Join(dir, "b.jpg"), filepath.Join(dir, "c.jpg")}
+	for _, path := range paths[:2] {
+		if err := os.WriteFile(path, []byte("image"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// c.jpg is missing, so it can't be moved
+	gid, ids := group(t, store, storage.KindImage, paths...)
+
+	decide(t, store, gid, ids[0], storage.ActionKeep)
+	decide(t, store, gid, ids[1], storage.ActionTrash)
+	decide(t, store, gid, ids[2], storage.ActionTrash)
+
+	response, err := store.TrashImages()
+	if err != nil {
+		t.Fatalf("TrashImages: %v", err)
+	}
+	if response.MovedCount != 1 || response.FailedCount != 1 || response.TotalCount != 2 || len(response.Errors) != 1 {
+		t.Errorf("response = %+v, want one moved and one failed file", response)
+	}
+
+	if _, err := os.Stat(paths[1]); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("trashed file is still at %s", paths[1])
+	}
+	if _, err := os.Stat(paths[0]); err != nil {
+		t.Errorf("kept file: %v", err)
+	}
+
+	images, err := store.GetGroupImages(gid)
+	if err != nil {
+		t.Fatalf("GetGroupImages: %v", err)
+	}
+	var got []int
+	for _, img := range images {
+		got = append(got, img.ID)
+	}
+	if want := []int{ids[0], ids[2]}; !reflect.DeepEqual(got, want) {
+		t.Errorf("images after trash run = %v, want %v", got, want)
+	}
+	if _, err := store.GetImagePath(ids[1]); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("GetImagePath of trashed file = %v, want ErrNotFound", err)
+	}
+
+	stats, err := store.GetImageGroupStats(storage.KindImage)
+	if err != nil {
+		t.Fatalf("GetImageGroupStats: %v", err)
+	}
+	if stats.ImagesToTrashCount != 1 {
+		t.Errorf("files to trash after trash run = %d, want the one that failed", stats.ImagesToTrashCount)
+	}
+}
+
+func testDeleteGroups(t *testing.T, store storage.GroupStore) {
+	images, imageIDs := group(t, store, storage.KindImage, "/a.jpg", "/b.jpg")
+	files, _ := group(t, store, storage.KindFile, "/a.txt", "/b.txt")
+
+	if err := store.DeleteImageGroups(storage.KindImage); err != nil {
+		t.Fatalf("DeleteImageGroups: %v", err)
+	}
+
+	if groups := list(t, store, storage.KindImage); len(groups) != 0 {
+		t.Errorf("image groups after delete = %v, want none", groupIDs(groups))
+	}
+	if got := groupIDs(list(t, store, storage.KindFile)); !reflect.DeepEqual(got, []int{files}) {
+		t.Errorf("file groups after delete = %v, want [%d]", got, files)
+	}
+	if images, err := store.GetGroupImages(images); err != nil || len(images) != 0 {
+		t.Errorf("images of deleted group = %v, %v, want none", images, err)
+	}
+	if _, err := store.GetImagePath(imageIDs[0]); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("GetImagePath of deleted file = %v, want ErrNotFound", err)
+	}
+}
+
+func testArchive(t *testing.T, store storage.GroupStore) {
+	archived, _ := group(t, store, storage.KindImage, "/a.jpg", "/b.jpg")
+	pending, _ := group(t, store, storage.KindImage, "/c.jpg", "/d.jpg")
+
+	if err := store.SetGroupArchived(archived, true); err != nil {
+		t.Fatalf("SetGroupArchived: %v", err)
+	}
+
+	if got := groupIDs(list(t, store, storage.KindImage)); !reflect.DeepEqual(got, []int{pending}) {
+		t.Errorf("default groups = %v, want [%d]", got, pending)
+	}
+	groups := listPage(t, store, storage.GroupFilter{Kind: storage.KindImage, Status: storage.StatusArchived}).Groups
+	if len(groups) != 1 || groups[0].ID != archived || groups[0].Status != storage.StatusArchived || groups[0].ArchivedAt == nil {
+		t.Errorf("archived groups = %+v, want group %d archived", groups, archived)
+	}
+	groups = listPage(t, store, storage.GroupFilter{Kind: storage.KindImage, Status: storage.StatusPending}).Groups
+	if got := groupIDs(groups); !reflect.DeepEqual(got, []int{pending}) {
+		t.Errorf("pending groups = %v, want [%d]", got, pending)
+	}
+
+	stats, err := store.GetImageGroupStats(storage.KindImage)
+	if err != nil {
+		t.Fatalf("GetImageGroupStats: %v", err)
+	}
+	if want := (storage.ImageGroupStats{Pending: 1, Archived: 1}); stats != want {
+		t.Errorf("stats = %+v, want %+v", stats, want)
+	}
+
+	if err := store.SetGroupArchived(archived, false); err != nil {
+		t.Fatalf("SetGroupArchived: %v", err)
+	}
+	groups = list(t, store, storage.KindImage)
+	if got := groupIDs(groups); !reflect.DeepEqual(got, []int{archived, pending}) {
+		t.Errorf("groups after unarchiving = %v, want [%d %d]", got, archived, pending)
+	}
+	if groups[0].Status != storage.StatusPending || groups[0].ArchivedAt != nil {
+		t.Errorf("unarchived group = %+v, want it pending", groups[0])
+	}
+
+	if err := store.SetGroupArchived(pending+100, true); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("SetGroupArchived of unknown group = %v, want ErrNotFound", err)
+	}
+}
+
+func testArchiveAfterTrash(t *testing.T, store storage.GroupStore) {
+	t.Setenv("TRASH_DIR", t.TempDir())
+
+	dir := t.TempDir()
+	var paths []string
+	for _, name := range []string{"a.jpg", "b.jpg", "c.jpg", "d.jpg", "e.jpg", "f.jpg"} {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte("image"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		paths = append(paths, path)
+	}
+
+	done, doneIDs := group(t, store, storage.KindImage, paths[0], paths[1])
+	open, openIDs := group(t, store, storage.KindImage, paths[2], paths[3], paths[4])
+	kept, keptIDs := group(t, store, storage.KindImage, paths[5])
+
+	decide(t, store, done, doneIDs[0], storage.ActionKeep)
+	decide(t, store, done, doneIDs[1], storage.ActionTrash)
+	decide(t, store, open, openIDs[0], storage.ActionTrash)
+	decide(t, store, kept, keptIDs[0], storage.ActionKeep)
+
+	response, err := store.TrashImages()
+	if err != nil {
+		t.Fatalf("TrashImages: %v", err)
+	}
+	if response.MovedCount != 2 || response.ArchivedGroups != 1 {
+		t.Errorf("response = %+v, want two moved files and one archived group", response)
+	}
+
+	// groups with pending files and groups without trash decisions stay
+	groups := listPage(t, store, storage.GroupFilter{Kind: storage.KindImage, Status: storage.StatusArchived}).Groups
+	if got := groupIDs(groups); !reflect.DeepEqual(got, []int{done}) {
+		t.Errorf("archived groups = %v, want [%d]", got, done)
+	}
+	if got := groupIDs(list(t, store, storage.KindImage)); !reflect.DeepEqual(got, []int{open, kept}) {
+		t.Errorf("default groups = %v, want [%d %d]", got, open, kept)
+	}
+}
+
+func file(path string, size int64) storage.ScanFile {
+	return storage.ScanFile{Path: path, Size: size, ModifiedDate: 1}
+}
+
+func testFilters(t *testing.T, store storage.GroupStore) {
+	photos, _ := groupFiles(t, store, storage.KindImage, file("/photos/a.jpg", 100), file("/photos/b.JPG", 300))
+	private, _ := groupFiles(t, store, storage.KindImage, file("/photos-private/c.png", 50), file("/backup/c.png", 50))
+	nested, _ := groupFiles(t, store, storage.KindImage,
+		file("/photos/2024/d.jpeg", 1000), file("/photos/2024/d copy.jpeg", 1000), file("/backup/d.jpeg", 1000))
+
+	tests := []struct {
+		name   string
+		filter storage.GroupFilter
+		want   []int
+	}{
+		{"all", storage.GroupFilter{}, []int{photos, private, nested}},
+		{"path", storage.GroupFilter{Path: "copy"}, []int{nested}},
+		{"path is case sensitive", storage.GroupFilter{Path: "COPY"}, nil},
+		{"directory", storage.GroupFilter{Directory: "/photos"}, []int{photos, nested}},
+		{"directory with slash", storage.GroupFilter{Directory: "/photos/"}, []int{photos, nested}},
+		{"subdirectory", storage.GroupFilter{Directory: "/photos/2024"}, []int{nested}},
+		{"extension", storage.GroupFilter{Extension: "jpg"}, []int{photos}},
+		{"extension with dot", storage.GroupFilter{Extension: ".PNG"}, []int{private}},
+		{"min size", storage.GroupFilter{MinSize: 200}, []int{photos, nested}},
+		{"max size", storage.GroupFilter{MaxSize: 100}, []int{photos, private}},
+		{"size range", storage.GroupFilter{MinSize: 200, MaxSize: 500}, []int{photos}},
+		{"min count", storage.GroupFilter{MinCount: 3}, []int{nested}},
+		{"max count", storage.GroupFilter{MaxCount: 2}, []int{photos, private}},
+		// the conditions on files have to hold for the same file
+		{"same file", storage.GroupFilter{Directory: "/backup", Extension: "jpeg", MaxSize: 100}, nil},
+		{"combined", storage.GroupFilter{Directory: "/backup", Extension: "png", MaxCount: 2}, []int{private}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.filter.Kind = storage.KindImage
+			page := listPage(t, store, tt.filter)
+			if got := groupIDs(page.Groups); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("groups = %v, want %v", got, tt.want)
+			}
+			if page.Total != len(tt.want) {
+				t.Errorf("total = %d, want %d", page.Total, len(tt.want))
+			}
+		})
+	}
+}
+
+func testSorts(t *testing.T, store storage.GroupStore) {
+	t.Setenv("TRASH_DIR", t.TempDir())
+
+	dir := t.TempDir()
+	trashed := filepath.Join(dir, "trashed.jpg")
+	if err := os.WriteFile(trashed, []byte("image"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	small, _ := groupFiles(t, store, storage.KindImage, file("/a.jpg", 10), file("/b.jpg", 10), file("/c.jpg", 10))
+	large, _ := groupFiles(t, store, storage.KindImage, file("/d.jpg", 1000), file("/e.jpg", 100))
+	uneven, unevenIDs := groupFiles(t, store, storage.KindImage,
+		file("/f.jpg", 200), file("/g.jpg", 200), file(trashed, 5000))
+
+	// trashed files don't count towards the sizes
+	decide(t, store, uneven, unevenIDs[2], storage.ActionTrash)
+	if _, err := store.TrashImages(); err != nil {
+		t.Fatalf("TrashImages: %v", err)
+	}
+
+	sizes := map[int][2]int64{small: {30, 20}, large: {1100, 100}, uneven: {400, 200}}
+	for _, g := range list(t, store, storage.KindImage) {
+		if got := [2]int64{g.Size, g.Reclaimable}; got != sizes[g.ID] {
+			t.Errorf("size and reclaimable of group %d = %v, want %v", g.ID, got, sizes[g.ID])
+		}
+	}
+
+	tests := []struct {
+		sort storage.GroupSort
+		want []int
+	}{
+		{storage.SortGroupsByReclaimable, []int{uneven, large, small}},
+		{storage.SortGroupsBySize, []int{large, uneven, small}},
+		{storage.SortGroupsByCount, []int{small, uneven, large}},
+		// groups never decided on come last
+		{storage.SortGroupsByUpdated, []int{uneven, small, large}},
+	}
+	for _, tt := range tests {
+		filter := storage.GroupFilter{Kind: storage.KindImage, Sort: tt.sort}
+		if got := groupIDs(listPage(t, store, filter).Groups); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("groups by %s = %v, want %v", tt.sort, got, tt.want)
+		}
+	}
+}
+
+func testPagination(t *testing.T, store storage.GroupStore) {
+	var pending []int
+	for range 5 {
+		gid, _ := group(t, store, storage.KindImage, "/a.jpg", "/b.jpg")
+		pending = append(pending, gid)
+	}
+	decided, decidedIDs := group(t, store, storage.KindImage, "/c.jpg", "/d.jpg")
+	for _, id := range decidedIDs {
+		decide(t, store, decided, id, storage.ActionKeep)
+	}
+	all := append(pending, decided)
+
+	for _, sort := range append([]storage.GroupSort{""}, storage.GroupSorts...) {
+		filter := storage.GroupFilter{Kind: storage.KindImage, Sort: sort, Limit: 2}
+		want := groupIDs(listPage(t, store, storage.GroupFilter{Kind: storage.KindImage, Sort: sort}).Groups)
+		if len(want) != len(all) {
+			t.Fatalf("groups by %q = %v, want %d groups", sort, want, len(all))
+		}
+
+		var got []int
+		for pages := 0; ; pages++ {
+			if pages > len(all) {
+				t.Fatalf("paging by %q doesn't end", sort)
+			}
+			page := listPage(t, store, filter)
+			if page.Total != len(all) {
+				t.Errorf("total by %q = %d, want %d", sort, page.Total, len(all))
+			}
+			if len(page.Groups) > filter.Limit {
+				t.Errorf("page by %q has %d groups, want at most %d", sort, len(page.Groups), filter.Limit)
+			}
+			got = append(got, groupIDs(page.Groups)...)
+			if page.NextCursor == "" {
+				break
+			}
+			filter.Cursor = page.NextCursor
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("pages by %q = %v, want %v", sort, got, want)
+		}
+	}
+
+	page := listPage(t, store, storage.GroupFilter{Kind: storage.KindImage, Limit: 2})
+	for _, filter := range []storage.GroupFilter{
+		{Kind: storage.KindImage, Cursor: "not a cursor"},
+		{Kind: storage.KindImage, Cursor: page.NextCursor, Sort: storage.SortGroupsBySize},
+	} {
+		if _, err := store.ListImageGroups(filter); !errors.Is(err, storage.ErrInvalidCursor) {
+			t.Errorf("ListImageGroups(%+v) = %v, want ErrInvalidCursor", filter, err)
+		}
+	}
+}
+
+// testPaginationTies pages through groups whose keys are equal in every
+// sort, so that each page ends on a tie broken by group ID.
+func testPaginationTies(t *testing.T, store storage.GroupStore) {
+	var want []int
+	for range 5 {
+		gid, _ := group(t, store, storage.KindImage, "/a.jpg", "/b.jpg")
+		want = append(want, gid)
+	}
+
+	cursors := make(map[storage.GroupSort]string)
+	for _, sort := range append([]storage.GroupSort{""}, storage.GroupSorts...) {
+		filter := storage.GroupFilter{Kind: storage.KindImage, Sort: sort, Limit: 2}
+
+		var got []int
+		for pages := 0; ; pages++ {
+			if pages > len(want) {
+				t.Fatalf("paging by %q doesn't end", sort)
+			}
+			page := listPage(t, store, filter)
+			got = append(got, groupIDs(page.Groups)...)
+			if page.NextCursor == "" {
+				break
+			}
+			filter.Cursor = page.NextCursor
+			cursors[sort] = page.NextCursor
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("pages by %q = %v, want %v", sort, got, want)
+		}
+	}
+
+	// a cursor only continues the sort it was returned for
+	for from, cursor := range cursors {
+		for _, sort := range append([]storage.GroupSort{""}, storage.GroupSorts...) {
+			if sort == from {
+				continue
+			}
+			filter := storage.GroupFilter{Kind: storage.KindImage, Sort: sort, Cursor: cursor}
+			if _, err := store.ListImageGroups(filter); !errors.Is(err, storage.ErrInvalidCursor) {
+				t.Errorf("cursor of %q sorted by %q = %v, want ErrInvalidCursor", from, sort, err)
+			}
+		}
+	}
+}
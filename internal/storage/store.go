@@ -0,0 +1,23 @@
+package storage
+
+// GroupStore stores the duplicate groups found by scans and the decisions
+// made on their files. Storage keeps them in SQLite, Memory in memory.
+type GroupStore interface {
+	CreateImageGroup(kind Kind, hash string, size int64, fileCount int) (int, error)
+	CreateImage(groupID int, file ScanFile) (int, error)
+	DeleteImageGroups(kind Kind) error
+
+	ListImageGroups(filter GroupFilter) (GroupPage, error)
+	GetGroupImages(groupID int) ([]Image, error)
+	GetImageGroupStats(kind Kind) (ImageGroupStats, error)
+	GetImagePath(id int) (string, error)
+
+	UpdateImageAction(groupID int, fileID int, action ImageAction) error
+	SetGroupArchived(id int, archived bool) error
+	TrashImages() (TrashImagesResponse, error)
+}
+
+var (
+	_ GroupStore = (*Storage)(nil)
+	_ GroupStore = (*Memory)(nil)
+)
@@ -1,8 +1,54 @@
 package storage
 
+import "slices"
+
 const (
 	ActionPending ImageAction = "pending"
 	ActionKeep    ImageAction = "keep"
 	ActionTrash   ImageAction = "trash"
 	ActionTrashed ImageAction = "trashed"
+
+	// ActionRename marks a file with a wrong extension to be renamed to its
+	// proper extension by the next trash run, which records it as renamed.
+	ActionRename  ImageAction = "rename"
+	ActionRenamed ImageAction = "renamed"
+
+	// ActionRepointed records a symlink that was pointed to a new target.
+	ActionRepointed ImageAction = "repointed"
 )
+
+// Kind is the type of czkawka scan that produced a group or finding.
+type Kind string
+
+const (
+	KindImage Kind = "image"
+	KindFile  Kind = "file"
+	KindVideo Kind = "video"
+	KindMusic Kind = "music"
+
+	KindBroken Kind = "broken"
+	KindBig    Kind = "big"
+
+	KindEmptyFolders Kind = "empty-folders"
+	KindEmptyFiles   Kind = "empty-files"
+	KindTemp         Kind = "temp"
+	KindSymlinks     Kind = "symlinks"
+	KindExtensions   Kind = "ext"
+)
+
+// GroupKinds lists the kinds whose results are stored as duplicate groups.
+var GroupKinds = []Kind{KindImage, KindFile, KindVideo, KindMusic}
+
+// FindingKinds lists the kinds whose results are stored as single file
+// findings.
+var FindingKinds = []Kind{KindBroken, KindBig, KindEmptyFolders, KindEmptyFiles, KindTemp, KindSymlinks, KindExtensions}
+
+// Grouped reports whether results of kind are stored as duplicate groups.
+func (k Kind) Grouped() bool {
+	return slices.Contains(GroupKinds, k)
+}
+
+// Valid reports whether kind is a known kind of scan.
+func (k Kind) Valid() bool {
+	return k.Grouped() || slices.Contains(FindingKinds, k)
+}
@@ -1,6 +1,15 @@
 let selectedImageIndex = null
 let currentGroupIndex = -1
 let hasDecisions = false
+let currentKind = 'image'
+let currentStatus = ''
+
+const kindTitles = {
+  image: 'Duplicate Images',
+  file: 'Duplicate Files',
+  video: 'Similar Videos',
+  music: 'Duplicate Music',
+}
 
 function selectImage(index) {
   document.querySelectorAll('.image-item').forEach(item => {
@@ -115,53 +124,108 @@ function toggleHelpModal() {
 }
 
 
+// groupsPageSize is the number of groups loaded at a time.
+const groupsPageSize = 50
+let nextGroupsCursor = ''
+
+function groupsQuery(cursor) {
+  const params = new URLSearchParams({ kind: currentKind, limit: groupsPageSize })
+  if (currentStatus) {
+    params.set('status', currentStatus)
+  }
+
+  const path = document.getElementById('group-path-input').value.trim()
+  const ext = document.getElementById('group-ext-input').value.trim()
+  const sort = document.getElementById('group-sort-input').value
+  if (path) {
+    params.set('path', path)
+  }
+  if (ext) {
+    params.set('ext', ext)
+  }
+  if (sort) {
+    params.set('sort', sort)
+  }
+  if (cursor) {
+    params.set('cursor', cursor)
+  }
+  return params.toString()
+}
+
 async function loadGroups() {
+  const groupsContainer = document.getElementById('groups-container');
+  groupsContainer.innerHTML = '';
+  nextGroupsCursor = ''
+
+  await loadMoreGroups()
+
+  if (groupsContainer.children.length === 0) {
+    const item = document.createElement('div');
+    item.textContent = "No duplicates found yet"
+    groupsContainer.appendChild(item)
+  }
+  updateShortcutHints()
+  updateGroupProgress()
+}
+
+async function loadMoreGroups() {
+  const groupsContainer = document.getElementById('groups-container');
+  const loadMoreButton = document.getElementById('load-more-groups-button')
+  loadMoreButton.disabled = true
+
   try {
-    const groups = await fetchJSON('/api/groups')
-
-    const groupsContainer = document.getElementById('groups-container');
-    groupsContainer.innerHTML = '';
-
-    if (groups === null || groups.length === 0) {
-      const item = document.createElement('div');
-      item.textContent = "No duplicates found yet"
-      groupsContainer.appendChild(item)
-
-    } else {
-      for (const group of groups) {
-        const imagesGrid = await createImagesGrid(group.id)
-        if (imagesGrid === null || imagesGrid === undefined) {
-          continue
-        }
-        const duplicateGroupDiv = document.createElement('div');
-        duplicateGroupDiv.className = 'duplicate-group';
-
-        if (group.status.toLowerCase() === 'decided') {
-          duplicateGroupDiv.classList.add('group-decided')
-        }
-        const reviewString = group.updatedAt ? `last reviewed at: ${group.updatedAt}` : "Not yet reviewed"
-
-        duplicateGroupDiv.innerHTML = `
-          <div class="group-info">
-            ${group.imageCount} images
-            <span class="group-status" data-status="${group.status.toLowerCase()}">${group.status}</span>
-            <span class="group-updated-at">${reviewString}</span>
-          </div>
-    `;
+    const page = await fetchJSON(`/api/groups?${groupsQuery(nextGroupsCursor)}`)
 
+    for (const group of page.groups) {
+      const duplicateGroupDiv = await createGroupDiv(group)
+      if (duplicateGroupDiv) {
         groupsContainer.appendChild(duplicateGroupDiv)
-        duplicateGroupDiv.appendChild(imagesGrid)
-
-      };
+      }
     }
+
+    nextGroupsCursor = page.nextCursor || ''
+    const shown = groupsContainer.querySelectorAll('.duplicate-group').length
+    document.getElementById('groups-page-info').textContent = page.total > 0 ? `Showing ${shown} of ${page.total} groups` : ''
   } catch (error) {
     showError('Failed to load group')
     console.error(error)
   }
-  updateShortcutHints()
+
+  loadMoreButton.hidden = nextGroupsCursor === ''
+  loadMoreButton.disabled = false
   updateGroupProgress()
 }
 
+async function createGroupDiv(group) {
+  const imagesGrid = await createImagesGrid(group.id)
+  if (imagesGrid === null || imagesGrid === undefined) {
+    return
+  }
+  const duplicateGroupDiv = document.createElement('div');
+  duplicateGroupDiv.className = 'duplicate-group';
+
+  if (group.status.toLowerCase() === 'decided') {
+    duplicateGroupDiv.classList.add('group-decided')
+  }
+  const reviewString = group.updatedAt ? `last reviewed at: ${group.updatedAt}` : "Not yet reviewed"
+  const archived = group.status === 'archived'
+
+  duplicateGroupDiv.innerHTML = `
+    <div class="group-info">
+      ${group.music ? `${escapeHTML(group.music.artist)} – ${escapeHTML(group.music.title)} ·` : ''}
+      ${group.imageCount} images · ${formatBytes(group.size)}, ${formatBytes(group.reclaimable)} reclaimable
+      <span class="group-status" data-status="${group.status.toLowerCase()}">${group.status}</span>
+      <span class="group-updated-at">${reviewString}</span>
+      <button class="archive-button" data-group-id="${group.id}" data-archived="${archived}">
+        ${archived ? 'Unarchive' : 'Archive'}
+      </button>
+    </div>
+  `;
+
+  duplicateGroupDiv.appendChild(imagesGrid)
+  return duplicateGroupDiv
+}
+
 async function createImagesGrid(id) {
   try {
     const images = await fetchJSON(`/api/groups/${id}`);
@@ -204,9 +268,13 @@ function createImageElement(image, index, imageDiv) {
 
   imageDiv.innerHTML = `
     <div class="duplicate-image">
-      <img src="/api/image?path=${encodeURIComponent(image.path)}" alt="Image ${index + 1}">
+      ${createPreview(image, index)}
       <div class="metadata">
         <div><strong>Size: </strong> ${formatBytes(image.imageSize)}</div>
+        ${createModifiedDate(image.modifiedDate)}
+        ${createImageMetadata(image.image)}
+        ${createVideoMetadata(image.video)}
+        ${createMusicMetadata(image.music)}
       </div>
     </div>
     <div class="action-buttons">
@@ -223,6 +291,126 @@ function createImageElement(image, index, imageDiv) {
   metaDataDiv.prepend(pathDiv)
 }
 
+function createPreview(image, index) {
+  if (currentKind === 'image') {
+    return `<img src="/api/files/${image.id}/content" alt="Image ${index + 1}">`
+  }
+
+  if (currentKind === 'video') {
+    return `<video controls preload="metadata" src="/api/files/${image.id}/content"></video>`
+  }
+
+  if (currentKind === 'music') {
+    return `<audio controls preload="none" src="/api/files/${image.id}/content"></audio>`
+  }
+
+  const name = image.path.split('/').pop()
+  const dot = name.lastIndexOf('.')
+  const extension = dot > 0 ? name.slice(dot + 1).toUpperCase() : 'FILE'
+  return `<div class="file-preview">${escapeHTML(extension)}</div>`
+}
+
+function createModifiedDate(modifiedDate) {
+  if (!modifiedDate) {
+    return ''
+  }
+
+  return `<div><strong>Modified: </strong> ${new Date(modifiedDate * 1000).toLocaleString()}</div>`
+}
+
+function createImageMetadata(image) {
+  if (!image) {
+    return ''
+  }
+
+  return `
+    <div><strong>Resolution: </strong> ${image.width}x${image.height}</div>
+    <div><strong>Similarity: </strong> ${image.similarity === 0 ? 'identical hash' : `${image.similarity} bits apart`}</div>
+    <div><strong>Hash: </strong> <code>${escapeHTML(image.hash)}</code></div>
+  `
+}
+
+function createVideoMetadata(video) {
+  if (!video) {
+    return ''
+  }
+
+  return `
+    <div><strong>Duration: </strong> ${formatDuration(video.duration)}</div>
+    <div><strong>Resolution: </strong> ${video.width}x${video.height}</div>
+    <div><strong>Codec: </strong> ${escapeHTML(video.codec)} (${escapeHTML(video.container)})</div>
+    <div><strong>Bitrate: </strong> ${Math.round(video.bitrate / 1000)} kb/s</div>
+  `
+}
+
+function createMusicMetadata(music) {
+  if (!music) {
+    return ''
+  }
+
+  return `
+    <div><strong>Artist: </strong> ${escapeHTML(music.artist)}</div>
+    <div><strong>Title: </strong> ${escapeHTML(music.title)}</div>
+    <div><strong>Album: </strong> ${escapeHTML(music.album)} (${escapeHTML(music.year)})</div>
+    <div><strong>Genre: </strong> ${escapeHTML(music.genre)}</div>
+    <div><strong>Length: </strong> ${escapeHTML(music.length)}, ${music.bitrate} kb/s</div>
+  `
+}
+
+function setupKindSelect() {
+  const select = document.getElementById('scan-kind-input')
+  select.value = currentKind
+
+  select.addEventListener('change', () => {
+    currentKind = select.value
+    document.getElementById('groups-title').textContent = kindTitles[currentKind]
+    currentGroupIndex = -1
+    selectedImageIndex = null
+    loadGroups()
+    loadGroupsStatus()
+  })
+}
+
+function setupStatusSelect() {
+  const select = document.getElementById('group-status-input')
+  select.value = currentStatus
+
+  select.addEventListener('change', () => {
+    currentStatus = select.value
+    currentGroupIndex = -1
+    selectedImageIndex = null
+    loadGroups()
+  })
+}
+
+function setupGroupFilters() {
+  const form = document.getElementById('group-filters')
+  const reload = () => {
+    currentGroupIndex = -1
+    selectedImageIndex = null
+    loadGroups()
+  }
+
+  form.addEventListener('submit', (e) => {
+    e.preventDefault()
+    reload()
+  })
+  document.getElementById('group-sort-input').addEventListener('change', reload)
+  document.getElementById('load-more-groups-button').addEventListener('click', loadMoreGroups)
+}
+
+async function setGroupArchived(groupId, archived) {
+  try {
+    await fetchJSON(`/api/groups/${groupId}/archive`, {
+      method: archived ? 'POST' : 'DELETE'
+    })
+    loadGroups()
+    loadGroupsStatus()
+  } catch (error) {
+    showError(`Failed to ${archived ? 'archive' : 'unarchive'} group: ${error.message}`)
+  }
+}
+
 function applyActionState(element, action) {
   if (action === "trash") {
     element.classList.remove("to-keep")
@@ -267,12 +455,13 @@ async function updateFileActionById(groupId, fileId, action) {
 
 async function loadGroupsStatus() {
   try {
-    const stats = await fetchJSON("/api/groups/stats")
+    const stats = await fetchJSON(`/api/groups/stats?kind=${currentKind}`)
 
     updateTrashButtonState(stats.imagesToTrashCount)
 
     document.getElementById('pending-count').textContent = stats.pending
     document.getElementById('decided-count').textContent = stats.decided
+    document.getElementById('archived-count').textContent = stats.archived
 
   } catch (error) {
     showError("Failed to load Groups Statistics")
@@ -294,7 +483,10 @@ function setupTrashButton() {
       })
 
       if (response.movedCount > 0) {
-        showSuccess(`Successfully moved ${response.movedCount} of ${response.totalCount} to trash`)
+        showSuccess(
+          `Successfully moved ${response.movedCount} of ${response.totalCount} to trash` +
+          (response.archivedGroups > 0 ? `, archived ${response.archivedGroups} finished groups` : '')
+        )
         hasDecisions = false
       }
 
@@ -312,7 +504,7 @@ function setupTrashButton() {
       loadGroupsStatus();
     } catch (error) {
       console.error(error)
-      showError("Failed to move files to trash")
+      showError("Failed to move files to trash: " + error.message)
     }
   }
 }
@@ -411,22 +603,43 @@ function setupFileActionButton() {
       const groupId = parseInt(closest.dataset.groupId)
       const fileId = parseInt(closest.dataset.fileId)
       await updateFileActionById(groupId, fileId, 'trash')
+    } else if (e.target.classList.contains('archive-button')) {
+      const groupId = parseInt(e.target.dataset.groupId)
+      await setGroupArchived(groupId, e.target.dataset.archived !== 'true')
     }
     loadGroupsStatus()
   })
 }
 
+async function setupLibrarySelect() {
+  const select = document.getElementById('scan-library-input')
+  try {
+    const roots = await fetchJSON('/api/libraries')
+    for (const root of roots) {
+      const option = document.createElement('option')
+      option.value = root.path
+      option.textContent = root.name
+      option.title = root.path
+      select.appendChild(option)
+    }
+  } catch (error) {
+    showError('Failed to load libraries ' + error.message)
+  }
+}
+
 function setupScanForm() {
   const form = document.getElementById("scan")
+  const library = document.getElementById("scan-library-input")
   const input = document.getElementById("scan-directory-input")
   const button = document.getElementById("scan-button")
 
   form.addEventListener('submit', async (e) => {
     e.preventDefault()
 
-    const stats = await fetchJSON('/api/groups/stats')
+    const merge = document.getElementById('scan-merge-input').checked
+    const stats = await fetchJSON(`/api/groups/stats?kind=${currentKind}`)
 
-    if (stats.decided > 0) {
+    if (!merge && stats.decided > 0) {
       const confirmed = confirm(
         `Warning: Rescanning will clear all ${stats.decided} decided groups and any pending decisions.\n\n` +
         `Consider using "Move to Trash" button first to save your work.\n\n` +
@@ -438,22 +651,38 @@ function setupScanForm() {
       }
     }
 
-    const directory = input.value.trim()
-    if (!directory) {
-      showError('Please enter a directory path')
+    if (!library.value) {
+      showError('Please select a library')
       return
     }
+    const subdirectory = input.value.trim().replace(/^\/+/, '')
+    const directory = subdirectory ? `${library.value.replace(/\/+$/, '')}/${subdirectory}` : library.value
 
     button.disabled = true
     button.textContent = 'Scanning...'
 
     try {
-      const response = await fetchJSON('/api/scan', {
+      const job = await fetchJSON('/api/scan', {
         method: 'POST',
         headers: { 'Content-Type': 'application/json' },
-        body: JSON.stringify({ directory: directory })
+        body: JSON.stringify({ kind: currentKind, directory: directory, merge: merge })
       })
-      showSuccess(response.message || `Found ${response.groupCount} duplicate groups`)
+
+      const result = await waitForScanJob(job.id, button)
+
+      if (result.state === 'done' && result.report && result.merge) {
+        const report = result.report
+        showSuccess(
+          `Groups: ${report.groupsAdded} added, ${report.groupsCarriedOver} carried over, ` +
+          `${report.groupsChanged} changed, ${report.groupsRemoved} removed`
+        )
+      } else if (result.state === 'done') {
+        showSuccess(result.message || `Found ${result.groupCount} duplicate groups`)
+      } else if (result.state === 'cancelled') {
+        showWarning('Scan cancelled')
+      } else {
+        showError('Scan failed ' + result.message)
+      }
 
       await loadGroups()
       await loadGroupsStatus()
@@ -467,6 +696,64 @@ function setupScanForm() {
   })
 }
 
+// loadOperationStatus shows the scan, import or trash run in progress,
+// which may have been started by another client.
+async function loadOperationStatus() {
+  const status = document.getElementById('operation-status')
+  try {
+    const result = await fetchJSON('/api/operation')
+    if (!result.running) {
+      status.hidden = true
+      return
+    }
+
+    const op = result.operation
+    let text = `${op.kind.charAt(0).toUpperCase()}${op.kind.slice(1)} in progress`
+    if (op.scanKind && op.directory) {
+      text += ` (${op.scanKind}, ${op.directory})`
+    }
+    text += `, started by ${op.startedBy} at ${new Date(op.startedAt).toLocaleString()}`
+    status.textContent = text
+    status.hidden = false
+  } catch (error) {
+    console.error(error)
+  }
+}
+
+async function waitForScanJob(jobId, button) {
+  const cancelButton = document.getElementById('cancel-scan-button')
+  cancelButton.hidden = false
+  cancelButton.onclick = async () => {
+    cancelButton.disabled = true
+    try {
+      await fetchJSON(`/api/scan/jobs/${jobId}`, { method: 'DELETE' })
+    } catch (error) {
+      console.error(error)
+    }
+  }
+
+  try {
+    while (true) {
+      const job = await fetchJSON(`/api/scan/jobs/${jobId}`)
+      if (['done', 'failed', 'cancelled'].includes(job.state)) {
+        return job
+      }
+
+      const latest = job.progress && job.progress.length > 0 ? job.progress[job.progress.length - 1] : null
+      let text = `Scanning (${job.state}, ${Math.round(job.elapsedSeconds)}s)`
+      if (latest && latest.total > 0) {
+        text += ` ${latest.current}/${latest.total}`
+      }
+      button.textContent = text
+
+      await new Promise(resolve => setTimeout(resolve, 1000))
+    }
+  } finally {
+    cancelButton.hidden = true
+    cancelButton.disabled = false
+  }
+}
+
 
 function setupHelpModalCloseButton() {
   document.querySelector('.help-modal-close').addEventListener('click', toggleHelpModal)
@@ -484,6 +771,12 @@ setupTrashButton()
 loadGroupsStatus()
 setupFileActionButton()
 setupKeyboardShortcuts()
+setupLibrarySelect()
 setupScanForm()
+setupKindSelect()
+setupStatusSelect()
+setupGroupFilters()
 updateShortcutHints()
 setupHelpModalCloseButton()
+loadOperationStatus()
+setInterval(loadOperationStatus, 5000)
@@ -29,6 +29,11 @@ async function fetchJSON(url, options = {}) {
   const response = await fetch(url, options)
 
   if (!response.ok) {
+    // refused operations come with the operation in progress
+    if (response.status === 409 && response.headers.get('Content-Type') === 'application/json') {
+      const body = await response.json()
+      throw new Error(body.error)
+    }
     throw new Error(`HTTP ${response.status}: ${response.statusText}`)
   }
 
@@ -40,3 +45,15 @@ function formatBytes(bytes) {
   if (bytes < 1024 * 1024) return (bytes / 1024).toFixed(1) + ' KB';
   return (bytes / (1024 * 1024)).toFixed(1) + ' MB';
 }
+
+function escapeHTML(text) {
+  const div = document.createElement('div')
+  div.textContent = text
+  return div.innerHTML
+}
+
+function formatDuration(seconds) {
+  const minutes = Math.floor(seconds / 60)
+  const rest = Math.round(seconds % 60)
+  return `${minutes}:${String(rest).padStart(2, '0')}`
+}